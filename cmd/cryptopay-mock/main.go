@@ -0,0 +1,23 @@
+// Команда cryptopay-mock запускает поддельный Crypto Pay API, чтобы пройти
+// покупку за криптовалюту без сети: бот выставляет счёт в заглушке, а
+// переход по ссылке из счёта «оплачивает» его и отправляет боту вебхук.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"vpn-bot/internal/payment/cryptopay/cryptopaytest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "адрес, на котором слушает заглушка")
+	token := flag.String("token", "test-token", "токен приложения, как в CRYPTO_PAY_TOKEN")
+	webhook := flag.String("webhook", "http://localhost:8080/cryptopay-webhook", "адрес вебхука бота")
+	flag.Parse()
+
+	server := cryptopaytest.NewServer(*token, *webhook)
+	log.Printf("🧪 Заглушка Crypto Pay на %s, API: http://localhost%s/api, вебхуки: %s", *addr, *addr, *webhook)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
@@ -11,9 +11,19 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"vpn-bot/internal/config"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/payment/cryptopay"
+	"vpn-bot/internal/payment/telegrampay"
+	"vpn-bot/internal/payment/yookassa"
 	"vpn-bot/internal/repository"
+	"vpn-bot/internal/scheduler"
 	"vpn-bot/internal/service"
 	"vpn-bot/internal/telegram"
+	"vpn-bot/internal/vpn/fakevpn"
+	"vpn-bot/internal/vpn/outline"
+	"vpn-bot/internal/vpn/wireguard"
+	"vpn-bot/internal/vpn/xui"
 )
 
 func main() {
@@ -31,10 +41,10 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	vpnRepo := repository.NewVPNKeyRepository(db)
 	payRepo := repository.NewPaymentRepository(db)
-
-	userService := service.NewUserService(userRepo)
-	vpnService := service.NewVPNKeyService(vpnRepo)
-	paymentService := service.NewPaymentService(payRepo, vpnService, cfg.YooKassaShopID, cfg.YooKassaSecret)
+	planRepo := repository.NewPlanRepository(db)
+	deliveryRepo := repository.NewPendingDeliveryRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	uow := repository.NewUnitOfWork(db)
 
 	bot, err := tgbotapi.NewBotAPI(cfg.TelegramBotToken)
 	if err != nil {
@@ -42,6 +52,108 @@ func main() {
 	}
 	bot.Debug = true
 
+	outboxWorker := scheduler.NewOutboxWorker(uow, telegram.NewSender(bot), cfg.AdminIDs, cfg.OutboxPollInterval)
+	notifier := service.NewOutboxNotifier(notificationRepo, cfg.AdminIDs, outboxWorker.Wake)
+	go outboxWorker.Run(context.Background())
+
+	var provisioner service.VPNProvisioner
+	switch cfg.VPNBackend {
+	case domain.VPNKeyBackendPool:
+		provisioner = service.NewPoolProvisioner(vpnRepo)
+	case outline.Name:
+		if cfg.OutlineAPIURL == "" {
+			log.Fatal("OUTLINE_API_URL не задан")
+		}
+		backend := outline.NewBackend(cfg.OutlineAPIURL, cfg.OutlineCertSHA256, cfg.OutlineDataLimit)
+		provisioner = service.NewBackendProvisioner(backend, vpnRepo, userRepo)
+	case xui.Name:
+		if cfg.XUIURL == "" || cfg.XUIInboundID == 0 {
+			log.Fatal("XUI_URL и XUI_INBOUND_ID не заданы")
+		}
+		backend := xui.NewBackend(xui.Config{
+			URL:          cfg.XUIURL,
+			Username:     cfg.XUIUsername,
+			Password:     cfg.XUIPassword,
+			InboundID:    cfg.XUIInboundID,
+			Host:         cfg.XUIHost,
+			Flow:         cfg.XUIFlow,
+			TrafficLimit: cfg.XUITrafficLimit,
+		})
+		provisioner = service.NewBackendProvisioner(backend, vpnRepo, userRepo)
+	case wireguard.Name:
+		if cfg.WireGuardServerPublicKey == "" || cfg.WireGuardEndpoint == "" {
+			log.Fatal("WIREGUARD_SERVER_PUBLIC_KEY и WIREGUARD_ENDPOINT не заданы")
+		}
+		subnet, err := wireguard.ParseSubnet(cfg.WireGuardSubnet)
+		if err != nil {
+			log.Fatal(err)
+		}
+		peerRepo := repository.NewWireGuardPeerRepository(db)
+		var applier wireguard.Applier
+		if cfg.WireGuardAddCommand != "" || cfg.WireGuardRemoveCommand != "" {
+			if cfg.WireGuardAddCommand == "" || cfg.WireGuardRemoveCommand == "" {
+				log.Fatal("WIREGUARD_ADD_COMMAND и WIREGUARD_REMOVE_COMMAND задаются вместе")
+			}
+			applier = wireguard.NewCommand(cfg.WireGuardAddCommand, cfg.WireGuardRemoveCommand)
+		} else {
+			applier = wireguard.NewPeersFile(cfg.WireGuardPeersFile, peerRepo, cfg.WireGuardReloadCommand)
+		}
+		backend := wireguard.NewBackend(wireguard.Config{
+			Subnet:              subnet,
+			ServerPublicKey:     cfg.WireGuardServerPublicKey,
+			Endpoint:            cfg.WireGuardEndpoint,
+			DNS:                 cfg.WireGuardDNS,
+			AllowedIPs:          cfg.WireGuardAllowedIPs,
+			PersistentKeepalive: cfg.WireGuardKeepalive,
+		}, peerRepo, applier)
+		provisioner = service.NewBackendProvisioner(backend, vpnRepo, userRepo)
+	case fakevpn.Name:
+		provisioner = service.NewBackendProvisioner(fakevpn.NewBackend(cfg.FakeVPNAPIURL, cfg.FakeVPNToken), vpnRepo, userRepo)
+	default:
+		log.Fatalf("Неизвестный VPN_BACKEND: %s", cfg.VPNBackend)
+	}
+
+	userService := service.NewUserService(userRepo)
+	vpnService := service.NewVPNKeyService(vpnRepo, deliveryRepo, uow, notifier, provisioner)
+	planService := service.NewPlanService(planRepo)
+
+	var receipts *yookassa.ReceiptSettings
+	if cfg.YooKassaReceipts {
+		receipts = &yookassa.ReceiptSettings{VATCode: cfg.YooKassaVATCode, TaxSystemCode: cfg.YooKassaTaxSystemCode}
+	}
+	providers := []payment.Provider{
+		yookassa.NewProvider(cfg.YooKassaShopID, cfg.YooKassaSecret, receipts),
+		telegrampay.NewStarsProvider(bot),
+	}
+	if cfg.TelegramPaymentsToken != "" {
+		providers = append(providers, telegrampay.NewProvider(bot, cfg.TelegramPaymentsToken))
+	}
+	if cfg.CryptoPayToken != "" {
+		providers = append(providers, cryptopay.NewProvider(cfg.CryptoPayAPIURL, cfg.CryptoPayToken, cfg.CryptoPayAssets))
+	}
+	paymentProviders, err := payment.NewRegistry(cfg.PaymentProvider, cfg.PlanProviders, providers...)
+	if err != nil {
+		log.Fatalf("Ошибка настройки платёжных провайдеров: %v", err)
+	}
+
+	returnURL := cfg.PaymentReturnURL
+	if returnURL == "" {
+		returnURL = "https://t.me/" + bot.Self.UserName + "?start=paid_{payment}"
+	}
+
+	paymentService := service.NewPaymentService(
+		uow,
+		payRepo,
+		userRepo,
+		notifier,
+		paymentProviders,
+		provisioner,
+		cfg.YooKassaManualCapture,
+		cfg.KeyReservationTTL,
+		returnURL,
+		service.DescriptionTemplates{Purchase: cfg.PurchaseDescription, Renewal: cfg.RenewalDescription},
+	)
+
 	encoded := base64.StdEncoding.EncodeToString([]byte(cfg.YooKassaShopID + ":" + cfg.YooKassaSecret))
 
 	tgHandler := telegram.NewHandler(
@@ -49,13 +161,37 @@ func main() {
 		userService,
 		vpnService,
 		paymentService,
+		planService,
+		notifier,
 		cfg.AdminIDs,
 		"Basic "+encoded,
 		[]byte(cfg.YooKassaSecret),
 	)
 
+	expiryScheduler := scheduler.NewExpiryScheduler(
+		vpnRepo,
+		vpnService,
+		notifier,
+		paymentService,
+		cfg.ExpiryCheckInterval,
+		cfg.KeyGracePeriod,
+		cfg.AutoRenewBefore,
+	)
+	go expiryScheduler.Run(context.Background())
+
+	if cfg.PaymentReconcileInterval > 0 {
+		reconciler := scheduler.NewPaymentReconciler(payRepo, paymentService, cfg.PaymentReconcileInterval, cfg.PaymentReconcileAfter)
+		go reconciler.Run(context.Background())
+	}
+
+	allowlist, err := telegram.NewIPAllowlist(cfg.YooKassaAllowedIPs, cfg.TrustForwardedFor)
+	if err != nil {
+		log.Fatalf("Ошибка чтения YOOKASSA_ALLOWED_IPS: %v", err)
+	}
+
 	go func() {
-		http.HandleFunc("/yookassa-webhook", tgHandler.HandleYooKassaWebhook)
+		http.Handle("/yookassa-webhook", allowlist.Wrap(http.HandlerFunc(tgHandler.HandleYooKassaWebhook)))
+		http.HandleFunc("/cryptopay-webhook", tgHandler.HandleCryptoPayWebhook)
 		addr := ":" + strconv.Itoa(cfg.Port)
 		log.Printf("Запуск HTTP-сервера на порту %d для вебхуков ЮKassa...", cfg.Port)
 		log.Fatal(http.ListenAndServe(addr, nil))
@@ -0,0 +1,21 @@
+// Команда vpn-mock запускает поддельную VPN-панель, чтобы бот выдавал,
+// продлевал и отзывал ключи без настоящего VPN-сервера (VPN_BACKEND=fake).
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"vpn-bot/internal/vpn/fakevpn/fakevpntest"
+)
+
+func main() {
+	addr := flag.String("addr", ":8091", "адрес, на котором слушает заглушка")
+	token := flag.String("token", "test-token", "токен панели, как в FAKE_VPN_TOKEN")
+	flag.Parse()
+
+	server := fakevpntest.NewServer(*token)
+	log.Printf("🧪 Заглушка VPN-панели на %s, API: http://localhost%s/api", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
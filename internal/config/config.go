@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,9 +17,113 @@ type Config struct {
 	YooKassaSecret   string
 	Port             int
 
+	// YooKassaManualCapture включает двухстадийные платежи: списание
+	// подтверждает администратор командой /capture.
+	YooKassaManualCapture bool
+	// KeyReservationTTL — сколько ключ удерживается за неоплаченным платежом.
+	KeyReservationTTL time.Duration
+
+	// YooKassaReceipts — прикладывать к платежам ЮKassa чеки 54-ФЗ с кодом
+	// НДС YooKassaVATCode и системой налогообложения YooKassaTaxSystemCode
+	// (0 — не передавать).
+	YooKassaReceipts      bool
+	YooKassaVATCode       int
+	YooKassaTaxSystemCode int
+
+	// YooKassaAllowedIPs — адреса и подсети, с которых принимаются вебхуки;
+	// значение yookassa подставляет адреса ЮKassa. По умолчанию список пуст
+	// и проверка отключена: за прокси без TrustForwardedFor бот видел бы
+	// адрес прокси и отклонял все вебхуки.
+	YooKassaAllowedIPs []string
+	// TrustForwardedFor — бот стоит за обратным прокси, и адрес отправителя
+	// вебхука берётся из X-Forwarded-For.
+	TrustForwardedFor bool
+
+	// PaymentReturnURL — куда провайдер возвращает пользователя после оплаты;
+	// {payment} заменяется токеном платежа. Пустой — обратно в бота по
+	// ссылке t.me/<бот>?start=paid_<токен>.
+	PaymentReturnURL string
+	// PurchaseDescription и RenewalDescription — шаблоны описания платежа
+	// с подстановками {plan}, {months} и {user}.
+	PurchaseDescription string
+	RenewalDescription  string
+
+	// PaymentProvider — провайдер по умолчанию, PlanProviders — провайдеры
+	// отдельных тарифов по их ID.
+	PaymentProvider string
+	PlanProviders   map[int]string
+	// TelegramPaymentsToken — токен платёжной системы из @BotFather для
+	// встроенных платежей Telegram. Пустой токен отключает этот провайдер.
+	TelegramPaymentsToken string
+	// CryptoPayToken — токен приложения Crypto Pay из @CryptoBot. Пустой
+	// токен отключает оплату криптовалютой.
+	CryptoPayToken string
+	// CryptoPayAPIURL — адрес API: боевой, тестовой сети
+	// (https://testnet-pay.crypt.bot/api) или локальной заглушки.
+	CryptoPayAPIURL string
+	// CryptoPayAssets — монеты, которыми можно оплатить счёт.
+	CryptoPayAssets []string
+
+	// VPNBackend — откуда берутся ключи: pool — из пула, который пополняет
+	// администратор, outline — с Outline Server, xui — с панели 3x-ui,
+	// wireguard — пиры WireGuard, fake — с поддельной VPN-панели по
+	// FakeVPNAPIURL.
+	VPNBackend    string
+	FakeVPNAPIURL string
+	FakeVPNToken  string
+	// OutlineAPIURL и OutlineCertSHA256 — apiUrl и certSha256 из настроек
+	// Outline Manager. OutlineDataLimit — лимит трафика ключа, 0 — без лимита.
+	OutlineAPIURL     string
+	OutlineCertSHA256 string
+	OutlineDataLimit  int64
+	// XUI* — панель 3x-ui: адрес с webBasePath, учётная запись, inbound
+	// VLESS/VMess, адрес сервера в ссылках, flow и лимит трафика клиента.
+	XUIURL          string
+	XUIUsername     string
+	XUIPassword     string
+	XUIInboundID    int
+	XUIHost         string
+	XUIFlow         string
+	XUITrafficLimit int64
+	// WireGuard* — подсеть клиентов и сервер в их конфигурации. Пиры
+	// применяются командами WireGuardAddCommand и WireGuardRemoveCommand,
+	// а если они не заданы — файлом WireGuardPeersFile с последующей
+	// WireGuardReloadCommand.
+	WireGuardSubnet          string
+	WireGuardServerPublicKey string
+	WireGuardEndpoint        string
+	WireGuardDNS             string
+	WireGuardAllowedIPs      string
+	WireGuardKeepalive       int
+	WireGuardPeersFile       string
+	WireGuardReloadCommand   string
+	WireGuardAddCommand      string
+	WireGuardRemoveCommand   string
+
 	AdminIDs []int64
+
+	ExpiryCheckInterval time.Duration
+	// KeyGracePeriod — через сколько после истечения ключ возвращается в пул.
+	// Ноль отключает возврат.
+	KeyGracePeriod time.Duration
+	// AutoRenewBefore — за сколько до истечения списывать автопродление.
+	// Ноль отключает автопродление.
+	AutoRenewBefore time.Duration
+
+	// PaymentReconcileInterval — как часто сверять с провайдерами платежи,
+	// которые дольше PaymentReconcileAfter остаются незавершёнными. Ноль
+	// отключает сверку.
+	PaymentReconcileInterval time.Duration
+	PaymentReconcileAfter    time.Duration
+
+	// OutboxPollInterval — как часто воркер outbox проверяет отложенные уведомления.
+	OutboxPollInterval time.Duration
 }
 
+// yooKassaIPs — адреса, с которых ЮKassa отправляет уведомления; включаются
+// значением YOOKASSA_ALLOWED_IPS=yookassa.
+const yooKassaIPs = "185.71.76.0/27,185.71.77.0/27,77.75.153.0/25,77.75.156.11,77.75.156.35,77.75.154.128/25,2a02:5180::/32"
+
 func LoadConfig() *Config {
 	_ = godotenv.Load()
 
@@ -37,6 +142,64 @@ func LoadConfig() *Config {
 		YooKassaSecret:   getEnv("YOOKASSA_SECRET_KEY", ""),
 		Port:             port,
 		AdminIDs:         adminIDs,
+
+		YooKassaManualCapture: getEnvBool("YOOKASSA_MANUAL_CAPTURE", false),
+		KeyReservationTTL:     time.Duration(getEnvInt("KEY_RESERVATION_TTL_MINUTES", 60)) * time.Minute,
+
+		YooKassaReceipts:      getEnvBool("YOOKASSA_RECEIPTS", false),
+		YooKassaVATCode:       getEnvInt("YOOKASSA_VAT_CODE", 1),
+		YooKassaTaxSystemCode: getEnvInt("YOOKASSA_TAX_SYSTEM_CODE", 0),
+
+		YooKassaAllowedIPs: parseAllowedIPs(getEnv("YOOKASSA_ALLOWED_IPS", "")),
+		TrustForwardedFor:  getEnvBool("TRUST_FORWARDED_FOR", false),
+
+		PaymentReturnURL:    getEnv("PAYMENT_RETURN_URL", ""),
+		PurchaseDescription: getEnv("PURCHASE_DESCRIPTION", "Покупка VPN: {plan}"),
+		RenewalDescription:  getEnv("RENEWAL_DESCRIPTION", "Продление VPN: {plan}"),
+
+		PaymentProvider:       getEnv("PAYMENT_PROVIDER", "yookassa"),
+		PlanProviders:         parsePlanProviders(getEnv("PLAN_PROVIDERS", "")),
+		TelegramPaymentsToken: getEnv("TELEGRAM_PAYMENTS_TOKEN", ""),
+
+		CryptoPayToken:  getEnv("CRYPTO_PAY_TOKEN", ""),
+		CryptoPayAPIURL: getEnv("CRYPTO_PAY_API_URL", "https://pay.crypt.bot/api"),
+		CryptoPayAssets: parseList(getEnv("CRYPTO_PAY_ASSETS", "USDT,TON,BTC")),
+
+		VPNBackend:    getEnv("VPN_BACKEND", "pool"),
+		FakeVPNAPIURL: getEnv("FAKE_VPN_API_URL", "http://localhost:8091/api"),
+		FakeVPNToken:  getEnv("FAKE_VPN_TOKEN", "test-token"),
+
+		OutlineAPIURL:     getEnv("OUTLINE_API_URL", ""),
+		OutlineCertSHA256: getEnv("OUTLINE_CERT_SHA256", ""),
+		OutlineDataLimit:  int64(getEnvInt("OUTLINE_DATA_LIMIT_GB", 0)) << 30,
+
+		XUIURL:          getEnv("XUI_URL", ""),
+		XUIUsername:     getEnv("XUI_USERNAME", ""),
+		XUIPassword:     getEnv("XUI_PASSWORD", ""),
+		XUIInboundID:    getEnvInt("XUI_INBOUND_ID", 0),
+		XUIHost:         getEnv("XUI_HOST", ""),
+		XUIFlow:         getEnv("XUI_FLOW", "xtls-rprx-vision"),
+		XUITrafficLimit: int64(getEnvInt("XUI_TRAFFIC_LIMIT_GB", 0)) << 30,
+
+		WireGuardSubnet:          getEnv("WIREGUARD_SUBNET", "10.8.0.0/24"),
+		WireGuardServerPublicKey: getEnv("WIREGUARD_SERVER_PUBLIC_KEY", ""),
+		WireGuardEndpoint:        getEnv("WIREGUARD_ENDPOINT", ""),
+		WireGuardDNS:             getEnv("WIREGUARD_DNS", "1.1.1.1"),
+		WireGuardAllowedIPs:      getEnv("WIREGUARD_ALLOWED_IPS", "0.0.0.0/0, ::/0"),
+		WireGuardKeepalive:       getEnvInt("WIREGUARD_KEEPALIVE_SECONDS", 25),
+		WireGuardPeersFile:       getEnv("WIREGUARD_PEERS_FILE", "/etc/wireguard/peers.conf"),
+		WireGuardReloadCommand:   getEnv("WIREGUARD_RELOAD_COMMAND", ""),
+		WireGuardAddCommand:      getEnv("WIREGUARD_ADD_COMMAND", ""),
+		WireGuardRemoveCommand:   getEnv("WIREGUARD_REMOVE_COMMAND", ""),
+
+		ExpiryCheckInterval: time.Duration(getEnvInt("EXPIRY_CHECK_INTERVAL_MINUTES", 10)) * time.Minute,
+		KeyGracePeriod:      time.Duration(getEnvInt("KEY_GRACE_PERIOD_HOURS", 0)) * time.Hour,
+		AutoRenewBefore:     time.Duration(getEnvInt("AUTO_RENEW_DAYS_BEFORE", 3)) * 24 * time.Hour,
+
+		PaymentReconcileInterval: time.Duration(getEnvInt("PAYMENT_RECONCILE_INTERVAL_MINUTES", 5)) * time.Minute,
+		PaymentReconcileAfter:    time.Duration(getEnvInt("PAYMENT_RECONCILE_AFTER_MINUTES", 10)) * time.Minute,
+
+		OutboxPollInterval: time.Duration(getEnvInt("OUTBOX_POLL_INTERVAL_SECONDS", 5)) * time.Second,
 	}
 }
 
@@ -59,9 +222,75 @@ func parseAdminIDs(s string) []int64 {
 	return result
 }
 
+// parsePlanProviders разбирает список вида "1:yookassa,3:telegram".
+func parsePlanProviders(s string) map[int]string {
+	result := make(map[int]string)
+	for _, entry := range parseList(s) {
+		planID, provider, ok := strings.Cut(entry, ":")
+		if !ok {
+			log.Fatalf("Ошибка чтения PLAN_PROVIDERS: ожидается ID_тарифа:провайдер, получено %q", entry)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(planID))
+		if err != nil {
+			log.Fatalf("Ошибка чтения PLAN_PROVIDERS: %v", err)
+		}
+		result[id] = strings.TrimSpace(provider)
+	}
+	return result
+}
+
+func parseList(s string) []string {
+	var result []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// parseAllowedIPs разбирает YOOKASSA_ALLOWED_IPS, подставляя вместо
+// yookassa опубликованные адреса ЮKassa.
+func parseAllowedIPs(s string) []string {
+	var result []string
+	for _, entry := range parseList(s) {
+		if strings.EqualFold(entry, "yookassa") {
+			result = append(result, parseList(yooKassaIPs)...)
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
 func getEnv(key, defaultVal string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val
 	}
 	return defaultVal
 }
+
+func getEnvInt(key string, defaultVal int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		log.Fatalf("Ошибка чтения %s: %v", key, err)
+	}
+	return n
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok || val == "" {
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Fatalf("Ошибка чтения %s: %v", key, err)
+	}
+	return b
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+)
+
+// Notification — исходящее сообщение в outbox, ожидающее доставки в Telegram.
+// Если задан DocumentName, отправляется файл Document, а если задан Photo —
+// картинка PNG; Text тогда — подпись к ним.
+type Notification struct {
+	ID            int64
+	TelegramID    int64
+	Text          string
+	ParseMode     string
+	DocumentName  string
+	Document      []byte
+	Photo         []byte
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
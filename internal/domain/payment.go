@@ -2,11 +2,38 @@ package domain
 
 import "time"
 
+const (
+	PaymentPurposePurchase = "purchase"
+	PaymentPurposeRenewal  = "renewal"
+)
+
+// Статусы платежа совпадают со статусами ЮKassa, плюс refunded после возврата.
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusWaitingForCapture = "waiting_for_capture"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusCanceled          = "canceled"
+	PaymentStatusRefunded          = "refunded"
+)
+
 type Payment struct {
 	ID        int
 	UserID    int
 	Amount    float64
+	Currency  string
 	Status    string
+	Provider  string
 	PaymentID string
-	CreatedAt time.Time
+	Purpose   string
+	VPNKeyID  *int
+	PlanID    *int
+	// TelegramChargeID — telegram_payment_charge_id оплаты через Telegram,
+	// нужен для возврата звёзд.
+	TelegramChargeID *string
+	// Recurring — автопродление, списанное с сохранённого способа оплаты.
+	Recurring bool
+	// ReturnToken — идентификатор платежа в ссылке возврата в бота
+	// (/start paid_<token>); известен до создания платежа у провайдера.
+	ReturnToken *string
+	CreatedAt   time.Time
 }
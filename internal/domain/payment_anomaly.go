@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// PaymentAnomalyAmountMismatch — оплачена не та сумма или не в той валюте.
+const PaymentAnomalyAmountMismatch = "amount_mismatch"
+
+// PaymentAnomaly — расхождение между платежом в платёжной системе и
+// сохранённым у нас. Ключ по такому платежу не выдаётся, разбирает администратор.
+type PaymentAnomaly struct {
+	ID               int
+	PaymentID        int
+	Kind             string
+	ExpectedAmount   float64
+	ExpectedCurrency string
+	// ActualAmount хранится строкой как пришла от платёжной системы,
+	// чтобы сохранить даже значение, которое не разбирается как число.
+	ActualAmount   string
+	ActualCurrency string
+	CreatedAt      time.Time
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// PendingDelivery — оплаченная покупка, ожидающая появления свободного ключа.
+type PendingDelivery struct {
+	ID          int
+	UserID      int
+	PaymentID   int
+	VPNKeyID    *int
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// CurrencyStars — Telegram Stars, валюта цифровых товаров в Telegram.
+const CurrencyStars = "XTR"
+
+type Plan struct {
+	ID       int
+	Name     string
+	Months   int
+	Price    float64
+	Currency string
+	// StarsPrice — цена в Telegram Stars; ноль, если за звёзды тариф не продаётся.
+	StarsPrice int
+	IsActive   bool
+}
+
+// PriceIn возвращает цену тарифа в указанной валюте.
+func (p *Plan) PriceIn(currency string) (float64, error) {
+	switch {
+	case currency == p.Currency:
+		return p.Price, nil
+	case currency == CurrencyStars && p.StarsPrice > 0:
+		return float64(p.StarsPrice), nil
+	}
+	return 0, fmt.Errorf("тариф %q нельзя оплатить в %s", p.Name, currency)
+}
+
+// ExpiresAt возвращает дату окончания подписки по тарифу, начиная с from.
+func (p *Plan) ExpiresAt(from time.Time) time.Time {
+	return from.AddDate(0, p.Months, 0)
+}
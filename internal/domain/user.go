@@ -8,4 +8,13 @@ type User struct {
 	Username   string
 	ChatLink   string
 	CreatedAt  time.Time
+	// AutoRenew — пользователь включил автопродление. PaymentMethodID —
+	// сохранённый у провайдера PaymentMethodProvider способ оплаты; пуст,
+	// пока пользователь не оплатил с сохранением.
+	AutoRenew             bool
+	PaymentMethodID       string
+	PaymentMethodProvider string
+	// Email и Phone — контакт для чеков 54-ФЗ; достаточно одного из них.
+	Email string
+	Phone string
 }
@@ -1,6 +1,19 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VPNKeyBackendPool — ключ из пула, загруженного администратором.
+const VPNKeyBackendPool = "pool"
+
+const (
+	VPNKeyStatusActive  = "active"
+	VPNKeyStatusExpired = "expired"
+	VPNKeyStatusRevoked = "revoked"
+)
 
 type VPNKey struct {
 	ID        int
@@ -8,4 +21,51 @@ type VPNKey struct {
 	IsUsed    bool
 	UserID    *int
 	ExpiresAt *time.Time
+	Status    string
+	// Backend — откуда ключ: из пула или с VPN-сервера с этим именем.
+	// ClientID — идентификатор клиента на сервере, у ключей из пула пуст.
+	Backend  string
+	ClientID string
+}
+
+// VPNKeyOwner — назначенный ключ вместе с Telegram ID его владельца.
+type VPNKeyOwner struct {
+	VPNKey
+	TelegramID int64
+}
+
+// AutoRenewal — ключ, который пора продлить списанием с сохранённого
+// способа оплаты по тарифу последней оплаты.
+type AutoRenewal struct {
+	VPNKeyOwner
+	PlanID          int
+	PaymentMethodID string
+	Provider        string
+}
+
+// IsConfig — ключ является файлом конфигурации WireGuard, а не ссылкой:
+// пользователю он отправляется документом.
+func (k VPNKey) IsConfig() bool {
+	return strings.HasPrefix(k.Key, "[Interface]")
+}
+
+// Label — ключ в тексте сообщений. Конфигурация WireGuard длинная и
+// содержит приватный ключ, поэтому вместо неё показывается адрес клиента.
+func (k VPNKey) Label() string {
+	if !k.IsConfig() {
+		return k.Key
+	}
+	for _, line := range strings.Split(k.Key, "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(name) == "Address" {
+			return "WireGuard " + strings.TrimSpace(value)
+		}
+	}
+	return fmt.Sprintf("WireGuard #%d", k.ID)
+}
+
+// FileName — имя файла конфигурации. WireGuard берёт из него имя туннеля,
+// а имя интерфейса в Linux не длиннее 15 символов.
+func (k VPNKey) FileName() string {
+	return fmt.Sprintf("vpn%d.conf", k.ID)
 }
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+const (
+	WebhookEventStatusReceived  = "received"
+	WebhookEventStatusProcessed = "processed"
+	WebhookEventStatusFailed    = "failed"
+)
+
+// WebhookEvent — сохранённое уведомление платёжного провайдера. Тройка
+// Provider+Event+ObjectID уникальна, поэтому повторные доставки одного
+// события не обрабатываются дважды. Payload — событие в формате payment.Event.
+type WebhookEvent struct {
+	ID          int64
+	Provider    string
+	Event       string
+	ObjectID    string
+	Payload     []byte
+	Status      string
+	Attempts    int
+	LastError   string
+	ReceivedAt  time.Time
+	ProcessedAt *time.Time
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// WireGuardPeer — пир на интерфейсе WireGuard. Address — адрес клиента в
+// подсети без маски. Выключенный пир сохраняет адрес, но снят с интерфейса.
+type WireGuardPeer struct {
+	ID           int
+	PublicKey    string
+	PresharedKey string
+	Address      string
+	Name         string
+	Enabled      bool
+	CreatedAt    time.Time
+}
@@ -0,0 +1,252 @@
+// Package cryptopay — оплата криптовалютой через Crypto Pay API (@CryptoBot).
+// Счёт выставляется в рублях, а пользователь платит любой из разрешённых
+// монет по курсу Crypto Pay.
+package cryptopay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"vpn-bot/internal/payment"
+)
+
+const (
+	Name = "cryptopay"
+
+	// SignatureHeader — заголовок с подписью вебхука.
+	SignatureHeader = "Crypto-Pay-Api-Signature"
+	tokenHeader     = "Crypto-Pay-API-Token"
+)
+
+// Статусы счёта Crypto Pay.
+const (
+	InvoiceStatusActive  = "active"
+	InvoiceStatusPaid    = "paid"
+	InvoiceStatusExpired = "expired"
+)
+
+// invoiceTTL — сколько счёт остаётся действительным.
+const invoiceTTL = time.Hour
+
+// Invoice — счёт Crypto Pay.
+type Invoice struct {
+	InvoiceID      int64  `json:"invoice_id"`
+	Status         string `json:"status"`
+	CurrencyType   string `json:"currency_type"`
+	Fiat           string `json:"fiat,omitempty"`
+	Amount         string `json:"amount"`
+	AcceptedAssets string `json:"accepted_assets,omitempty"`
+	PaidAsset      string `json:"paid_asset,omitempty"`
+	PaidAmount     string `json:"paid_amount,omitempty"`
+	Description    string `json:"description,omitempty"`
+	Payload        string `json:"payload,omitempty"`
+	BotInvoiceURL  string `json:"bot_invoice_url"`
+}
+
+// Update — тело вебхука Crypto Pay.
+type Update struct {
+	UpdateID    int64   `json:"update_id"`
+	UpdateType  string  `json:"update_type"`
+	RequestDate string  `json:"request_date"`
+	Payload     Invoice `json:"payload"`
+}
+
+type response struct {
+	OK     bool            `json:"ok"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int    `json:"code"`
+		Name string `json:"name"`
+	} `json:"error"`
+}
+
+type provider struct {
+	apiURL string
+	token  string
+	assets string
+	client *http.Client
+}
+
+// NewProvider создаёт провайдера. assets — монеты, которыми можно оплатить
+// счёт; пустой список разрешает все.
+func NewProvider(apiURL, token string, assets []string) payment.Provider {
+	return &provider{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+		assets: strings.Join(assets, ","),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *provider) Name() string {
+	return Name
+}
+
+func (p *provider) CreatePayment(req payment.CreateRequest) (*payment.Checkout, error) {
+	params := url.Values{}
+	params.Set("currency_type", "fiat")
+	params.Set("fiat", req.Amount.Currency)
+	params.Set("amount", req.Amount.Value)
+	params.Set("description", req.Description)
+	params.Set("expires_in", strconv.Itoa(int(invoiceTTL.Seconds())))
+	if p.assets != "" {
+		params.Set("accepted_assets", p.assets)
+	}
+	if req.ReturnURL != "" {
+		// Кнопка «Вернуться» на странице оплаченного счёта.
+		params.Set("paid_btn_name", "callback")
+		params.Set("paid_btn_url", req.ReturnURL)
+	}
+
+	var invoice Invoice
+	if err := p.call("createInvoice", params, &invoice); err != nil {
+		return nil, err
+	}
+	info := invoiceInfo(&invoice)
+	return &payment.Checkout{
+		PaymentID:       info.PaymentID,
+		Status:          info.Status,
+		ConfirmationURL: invoice.BotInvoiceURL,
+	}, nil
+}
+
+// FetchPayment запрашивает счёт: так можно узнать об оплате, не дожидаясь вебхука.
+func (p *provider) FetchPayment(paymentID string) (*payment.Info, error) {
+	params := url.Values{}
+	params.Set("invoice_ids", paymentID)
+
+	var result struct {
+		Items []Invoice `json:"items"`
+	}
+	if err := p.call("getInvoices", params, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Items) == 0 {
+		return nil, fmt.Errorf("счёт %s не найден в Crypto Pay", paymentID)
+	}
+	return invoiceInfo(&result.Items[0]), nil
+}
+
+func (p *provider) CapturePayment(paymentID string) (*payment.Info, error) {
+	return nil, payment.ErrNotSupported
+}
+
+func (p *provider) CancelPayment(paymentID string) (*payment.Info, error) {
+	return nil, payment.ErrNotSupported
+}
+
+// Refund недоступен: Crypto Pay не возвращает оплату счёта.
+func (p *provider) Refund(req payment.RefundRequest) (*payment.Refund, error) {
+	return nil, payment.ErrNotSupported
+}
+
+// ParseWebhook проверяет подпись вебхука и переводит оплату счёта в событие.
+func (p *provider) ParseWebhook(header http.Header, body []byte) (*payment.Event, error) {
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Signature(p.token, body))) {
+		return nil, payment.ErrInvalidSignature
+	}
+
+	var update Update
+	if err := json.Unmarshal(body, &update); err != nil {
+		return nil, fmt.Errorf("%w: %v", payment.ErrInvalidEvent, err)
+	}
+	if update.UpdateType != "invoice_paid" {
+		return nil, fmt.Errorf("%w: неизвестный тип обновления %q", payment.ErrInvalidEvent, update.UpdateType)
+	}
+
+	info := invoiceInfo(&update.Payload)
+	confirmed, err := p.FetchPayment(info.PaymentID)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось проверить счёт %s в Crypto Pay: %w", info.PaymentID, err)
+	}
+	if confirmed.Status != "succeeded" || confirmed.Amount != info.Amount {
+		return nil, fmt.Errorf("%w: счёт %s в Crypto Pay в статусе %s на %s %s", payment.ErrEventNotConfirmed,
+			info.PaymentID, confirmed.Status, confirmed.Amount.Value, confirmed.Amount.Currency)
+	}
+
+	return &payment.Event{
+		Name:      payment.EventPaymentSucceeded,
+		ObjectID:  info.PaymentID,
+		PaymentID: info.PaymentID,
+		Amount:    info.Amount,
+	}, nil
+}
+
+// Signature — подпись тела вебхука: HMAC-SHA256 с ключом SHA256(token) в hex.
+func Signature(token string, body []byte) string {
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// invoiceInfo переводит счёт в платёж: оплаченный счёт — succeeded,
+// просроченный — canceled.
+func invoiceInfo(invoice *Invoice) *payment.Info {
+	info := &payment.Info{
+		PaymentID: strconv.FormatInt(invoice.InvoiceID, 10),
+		Status:    "pending",
+		Amount:    payment.Amount{Value: normalizeAmount(invoice.Amount), Currency: invoice.Fiat},
+	}
+	switch invoice.Status {
+	case InvoiceStatusPaid:
+		info.Status = "succeeded"
+	case InvoiceStatusExpired:
+		info.Status = "canceled"
+		info.CancellationParty = Name
+		info.CancellationReason = "expired_on_confirmation"
+	}
+	return info
+}
+
+// normalizeAmount приводит сумму к двум знакам после точки: Crypto Pay
+// может вернуть "299" вместо "299.00".
+func normalizeAmount(value string) string {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// call выполняет метод Crypto Pay API и декодирует result в out.
+func (p *provider) call(method string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, p.apiURL+"/"+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tokenHeader, p.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("Ошибка от Crypto Pay: %d %s", resp.StatusCode, string(body))
+	}
+	if !r.OK {
+		if r.Error != nil {
+			return fmt.Errorf("Ошибка от Crypto Pay: %d %s", r.Error.Code, r.Error.Name)
+		}
+		return fmt.Errorf("Ошибка от Crypto Pay: %d %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(r.Result, out)
+}
@@ -0,0 +1,191 @@
+package cryptopay_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/payment/cryptopay"
+	"vpn-bot/internal/payment/cryptopay/cryptopaytest"
+)
+
+const token = "12345:AAtest"
+
+// webhook — вебхук, который поддельный API отправил боту.
+type webhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newProvider(t *testing.T) (payment.Provider, *cryptopaytest.Server, <-chan webhook) {
+	t.Helper()
+	webhooks := make(chan webhook, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		webhooks <- webhook{header: r.Header, body: body}
+	}))
+	t.Cleanup(receiver.Close)
+
+	srv := cryptopaytest.NewServer(token, receiver.URL)
+	ts := srv.Start()
+	t.Cleanup(ts.Close)
+	return cryptopay.NewProvider(ts.URL+"/api", token, []string{"USDT", "TON"}), srv, webhooks
+}
+
+func createInvoice(t *testing.T, p payment.Provider) (*payment.Checkout, int64) {
+	t.Helper()
+	checkout, err := p.CreatePayment(payment.CreateRequest{
+		Amount:      payment.Amount{Value: "299", Currency: "RUB"},
+		Description: "VPN: 1 месяц",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	id, err := strconv.ParseInt(checkout.PaymentID, 10, 64)
+	if err != nil {
+		t.Fatalf("ID счёта %q не число: %v", checkout.PaymentID, err)
+	}
+	return checkout, id
+}
+
+// signed подписывает тело вебхука так же, как Crypto Pay.
+func signed(t *testing.T, update cryptopay.Update, signToken string) (http.Header, []byte) {
+	t.Helper()
+	body, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set(cryptopay.SignatureHeader, cryptopay.Signature(signToken, body))
+	return header, body
+}
+
+func TestPurchaseFlow(t *testing.T) {
+	p, srv, webhooks := newProvider(t)
+
+	checkout, id := createInvoice(t, p)
+	if checkout.Status != "pending" || checkout.ConfirmationURL == "" {
+		t.Errorf("счёт в статусе %q со ссылкой %q, ожидался pending со ссылкой", checkout.Status, checkout.ConfirmationURL)
+	}
+	invoice, _ := srv.Invoice(id)
+	if invoice.Fiat != "RUB" || invoice.AcceptedAssets != "USDT,TON" {
+		t.Errorf("счёт выставлен в %q с монетами %q", invoice.Fiat, invoice.AcceptedAssets)
+	}
+
+	info, err := p.FetchPayment(checkout.PaymentID)
+	if err != nil {
+		t.Fatalf("FetchPayment: %v", err)
+	}
+	if info.Status != "pending" {
+		t.Errorf("неоплаченный счёт в статусе %q", info.Status)
+	}
+
+	if err := srv.Pay(id); err != nil {
+		t.Fatalf("Pay: %v", err)
+	}
+	w := <-webhooks
+
+	event, err := p.ParseWebhook(w.header, w.body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	want := payment.Event{
+		Name:      payment.EventPaymentSucceeded,
+		ObjectID:  checkout.PaymentID,
+		PaymentID: checkout.PaymentID,
+		Amount:    payment.Amount{Value: "299.00", Currency: "RUB"},
+	}
+	if *event != want {
+		t.Errorf("событие %+v, ожидалось %+v", *event, want)
+	}
+
+	info, err = p.FetchPayment(checkout.PaymentID)
+	if err != nil {
+		t.Fatalf("FetchPayment: %v", err)
+	}
+	if info.Status != "succeeded" || info.Amount != want.Amount {
+		t.Errorf("оплаченный счёт в статусе %q на %+v", info.Status, info.Amount)
+	}
+}
+
+func TestExpiredInvoice(t *testing.T) {
+	p, srv, _ := newProvider(t)
+	checkout, id := createInvoice(t, p)
+
+	if err := srv.Expire(id); err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	info, err := p.FetchPayment(checkout.PaymentID)
+	if err != nil {
+		t.Fatalf("FetchPayment: %v", err)
+	}
+	if info.Status != "canceled" || info.CancellationParty != cryptopay.Name {
+		t.Errorf("просроченный счёт в статусе %q, отменён %q", info.Status, info.CancellationParty)
+	}
+}
+
+func TestWebhookBadSignature(t *testing.T) {
+	p, srv, webhooks := newProvider(t)
+	_, id := createInvoice(t, p)
+	if err := srv.Pay(id); err != nil {
+		t.Fatalf("Pay: %v", err)
+	}
+	w := <-webhooks
+
+	w.header.Set(cryptopay.SignatureHeader, cryptopay.Signature("чужой токен", w.body))
+	if _, err := p.ParseWebhook(w.header, w.body); !errors.Is(err, payment.ErrInvalidSignature) {
+		t.Errorf("чужая подпись: %v, ожидалась ErrInvalidSignature", err)
+	}
+
+	w.header.Del(cryptopay.SignatureHeader)
+	if _, err := p.ParseWebhook(w.header, w.body); !errors.Is(err, payment.ErrInvalidSignature) {
+		t.Errorf("без подписи: %v, ожидалась ErrInvalidSignature", err)
+	}
+}
+
+func TestWebhookAmountMismatch(t *testing.T) {
+	p, srv, webhooks := newProvider(t)
+	_, id := createInvoice(t, p)
+	if err := srv.Pay(id); err != nil {
+		t.Fatalf("Pay: %v", err)
+	}
+	var update cryptopay.Update
+	if err := json.Unmarshal((<-webhooks).body, &update); err != nil {
+		t.Fatal(err)
+	}
+
+	// Подпись верна, но сумма в теле не совпадает со счётом в API.
+	update.Payload.Amount = "2990"
+	header, body := signed(t, update, token)
+	if _, err := p.ParseWebhook(header, body); !errors.Is(err, payment.ErrEventNotConfirmed) {
+		t.Errorf("другая сумма: %v, ожидалась ErrEventNotConfirmed", err)
+	}
+}
+
+func TestWebhookForUnpaidInvoice(t *testing.T) {
+	p, srv, _ := newProvider(t)
+	_, id := createInvoice(t, p)
+
+	invoice, _ := srv.Invoice(id)
+	invoice.Status = cryptopay.InvoiceStatusPaid
+	header, body := signed(t, cryptopay.Update{UpdateID: 1, UpdateType: "invoice_paid", Payload: invoice}, token)
+	if _, err := p.ParseWebhook(header, body); !errors.Is(err, payment.ErrEventNotConfirmed) {
+		t.Errorf("неоплаченный в API счёт: %v, ожидалась ErrEventNotConfirmed", err)
+	}
+}
+
+func TestWrongToken(t *testing.T) {
+	srv := cryptopaytest.NewServer(token, "")
+	ts := srv.Start()
+	defer ts.Close()
+
+	p := cryptopay.NewProvider(ts.URL+"/api", "чужой токен", nil)
+	if _, err := p.CreatePayment(payment.CreateRequest{Amount: payment.Amount{Value: "299.00", Currency: "RUB"}}); err == nil {
+		t.Fatal("счёт выставлен с чужим токеном")
+	}
+}
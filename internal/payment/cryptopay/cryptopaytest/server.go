@@ -0,0 +1,224 @@
+// Package cryptopaytest — поддельный Crypto Pay API для проверки покупки
+// без сети: выставляет счета, отдаёт их статус и по команде «оплачивает»
+// счёт, отправляя подписанный вебхук.
+package cryptopaytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vpn-bot/internal/payment/cryptopay"
+)
+
+// Server — поддельный API. Методы Crypto Pay доступны по /api/<метод>,
+// управление счетами — по /fake/pay?invoice_id=N и /fake/expire?invoice_id=N.
+type Server struct {
+	// Token — токен приложения: им проверяются запросы и подписываются вебхуки.
+	Token string
+	// WebhookURL — куда отправлять вебхук об оплате; пустой — не отправлять.
+	WebhookURL string
+
+	mu       sync.Mutex
+	invoices map[int64]*cryptopay.Invoice
+	nextID   int64
+	updateID int64
+	client   *http.Client
+}
+
+func NewServer(token, webhookURL string) *Server {
+	return &Server{
+		Token:      token,
+		WebhookURL: webhookURL,
+		invoices:   make(map[int64]*cryptopay.Invoice),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Start запускает сервер на свободном локальном порту; адрес API —
+// URL сервера + "/api".
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/createInvoice":
+		s.handleAPI(w, r, s.createInvoice)
+	case "/api/getInvoices":
+		s.handleAPI(w, r, s.getInvoices)
+	case "/fake/pay":
+		s.handleFake(w, r, s.Pay)
+	case "/fake/expire":
+		s.handleFake(w, r, s.Expire)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Invoice возвращает копию счёта.
+func (s *Server) Invoice(id int64) (cryptopay.Invoice, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invoice, ok := s.invoices[id]
+	if !ok {
+		return cryptopay.Invoice{}, false
+	}
+	return *invoice, true
+}
+
+// Pay отмечает счёт оплаченным и отправляет вебхук invoice_paid.
+func (s *Server) Pay(id int64) error {
+	s.mu.Lock()
+	invoice, ok := s.invoices[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("счёт %d не найден", id)
+	}
+	if invoice.Status != cryptopay.InvoiceStatusActive {
+		s.mu.Unlock()
+		return fmt.Errorf("счёт %d в статусе %s", id, invoice.Status)
+	}
+	invoice.Status = cryptopay.InvoiceStatusPaid
+	invoice.PaidAsset = "USDT"
+	invoice.PaidAmount = invoice.Amount
+	s.updateID++
+	update := cryptopay.Update{
+		UpdateID:    s.updateID,
+		UpdateType:  "invoice_paid",
+		RequestDate: time.Now().UTC().Format(time.RFC3339),
+		Payload:     *invoice,
+	}
+	s.mu.Unlock()
+
+	if s.WebhookURL == "" {
+		return nil
+	}
+	return s.sendWebhook(update)
+}
+
+// Expire отмечает неоплаченный счёт просроченным.
+func (s *Server) Expire(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invoice, ok := s.invoices[id]
+	if !ok {
+		return fmt.Errorf("счёт %d не найден", id)
+	}
+	if invoice.Status != cryptopay.InvoiceStatusActive {
+		return fmt.Errorf("счёт %d в статусе %s", id, invoice.Status)
+	}
+	invoice.Status = cryptopay.InvoiceStatusExpired
+	return nil
+}
+
+func (s *Server) sendWebhook(update cryptopay.Update) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(cryptopay.SignatureHeader, cryptopay.Signature(s.Token, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("вебхук отклонён: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Server) createInvoice(r *http.Request) (interface{}, error) {
+	if r.FormValue("currency_type") != "fiat" {
+		return nil, fmt.Errorf("CURRENCY_TYPE_INVALID")
+	}
+	if _, err := strconv.ParseFloat(r.FormValue("amount"), 64); err != nil {
+		return nil, fmt.Errorf("AMOUNT_INVALID")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	invoice := &cryptopay.Invoice{
+		InvoiceID:      s.nextID,
+		Status:         cryptopay.InvoiceStatusActive,
+		CurrencyType:   "fiat",
+		Fiat:           r.FormValue("fiat"),
+		Amount:         r.FormValue("amount"),
+		AcceptedAssets: r.FormValue("accepted_assets"),
+		Description:    r.FormValue("description"),
+		Payload:        r.FormValue("payload"),
+		BotInvoiceURL:  fmt.Sprintf("http://%s/fake/pay?invoice_id=%d", r.Host, s.nextID),
+	}
+	s.invoices[invoice.InvoiceID] = invoice
+	return invoice, nil
+}
+
+func (s *Server) getInvoices(r *http.Request) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := []cryptopay.Invoice{}
+	for _, raw := range strings.Split(r.FormValue("invoice_ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			continue
+		}
+		if invoice, ok := s.invoices[id]; ok {
+			items = append(items, *invoice)
+		}
+	}
+	return map[string]interface{}{"items": items}, nil
+}
+
+// handleAPI проверяет токен и заворачивает результат метода в ответ
+// формата Crypto Pay.
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request, method func(*http.Request) (interface{}, error)) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Header.Get("Crypto-Pay-API-Token") != s.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED")
+		return
+	}
+
+	result, err := method(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (s *Server) handleFake(w http.ResponseWriter, r *http.Request, action func(int64) error) {
+	id, err := strconv.ParseInt(r.FormValue("invoice_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invoice_id required", http.StatusBadRequest)
+		return
+	}
+	if err := action(id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+func writeError(w http.ResponseWriter, code int, name string) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":    false,
+		"error": map[string]interface{}{"code": code, "name": name},
+	})
+}
@@ -0,0 +1,159 @@
+// Package payment описывает платёжных провайдеров, через которых бот
+// принимает оплату, и общий для них формат платежей и событий.
+package payment
+
+import (
+	"errors"
+	"net/http"
+)
+
+// События провайдеров приводятся к названиям событий ЮKassa.
+const (
+	EventPaymentSucceeded         = "payment.succeeded"
+	EventPaymentWaitingForCapture = "payment.waiting_for_capture"
+	EventPaymentCanceled          = "payment.canceled"
+	EventRefundSucceeded          = "refund.succeeded"
+)
+
+var (
+	// ErrNotSupported — провайдер не поддерживает операцию.
+	ErrNotSupported = errors.New("операция не поддерживается платёжным провайдером")
+	// ErrInvalidEvent — тело уведомления провайдера не удалось разобрать.
+	ErrInvalidEvent = errors.New("некорректное уведомление платёжного провайдера")
+	// ErrEventNotConfirmed — API провайдера не подтвердило событие из уведомления.
+	ErrEventNotConfirmed = errors.New("событие не подтверждено платёжным провайдером")
+	// ErrInvalidSignature — подпись уведомления не совпала.
+	ErrInvalidSignature = errors.New("неверная подпись уведомления платёжного провайдера")
+	// ErrRejected — провайдер отказался выполнить запрос: повтор с теми же
+	// данными тоже не пройдёт. Ошибки без него могли не дойти до провайдера
+	// или оставить результат неизвестным.
+	ErrRejected = errors.New("платёжный провайдер отклонил запрос")
+	// ErrCustomerContactRequired — для чека нужен email или телефон покупателя.
+	ErrCustomerContactRequired = errors.New("для чека нужен email или телефон покупателя")
+)
+
+// Статусы регистрации чека у провайдера.
+const (
+	ReceiptRegistrationPending   = "pending"
+	ReceiptRegistrationSucceeded = "succeeded"
+	ReceiptRegistrationCanceled  = "canceled"
+)
+
+// Amount — сумма в формате ЮKassa: строка с двумя знаками после точки.
+type Amount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// Customer — контакт покупателя, на который провайдер отправит чек.
+type Customer struct {
+	Email string
+	Phone string
+}
+
+// CreateRequest — параметры нового платежа. Title — название услуги, оно
+// же позиция чека.
+type CreateRequest struct {
+	// TelegramID — чат покупателя: туда провайдер может отправить счёт.
+	TelegramID  int64
+	Amount      Amount
+	Title       string
+	Description string
+	Customer    Customer
+	// ReturnURL — куда вернуть пользователя после оплаты.
+	ReturnURL string
+	// Capture — списать деньги сразу, без двухстадийного подтверждения.
+	Capture bool
+	// SavePaymentMethod — сохранить способ оплаты для автопродления, если
+	// провайдер это умеет.
+	SavePaymentMethod bool
+	// IdempotenceKey — повтор запроса с тем же ключом не создаёт второй
+	// платёж. Пустой — ключ создаётся для каждого запроса.
+	IdempotenceKey string
+}
+
+// Checkout — созданный у провайдера платёж. ConfirmationURL пуст, если
+// провайдер сам отправил пользователю счёт.
+type Checkout struct {
+	PaymentID       string
+	Status          string
+	ConfirmationURL string
+}
+
+// Info — состояние платежа у провайдера.
+type Info struct {
+	PaymentID          string
+	Status             string
+	Amount             Amount
+	CancellationParty  string
+	CancellationReason string
+	// PaymentMethodID — сохранённый для повторных списаний способ оплаты.
+	PaymentMethodID string
+	// ReceiptRegistration — статус регистрации чека, если провайдер его формирует.
+	ReceiptRegistration string
+}
+
+// RefundRequest — параметры возврата.
+type RefundRequest struct {
+	PaymentID string
+	Amount    Amount
+	// TelegramID и TelegramChargeID нужны для возврата оплаты через Telegram.
+	TelegramID       int64
+	TelegramChargeID string
+	// Title и Customer нужны для чека возврата.
+	Title    string
+	Customer Customer
+}
+
+// Refund — возврат по платежу.
+type Refund struct {
+	ID        string
+	PaymentID string
+	Status    string
+}
+
+// Event — уведомление провайдера, уже проверенное им самим. ObjectID
+// уникален в пределах события и служит ключом дедупликации; PaymentID —
+// платёж, к которому относится событие.
+type Event struct {
+	Name               string `json:"name"`
+	ObjectID           string `json:"object_id"`
+	PaymentID          string `json:"payment_id"`
+	Amount             Amount `json:"amount"`
+	CancellationParty  string `json:"cancellation_party,omitempty"`
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+	// TelegramChargeID — telegram_payment_charge_id успешной оплаты через Telegram.
+	TelegramChargeID string `json:"telegram_charge_id,omitempty"`
+	// PaymentMethodID — способ оплаты, сохранённый при этом платеже.
+	PaymentMethodID string `json:"payment_method_id,omitempty"`
+	// ReceiptRegistration — статус регистрации чека на момент события.
+	ReceiptRegistration string `json:"receipt_registration,omitempty"`
+	// PartialRefund — возвращена не вся сумма платежа, Amount — сумма возврата.
+	PartialRefund bool `json:"partial_refund,omitempty"`
+}
+
+// Provider — платёжная система. Операции, которых у провайдера нет,
+// возвращают ErrNotSupported.
+type Provider interface {
+	Name() string
+	CreatePayment(req CreateRequest) (*Checkout, error)
+	FetchPayment(paymentID string) (*Info, error)
+	CapturePayment(paymentID string) (*Info, error)
+	CancelPayment(paymentID string) (*Info, error)
+	Refund(req RefundRequest) (*Refund, error)
+	// ParseWebhook разбирает уведомление и проверяет его подписью из
+	// заголовков или через API провайдера.
+	ParseWebhook(header http.Header, body []byte) (*Event, error)
+}
+
+// Recurring реализуют провайдеры, которые списывают оплату с сохранённого
+// способа оплаты без участия пользователя.
+type Recurring interface {
+	ChargeSaved(req CreateRequest, paymentMethodID string) (*Info, error)
+}
+
+// FixedCurrency реализуют провайдеры, принимающие оплату только в своей
+// валюте, например Telegram Stars.
+type FixedCurrency interface {
+	Currency() string
+}
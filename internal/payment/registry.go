@@ -0,0 +1,49 @@
+package payment
+
+import "fmt"
+
+// Registry хранит подключённых провайдеров и выбирает провайдера для тарифа.
+type Registry struct {
+	providers   map[string]Provider
+	byPlan      map[int]string
+	defaultName string
+}
+
+// NewRegistry проверяет, что провайдер по умолчанию и все провайдеры из
+// byPlan подключены.
+func NewRegistry(defaultName string, byPlan map[int]string, providers ...Provider) (*Registry, error) {
+	r := &Registry{
+		providers:   make(map[string]Provider, len(providers)),
+		byPlan:      byPlan,
+		defaultName: defaultName,
+	}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+
+	if _, err := r.Get(defaultName); err != nil {
+		return nil, err
+	}
+	for planID, name := range byPlan {
+		if _, err := r.Get(name); err != nil {
+			return nil, fmt.Errorf("тариф %d: %w", planID, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("платёжный провайдер %q не подключён", name)
+	}
+	return p, nil
+}
+
+// ForPlan возвращает провайдера, которым оплачивается тариф.
+func (r *Registry) ForPlan(planID int) Provider {
+	if name, ok := r.byPlan[planID]; ok {
+		return r.providers[name]
+	}
+	return r.providers[r.defaultName]
+}
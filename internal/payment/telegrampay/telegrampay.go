@@ -0,0 +1,166 @@
+// Package telegrampay — оплата встроенными платежами Telegram: бот
+// отправляет счёт (sendInvoice), подтверждает pre_checkout_query и получает
+// successful_payment. Деньги через платёжную систему вернуть через Bot API
+// нельзя, а Telegram Stars возвращаются методом refundStarPayment.
+package telegrampay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+)
+
+const (
+	Name      = "telegram"
+	StarsName = "stars"
+)
+
+type provider struct {
+	bot           *tgbotapi.BotAPI
+	providerToken string
+}
+
+// NewProvider создаёт провайдера; providerToken выдаёт @BotFather после
+// подключения платёжной системы.
+func NewProvider(bot *tgbotapi.BotAPI, providerToken string) payment.Provider {
+	return &provider{bot: bot, providerToken: providerToken}
+}
+
+func (p *provider) Name() string {
+	return Name
+}
+
+// starsProvider принимает оплату в Telegram Stars: счёт выставляется без
+// токена платёжной системы, а оплату можно вернуть через Bot API.
+type starsProvider struct {
+	provider
+}
+
+func NewStarsProvider(bot *tgbotapi.BotAPI) payment.Provider {
+	return &starsProvider{provider{bot: bot}}
+}
+
+func (p *starsProvider) Name() string {
+	return StarsName
+}
+
+func (p *starsProvider) Currency() string {
+	return domain.CurrencyStars
+}
+
+func (p *starsProvider) CreatePayment(req payment.CreateRequest) (*payment.Checkout, error) {
+	if req.Amount.Currency != domain.CurrencyStars {
+		return nil, fmt.Errorf("оплата звёздами возможна только в %s, а не в %s", domain.CurrencyStars, req.Amount.Currency)
+	}
+	return p.provider.CreatePayment(req)
+}
+
+// Refund возвращает звёзды пользователю методом refundStarPayment.
+func (p *starsProvider) Refund(req payment.RefundRequest) (*payment.Refund, error) {
+	if req.TelegramChargeID == "" {
+		return nil, fmt.Errorf("у платежа %s нет telegram_payment_charge_id", req.PaymentID)
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("user_id", req.TelegramID)
+	params.AddNonEmpty("telegram_payment_charge_id", req.TelegramChargeID)
+	if _, err := p.bot.MakeRequest("refundStarPayment", params); err != nil {
+		return nil, err
+	}
+	return &payment.Refund{ID: req.TelegramChargeID, PaymentID: req.PaymentID, Status: "succeeded"}, nil
+}
+
+// CreatePayment отправляет пользователю счёт. Идентификатором платежа служит
+// payload счёта: Telegram вернёт его в pre_checkout_query и successful_payment.
+func (p *provider) CreatePayment(req payment.CreateRequest) (*payment.Checkout, error) {
+	amount, err := ToMinorUnits(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := newPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := tgbotapi.NewInvoice(req.TelegramID, req.Title, req.Description, payload, p.providerToken, "",
+		req.Amount.Currency, []tgbotapi.LabeledPrice{{Label: req.Title, Amount: amount}})
+	if _, err := p.bot.Send(invoice); err != nil {
+		return nil, err
+	}
+	return &payment.Checkout{PaymentID: payload, Status: "pending"}, nil
+}
+
+func (p *provider) FetchPayment(paymentID string) (*payment.Info, error) {
+	return nil, payment.ErrNotSupported
+}
+
+func (p *provider) CapturePayment(paymentID string) (*payment.Info, error) {
+	return nil, payment.ErrNotSupported
+}
+
+func (p *provider) CancelPayment(paymentID string) (*payment.Info, error) {
+	return nil, payment.ErrNotSupported
+}
+
+// Refund недоступен: деньги возвращаются в личном кабинете платёжной системы.
+func (p *provider) Refund(req payment.RefundRequest) (*payment.Refund, error) {
+	return nil, payment.ErrNotSupported
+}
+
+// ParseWebhook недоступен: о платежах Telegram сообщает обновлениями бота.
+func (p *provider) ParseWebhook(header http.Header, body []byte) (*payment.Event, error) {
+	return nil, payment.ErrNotSupported
+}
+
+// SuccessfulPaymentEvent переводит successful_payment в событие об оплате.
+func SuccessfulPaymentEvent(sp *tgbotapi.SuccessfulPayment) *payment.Event {
+	return &payment.Event{
+		Name:             payment.EventPaymentSucceeded,
+		ObjectID:         sp.TelegramPaymentChargeID,
+		PaymentID:        sp.InvoicePayload,
+		Amount:           FromMinorUnits(sp.TotalAmount, sp.Currency),
+		TelegramChargeID: sp.TelegramPaymentChargeID,
+	}
+}
+
+// ToMinorUnits переводит сумму в минимальные единицы валюты, в которых
+// Telegram принимает цены: копейки для рублей, целые звёзды для XTR.
+func ToMinorUnits(a payment.Amount) (int, error) {
+	value, err := strconv.ParseFloat(a.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("некорректная сумма %q: %w", a.Value, err)
+	}
+	return int(math.Round(value * minorUnits(a.Currency))), nil
+}
+
+// FromMinorUnits — обратное к ToMinorUnits преобразование.
+func FromMinorUnits(amount int, currency string) payment.Amount {
+	return payment.Amount{
+		Value:    strconv.FormatFloat(float64(amount)/minorUnits(currency), 'f', 2, 64),
+		Currency: currency,
+	}
+}
+
+// minorUnits — сколько минимальных единиц в единице валюты. Звёзды не
+// делятся, остальные валюты, которые продаёт бот, делятся на сотые.
+func minorUnits(currency string) float64 {
+	if currency == domain.CurrencyStars {
+		return 1
+	}
+	return 100
+}
+
+func newPayload() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "tg_" + hex.EncodeToString(b), nil
+}
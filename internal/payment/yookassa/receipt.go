@@ -0,0 +1,54 @@
+package yookassa
+
+import "vpn-bot/internal/payment"
+
+// ReceiptSettings — параметры чеков 54-ФЗ, которые ЮKassa передаёт в
+// онлайн-кассу. Коды — из справочников ЮKassa: VATCode 1 — без НДС,
+// TaxSystemCode 0 — не передавать систему налогообложения.
+type ReceiptSettings struct {
+	VATCode       int
+	TaxSystemCode int
+}
+
+type receipt struct {
+	Customer      receiptCustomer `json:"customer"`
+	Items         []receiptItem   `json:"items"`
+	TaxSystemCode int             `json:"tax_system_code,omitempty"`
+}
+
+type receiptCustomer struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+type receiptItem struct {
+	Description    string         `json:"description"`
+	Quantity       string         `json:"quantity"`
+	Amount         payment.Amount `json:"amount"`
+	VATCode        int            `json:"vat_code"`
+	PaymentMode    string         `json:"payment_mode"`
+	PaymentSubject string         `json:"payment_subject"`
+}
+
+// receipt собирает чек из одной позиции — оплаченной услуги. Без настроек
+// чеков возвращает nil, без контакта покупателя — ErrCustomerContactRequired.
+func (p *provider) receipt(title string, amount payment.Amount, customer payment.Customer) (*receipt, error) {
+	if p.receipts == nil {
+		return nil, nil
+	}
+	if customer.Email == "" && customer.Phone == "" {
+		return nil, payment.ErrCustomerContactRequired
+	}
+	return &receipt{
+		Customer: receiptCustomer{Email: customer.Email, Phone: customer.Phone},
+		Items: []receiptItem{{
+			Description:    truncate(title, maxDescription),
+			Quantity:       "1.00",
+			Amount:         amount,
+			VATCode:        p.receipts.VATCode,
+			PaymentMode:    "full_payment",
+			PaymentSubject: "service",
+		}},
+		TaxSystemCode: p.receipts.TaxSystemCode,
+	}, nil
+}
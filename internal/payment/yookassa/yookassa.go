@@ -0,0 +1,332 @@
+// Package yookassa — платёжный провайдер ЮKassa (REST API v3).
+package yookassa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"vpn-bot/internal/payment"
+)
+
+const (
+	Name = "yookassa"
+
+	apiURL = "https://api.yookassa.ru/v3"
+
+	// maxDescription — предел длины описания платежа и позиции чека в символах.
+	maxDescription = 128
+)
+
+type createPaymentRequest struct {
+	Amount            payment.Amount `json:"amount"`
+	Capture           bool           `json:"capture"`
+	Description       string         `json:"description"`
+	Confirmation      *confirmation  `json:"confirmation,omitempty"`
+	SavePaymentMethod bool           `json:"save_payment_method,omitempty"`
+	PaymentMethodID   string         `json:"payment_method_id,omitempty"`
+	Receipt           *receipt       `json:"receipt,omitempty"`
+}
+
+type confirmation struct {
+	Type      string `json:"type"`
+	ReturnURL string `json:"return_url"`
+}
+
+type paymentMethod struct {
+	ID    string `json:"id"`
+	Saved bool   `json:"saved"`
+}
+
+type paymentResponse struct {
+	ID           string         `json:"id"`
+	Status       string         `json:"status"`
+	Amount       payment.Amount `json:"amount"`
+	Confirmation struct {
+		Type            string `json:"type"`
+		ConfirmationURL string `json:"confirmation_url"`
+	} `json:"confirmation"`
+	CancellationDetails cancellationDetails `json:"cancellation_details"`
+	PaymentMethod       paymentMethod       `json:"payment_method"`
+	ReceiptRegistration string              `json:"receipt_registration"`
+	RefundedAmount      payment.Amount      `json:"refunded_amount"`
+}
+
+type cancellationDetails struct {
+	Party  string `json:"party"`
+	Reason string `json:"reason"`
+}
+
+type refundRequest struct {
+	PaymentID string         `json:"payment_id"`
+	Amount    payment.Amount `json:"amount"`
+	Receipt   *receipt       `json:"receipt,omitempty"`
+}
+
+type refundResponse struct {
+	ID        string         `json:"id"`
+	Status    string         `json:"status"`
+	PaymentID string         `json:"payment_id"`
+	Amount    payment.Amount `json:"amount"`
+}
+
+// webhook — тело уведомления ЮKassa.
+type webhook struct {
+	Type   string `json:"type"`
+	Event  string `json:"event"`
+	Object struct {
+		ID                  string              `json:"id"`
+		Status              string              `json:"status"`
+		PaymentID           string              `json:"payment_id"`
+		Amount              payment.Amount      `json:"amount"`
+		CancellationDetails cancellationDetails `json:"cancellation_details"`
+	} `json:"object"`
+}
+
+type provider struct {
+	shopID   string
+	secret   string
+	receipts *ReceiptSettings
+	client   *http.Client
+}
+
+// NewProvider создаёт провайдера. Если receipts не nil, к каждому платежу и
+// возврату прикладывается чек 54-ФЗ.
+func NewProvider(shopID, secret string, receipts *ReceiptSettings) payment.Provider {
+	return &provider{
+		shopID:   shopID,
+		secret:   secret,
+		receipts: receipts,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *provider) Name() string {
+	return Name
+}
+
+func (p *provider) CreatePayment(req payment.CreateRequest) (*payment.Checkout, error) {
+	receipt, err := p.receipt(req.Title, req.Amount, req.Customer)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := createPaymentRequest{
+		Amount:            req.Amount,
+		Capture:           req.Capture,
+		Description:       truncate(req.Description, maxDescription),
+		Confirmation:      &confirmation{Type: "redirect", ReturnURL: req.ReturnURL},
+		SavePaymentMethod: req.SavePaymentMethod,
+		Receipt:           receipt,
+	}
+
+	var resp paymentResponse
+	if err := p.request(http.MethodPost, "/payments", reqBody, &resp); err != nil {
+		return nil, err
+	}
+	return &payment.Checkout{
+		PaymentID:       resp.ID,
+		Status:          resp.Status,
+		ConfirmationURL: resp.Confirmation.ConfirmationURL,
+	}, nil
+}
+
+// ChargeSaved списывает оплату с сохранённого способа оплаты: платёж
+// проходит без подтверждения пользователем и сразу получает итоговый статус
+// либо придёт вебхуком.
+func (p *provider) ChargeSaved(req payment.CreateRequest, paymentMethodID string) (*payment.Info, error) {
+	receipt, err := p.receipt(req.Title, req.Amount, req.Customer)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := createPaymentRequest{
+		Amount:          req.Amount,
+		Capture:         true,
+		Description:     truncate(req.Description, maxDescription),
+		PaymentMethodID: paymentMethodID,
+		Receipt:         receipt,
+	}
+
+	var resp paymentResponse
+	if err := p.requestOnce(http.MethodPost, "/payments", req.IdempotenceKey, reqBody, &resp); err != nil {
+		return nil, err
+	}
+	return resp.info(), nil
+}
+
+func (p *provider) FetchPayment(paymentID string) (*payment.Info, error) {
+	var resp paymentResponse
+	if err := p.request(http.MethodGet, "/payments/"+paymentID, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.info(), nil
+}
+
+func (p *provider) CapturePayment(paymentID string) (*payment.Info, error) {
+	var resp paymentResponse
+	if err := p.request(http.MethodPost, "/payments/"+paymentID+"/capture", struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.info(), nil
+}
+
+func (p *provider) CancelPayment(paymentID string) (*payment.Info, error) {
+	var resp paymentResponse
+	if err := p.request(http.MethodPost, "/payments/"+paymentID+"/cancel", struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.info(), nil
+}
+
+func (p *provider) Refund(req payment.RefundRequest) (*payment.Refund, error) {
+	receipt, err := p.receipt(req.Title, req.Amount, req.Customer)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp refundResponse
+	err = p.request(http.MethodPost, "/refunds", refundRequest{PaymentID: req.PaymentID, Amount: req.Amount, Receipt: receipt}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &payment.Refund{ID: resp.ID, PaymentID: resp.PaymentID, Status: resp.Status}, nil
+}
+
+// ParseWebhook разбирает уведомление и запрашивает его объект из API: телу
+// вебхука верим, только если статус, сумма и валюта в API совпадают с ним.
+func (p *provider) ParseWebhook(header http.Header, body []byte) (*payment.Event, error) {
+	var w webhook
+	if err := json.Unmarshal(body, &w); err != nil {
+		return nil, fmt.Errorf("%w: %v", payment.ErrInvalidEvent, err)
+	}
+	if w.Event == "" || w.Object.ID == "" {
+		return nil, fmt.Errorf("%w: нет event или object.id", payment.ErrInvalidEvent)
+	}
+
+	object := w.Object
+	event := &payment.Event{
+		Name:               w.Event,
+		ObjectID:           object.ID,
+		PaymentID:          object.ID,
+		Amount:             object.Amount,
+		CancellationParty:  object.CancellationDetails.Party,
+		CancellationReason: object.CancellationDetails.Reason,
+	}
+
+	switch w.Event {
+	case payment.EventPaymentSucceeded, payment.EventPaymentWaitingForCapture, payment.EventPaymentCanceled:
+		info, err := p.FetchPayment(object.ID)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось проверить платёж %s в ЮKassa: %w", object.ID, err)
+		}
+
+		expected := strings.TrimPrefix(w.Event, "payment.")
+		if info.Status != expected {
+			return nil, fmt.Errorf("%w: платёж %s в ЮKassa в статусе %s, а не %s",
+				payment.ErrEventNotConfirmed, object.ID, info.Status, expected)
+		}
+		if info.Amount != object.Amount {
+			return nil, fmt.Errorf("%w: платёж %s в ЮKassa на %s %s, а в вебхуке %s %s", payment.ErrEventNotConfirmed,
+				object.ID, info.Amount.Value, info.Amount.Currency, object.Amount.Value, object.Amount.Currency)
+		}
+		event.PaymentMethodID = info.PaymentMethodID
+		event.ReceiptRegistration = info.ReceiptRegistration
+
+	case payment.EventRefundSucceeded:
+		var resp refundResponse
+		if err := p.request(http.MethodGet, "/refunds/"+object.ID, nil, &resp); err != nil {
+			return nil, fmt.Errorf("не удалось проверить возврат %s в ЮKassa: %w", object.ID, err)
+		}
+		if resp.Status != "succeeded" || resp.PaymentID != object.PaymentID {
+			return nil, fmt.Errorf("%w: возврат %s в ЮKassa в статусе %s по платежу %s",
+				payment.ErrEventNotConfirmed, object.ID, resp.Status, resp.PaymentID)
+		}
+		event.PaymentID = object.PaymentID
+		event.Amount = resp.Amount
+
+		// Частичный возврат не отменяет покупку: ключ остаётся у пользователя.
+		var pay paymentResponse
+		if err := p.request(http.MethodGet, "/payments/"+resp.PaymentID, nil, &pay); err != nil {
+			return nil, fmt.Errorf("не удалось проверить платёж %s в ЮKassa: %w", resp.PaymentID, err)
+		}
+		event.PartialRefund = resp.Amount != pay.Amount && pay.RefundedAmount != pay.Amount
+	}
+	return event, nil
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func (r *paymentResponse) info() *payment.Info {
+	info := &payment.Info{
+		PaymentID:          r.ID,
+		Status:             r.Status,
+		Amount:             r.Amount,
+		CancellationParty:  r.CancellationDetails.Party,
+		CancellationReason: r.CancellationDetails.Reason,
+
+		ReceiptRegistration: r.ReceiptRegistration,
+	}
+	if r.PaymentMethod.Saved {
+		info.PaymentMethodID = r.PaymentMethod.ID
+	}
+	return info
+}
+
+// request выполняет запрос к API ЮKassa и декодирует ответ в out.
+// Для GET-запросов body передаётся как nil.
+func (p *provider) request(method, path string, body, out interface{}) error {
+	return p.requestOnce(method, path, "", body, out)
+}
+
+// requestOnce выполняет запрос с ключом идемпотентности idempotenceKey:
+// повтор с тем же ключом ЮKassa не выполняет заново, а возвращает прежний
+// результат. Пустой ключ создаётся заново для каждого запроса.
+func (p *provider) requestOnce(method, path, idempotenceKey string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	req, err := http.NewRequest(method, apiURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(p.shopID, p.secret)
+	if idempotenceKey == "" {
+		idempotenceKey = fmt.Sprintf("my-key-%d", time.Now().UnixNano())
+	}
+	req.Header.Set("Idempotence-Key", idempotenceKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		errBody, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("Ошибка от YooKassa: %d %s", resp.StatusCode, string(errBody))
+		// На 4xx запрос не выполнен; после 429 и 5xx его повторяют с тем же ключом.
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %v", payment.ErrRejected, err)
+		}
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,38 @@
+// Package qr строит QR-коды ключей, которые VPN-приложения сканируют
+// камерой вместо копирования длинной строки.
+package qr
+
+import (
+	"unicode/utf8"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"vpn-bot/internal/domain"
+)
+
+const (
+	// size — сторона картинки в пикселях.
+	size = 512
+	// maxCaption — предел длины подписи к фото в Telegram.
+	maxCaption = 1024
+)
+
+// KeyPhoto возвращает QR-код ключа в PNG и подпись к нему в Markdown:
+// ссылку целиком, а для WireGuard — только адрес клиента: конфигурация с
+// приватным ключом уже отправлена файлом. Если ключ не помещается в
+// подпись, она остаётся без него.
+func KeyPhoto(key *domain.VPNKey) (png []byte, caption string, err error) {
+	png, err = qrcode.Encode(key.Key, qrcode.Medium, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if key.IsConfig() {
+		caption = "📷 " + key.Label()
+	} else {
+		caption = "📷 `" + key.Key + "`"
+	}
+	if utf8.RuneCountInString(caption) > maxCaption {
+		caption = "📷 QR-код VPN-ключа"
+	}
+	return png, caption, nil
+}
@@ -0,0 +1,58 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"vpn-bot/internal/domain"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func TestKeyPhotoLink(t *testing.T) {
+	key := &domain.VPNKey{ID: 1, Key: "ss://Y2hhY2hhMjA@vpn.example.com:443/?outline=1"}
+
+	png, caption, err := KeyPhoto(key)
+	if err != nil {
+		t.Fatalf("KeyPhoto: %v", err)
+	}
+	if !bytes.HasPrefix(png, pngHeader) {
+		t.Error("картинка не в PNG")
+	}
+	if caption != "📷 `"+key.Key+"`" {
+		t.Errorf("подпись %q, ожидалась ссылка целиком", caption)
+	}
+}
+
+func TestKeyPhotoConfigHidesPrivateKey(t *testing.T) {
+	const privateKey = "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	key := &domain.VPNKey{ID: 2, Key: "[Interface]\nPrivateKey = " + privateKey + "\nAddress = 10.8.0.2/32\n\n" +
+		"[Peer]\nPublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=\nEndpoint = vpn.example.com:51820\n"}
+
+	png, caption, err := KeyPhoto(key)
+	if err != nil {
+		t.Fatalf("KeyPhoto: %v", err)
+	}
+	if !bytes.HasPrefix(png, pngHeader) {
+		t.Error("картинка не в PNG")
+	}
+	if strings.Contains(caption, privateKey) || strings.Contains(caption, "[Interface]") {
+		t.Errorf("конфигурация попала в подпись: %q", caption)
+	}
+	if caption != "📷 WireGuard 10.8.0.2/32" {
+		t.Errorf("подпись %q, ожидался адрес клиента", caption)
+	}
+}
+
+func TestKeyPhotoLongLink(t *testing.T) {
+	key := &domain.VPNKey{ID: 3, Key: "vless://" + strings.Repeat("a", maxCaption) + "@vpn.example.com:443"}
+
+	_, caption, err := KeyPhoto(key)
+	if err != nil {
+		t.Fatalf("KeyPhoto: %v", err)
+	}
+	if caption != "📷 QR-код VPN-ключа" {
+		t.Errorf("подпись %q, ожидалась без ключа", caption)
+	}
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidPaymentTransition = errors.New("недопустимый переход статуса платежа")
+	ErrNoFreeKeys               = errors.New("нет свободных VPN-ключей")
+	ErrPaymentNotFound          = errors.New("платёж не найден")
+	// ErrNoFreeAddresses — подсеть WireGuard занята. Для выдачи ключей это
+	// то же, что пустой пул: оплаченные покупки ждут в очереди.
+	ErrNoFreeAddresses = fmt.Errorf("%w: в подсети WireGuard не осталось адресов", ErrNoFreeKeys)
+)
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"net/netip"
 	"time"
 	"vpn-bot/internal/domain"
 )
@@ -8,18 +9,95 @@ import (
 type UserRepository interface {
 	CreateUser(telegramID int64, username, chatLink string) error
 	GetByTelegramID(telegramID int64) (*domain.User, error)
+	GetByID(userID int) (*domain.User, error)
+	SetAutoRenew(userID int, enabled bool) error
+	SavePaymentMethod(userID int, provider, paymentMethodID string) error
+	ClearPaymentMethod(userID int) error
+	SetContact(userID int, email, phone string) error
 }
 
 type VPNKeyRepository interface {
-	FindFreeKey() (*domain.VPNKey, error)
-	AssignKeyToUser(keyID, userID int, expiresAt time.Time) error
+	ClaimFreeKey(userID int, expiresAt time.Time) (*domain.VPNKey, error)
+	ReserveFreeKey(paymentID int, until time.Time) (*domain.VPNKey, error)
+	MoveUserReservation(userID, paymentID int, until time.Time) (*domain.VPNKey, error)
+	ClaimReservedKey(paymentID, userID int, expiresAt time.Time) (*domain.VPNKey, error)
+	ReleaseReservation(paymentID int) error
+	ReleaseExpiredReservations(now time.Time) (int, error)
+	GetByID(keyID int) (*domain.VPNKey, error)
+	ExtendKey(keyID int, expiresAt time.Time) error
+	RevokeKey(keyID int) error
 	GetKeysByTelegramID(telegramID int64) ([]domain.VPNKey, error)
 	AddKey(key string) error
+	AddIssuedKey(k *domain.VPNKey) error
 	CountFreeKeys() (int, error)
+	FindKeysExpiringBetween(from, to time.Time, notificationKind string) ([]domain.VPNKeyOwner, error)
+	MarkKeyNotified(keyID int, notificationKind string, expiresAt time.Time) error
+	FindKeysForAutoRenew(from, to time.Time, notificationKind string) ([]domain.AutoRenewal, error)
+	FindExpiredKeys(now time.Time) ([]domain.VPNKeyOwner, error)
+	MarkKeyExpired(keyID int) (bool, error)
+	ReleaseExpiredKeys(expiredBefore time.Time) (int, error)
+	FindExpiredIssuedKeys(expiredBefore time.Time) ([]domain.VPNKey, error)
 }
 
 type PaymentRepository interface {
-	CreatePayment(userID int, amount float64, status, paymentID string) error
+	CreatePayment(p *domain.Payment) error
+	GetByID(id int) (*domain.Payment, error)
 	GetByPaymentID(paymentID string) (*domain.Payment, error)
+	GetByPaymentIDForUpdate(paymentID string) (*domain.Payment, error)
+	GetByReturnToken(token string) (*domain.Payment, error)
+	FindUnfinished(from, to time.Time) ([]domain.Payment, error)
 	UpdatePaymentStatus(paymentID int, status string) error
+	SetProviderPaymentID(paymentID int, providerPaymentID string) error
+	SetPaymentKey(paymentID, keyID int) error
+	SetTelegramChargeID(paymentID int, chargeID string) error
+	SetReceiptRegistration(paymentID int, status string) error
+	MarkRefunded(paymentID int) error
+	MarkCanceled(paymentID int, party, reason string) error
+}
+
+type PlanRepository interface {
+	GetActivePlans() ([]domain.Plan, error)
+	GetByID(planID int) (*domain.Plan, error)
+}
+
+type PendingDeliveryRepository interface {
+	Enqueue(userID, paymentID int) error
+	LockOldestPending() (*domain.PendingDelivery, error)
+	MarkDelivered(deliveryID, keyID int) error
+	CancelByPayment(paymentID int) error
+	CountPending() (int, error)
+}
+
+type NotificationRepository interface {
+	Enqueue(n *domain.Notification) error
+	ClaimDue(limit int, lease time.Duration) ([]domain.Notification, error)
+	MarkSent(id int64) error
+	ScheduleRetry(id int64, attempts int, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(id int64, lastError string) error
+}
+
+type PaymentAnomalyRepository interface {
+	Create(a *domain.PaymentAnomaly) error
+}
+
+type WebhookEventRepository interface {
+	Record(e *domain.WebhookEvent) (bool, error)
+	GetByIDForUpdate(id int64) (*domain.WebhookEvent, error)
+	MarkProcessed(id int64) error
+	MarkFailed(id int64, lastError string) (int, error)
+}
+
+type WireGuardPeerRepository interface {
+	// Allocate сохраняет пира с первым свободным адресом подсети. Первый
+	// адрес подсети — у сервера.
+	Allocate(peer *domain.WireGuardPeer, subnet netip.Prefix) error
+	GetByPublicKey(publicKey string) (*domain.WireGuardPeer, error)
+	SetEnabled(publicKey string, enabled bool) error
+	Delete(publicKey string) error
+	ListEnabled() ([]domain.WireGuardPeer, error)
+}
+
+type UnitOfWork interface {
+	// Do выполняет fn в одной транзакции: коммит, если fn вернула nil, иначе откат.
+	Do(fn func(r Repositories) error) error
 }
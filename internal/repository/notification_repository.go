@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"vpn-bot/internal/domain"
+)
+
+type notificationRepositoryImpl struct {
+	db DBTX
+}
+
+func NewNotificationRepository(db DBTX) NotificationRepository {
+	return &notificationRepositoryImpl{db: db}
+}
+
+func (r *notificationRepositoryImpl) Enqueue(n *domain.Notification) error {
+	query := `INSERT INTO notifications (telegram_id, text, parse_mode, document_name, document, photo, status, next_attempt_at, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, 'pending', NOW(), NOW())
+              RETURNING id`
+	return r.db.QueryRow(context.Background(), query, n.TelegramID, n.Text, n.ParseMode, n.DocumentName, n.Document, n.Photo).Scan(&n.ID)
+}
+
+// ClaimDue забирает до limit уведомлений, срок отправки которых наступил,
+// и откладывает их на lease: пока отправитель с ними работает, другие их
+// не возьмут. Если он упадёт, не сохранив результат, уведомления снова
+// станут доступны по истечении lease.
+func (r *notificationRepositoryImpl) ClaimDue(limit int, lease time.Duration) ([]domain.Notification, error) {
+	query := `UPDATE notifications
+              SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+              WHERE id IN (
+                  SELECT id FROM notifications
+                  WHERE status = 'pending' AND next_attempt_at <= NOW()
+                  ORDER BY next_attempt_at, id
+                  LIMIT $1
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING id, telegram_id, text, parse_mode, document_name, document, photo, status, attempts, next_attempt_at, last_error, created_at, sent_at`
+	rows, err := r.db.Query(context.Background(), query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		err := rows.Scan(&n.ID, &n.TelegramID, &n.Text, &n.ParseMode, &n.DocumentName, &n.Document, &n.Photo, &n.Status, &n.Attempts,
+			&n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING не сохраняет порядок подзапроса.
+	slices.SortFunc(result, func(a, b domain.Notification) int { return cmp.Compare(a.ID, b.ID) })
+	return result, nil
+}
+
+func (r *notificationRepositoryImpl) MarkSent(id int64) error {
+	query := `UPDATE notifications
+              SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = ''
+              WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, id)
+	return err
+}
+
+func (r *notificationRepositoryImpl) ScheduleRetry(id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	query := `UPDATE notifications
+              SET attempts = $2, next_attempt_at = $3, last_error = $4
+              WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, id, attempts, nextAttemptAt, lastError)
+	return err
+}
+
+func (r *notificationRepositoryImpl) MarkFailed(id int64, lastError string) error {
+	query := `UPDATE notifications
+              SET status = 'failed', attempts = attempts + 1, last_error = $2
+              WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, id, lastError)
+	return err
+}
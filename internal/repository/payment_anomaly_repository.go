@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"vpn-bot/internal/domain"
+)
+
+type paymentAnomalyRepositoryImpl struct {
+	db DBTX
+}
+
+func NewPaymentAnomalyRepository(db DBTX) PaymentAnomalyRepository {
+	return &paymentAnomalyRepositoryImpl{db: db}
+}
+
+func (r *paymentAnomalyRepositoryImpl) Create(a *domain.PaymentAnomaly) error {
+	query := `INSERT INTO payment_anomalies (payment_id, kind, expected_amount, expected_currency, actual_amount, actual_currency, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, NOW())
+              RETURNING id, created_at`
+	row := r.db.QueryRow(context.Background(), query, a.PaymentID, a.Kind, a.ExpectedAmount, a.ExpectedCurrency,
+		a.ActualAmount, a.ActualCurrency)
+	return row.Scan(&a.ID, &a.CreatedAt)
+}
@@ -2,35 +2,110 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"vpn-bot/internal/domain"
 )
 
+// paymentTransitions перечисляет, из каких статусов допустим переход в данный.
+var paymentTransitions = map[string][]string{
+	domain.PaymentStatusWaitingForCapture: {domain.PaymentStatusPending},
+	domain.PaymentStatusSucceeded:         {domain.PaymentStatusPending, domain.PaymentStatusWaitingForCapture},
+	domain.PaymentStatusCanceled:          {domain.PaymentStatusPending, domain.PaymentStatusWaitingForCapture},
+	domain.PaymentStatusRefunded:          {domain.PaymentStatusSucceeded},
+}
+
 type paymentRepositoryImpl struct {
-	db *pgxpool.Pool
+	db DBTX
 }
 
-func NewPaymentRepository(db *pgxpool.Pool) PaymentRepository {
+func NewPaymentRepository(db DBTX) PaymentRepository {
 	return &paymentRepositoryImpl{db: db}
 }
 
-func (r *paymentRepositoryImpl) CreatePayment(userID int, amount float64, status, paymentID string) error {
-	query := `INSERT INTO payments (user_id, amount, status, payment_id, created_at)
-              VALUES ($1, $2, $3, $4, NOW())`
-	_, err := r.db.Exec(context.Background(), query, userID, amount, status, paymentID)
-	return err
+func (r *paymentRepositoryImpl) CreatePayment(p *domain.Payment) error {
+	query := `INSERT INTO payments (user_id, amount, currency, status, provider, payment_id, purpose, vpn_key_id, plan_id,
+                                  recurring, return_token, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+              RETURNING id, created_at`
+	row := r.db.QueryRow(context.Background(), query, p.UserID, p.Amount, p.Currency, p.Status, p.Provider, p.PaymentID,
+		p.Purpose, p.VPNKeyID, p.PlanID, p.Recurring, p.ReturnToken)
+	return row.Scan(&p.ID, &p.CreatedAt)
+}
+
+func (r *paymentRepositoryImpl) GetByID(id int) (*domain.Payment, error) {
+	query := `SELECT id, user_id, amount, currency, status, provider, payment_id, purpose,
+                     vpn_key_id, plan_id, telegram_payment_charge_id, recurring, return_token, created_at
+              FROM payments
+              WHERE id = $1`
+	return r.scanPayment(r.db.QueryRow(context.Background(), query, id))
 }
 
 func (r *paymentRepositoryImpl) GetByPaymentID(paymentID string) (*domain.Payment, error) {
-	query := `SELECT id, user_id, amount, status, payment_id, created_at
+	query := `SELECT id, user_id, amount, currency, status, provider, payment_id, purpose,
+                     vpn_key_id, plan_id, telegram_payment_charge_id, recurring, return_token, created_at
               FROM payments
               WHERE payment_id = $1
               LIMIT 1`
-	row := r.db.QueryRow(context.Background(), query, paymentID)
+	return r.scanPayment(r.db.QueryRow(context.Background(), query, paymentID))
+}
+
+// GetByPaymentIDForUpdate блокирует строку платежа до конца транзакции.
+func (r *paymentRepositoryImpl) GetByPaymentIDForUpdate(paymentID string) (*domain.Payment, error) {
+	query := `SELECT id, user_id, amount, currency, status, provider, payment_id, purpose,
+                     vpn_key_id, plan_id, telegram_payment_charge_id, recurring, return_token, created_at
+              FROM payments
+              WHERE payment_id = $1
+              LIMIT 1
+              FOR UPDATE`
+	return r.scanPayment(r.db.QueryRow(context.Background(), query, paymentID))
+}
+
+func (r *paymentRepositoryImpl) GetByReturnToken(token string) (*domain.Payment, error) {
+	query := `SELECT id, user_id, amount, currency, status, provider, payment_id, purpose,
+                     vpn_key_id, plan_id, telegram_payment_charge_id, recurring, return_token, created_at
+              FROM payments
+              WHERE return_token = $1`
+	pay, err := r.scanPayment(r.db.QueryRow(context.Background(), query, token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	return pay, err
+}
+
+// FindUnfinished возвращает незавершённые платежи (pending и
+// waiting_for_capture), созданные в промежутке [from, to).
+func (r *paymentRepositoryImpl) FindUnfinished(from, to time.Time) ([]domain.Payment, error) {
+	query := `SELECT id, user_id, amount, currency, status, provider, payment_id, purpose,
+                     vpn_key_id, plan_id, telegram_payment_charge_id, recurring, return_token, created_at
+              FROM payments
+              WHERE status IN ('pending', 'waiting_for_capture')
+                AND created_at >= $1 AND created_at < $2
+              ORDER BY created_at`
+	rows, err := r.db.Query(context.Background(), query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []domain.Payment
+	for rows.Next() {
+		p, err := r.scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *p)
+	}
+	return payments, rows.Err()
+}
 
+func (r *paymentRepositoryImpl) scanPayment(row pgx.Row) (*domain.Payment, error) {
 	var p domain.Payment
-	err := row.Scan(&p.ID, &p.UserID, &p.Amount, &p.Status, &p.PaymentID, &p.CreatedAt)
+	err := row.Scan(&p.ID, &p.UserID, &p.Amount, &p.Currency, &p.Status, &p.Provider, &p.PaymentID, &p.Purpose, &p.VPNKeyID, &p.PlanID,
+		&p.TelegramChargeID, &p.Recurring, &p.ReturnToken, &p.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +113,64 @@ func (r *paymentRepositoryImpl) GetByPaymentID(paymentID string) (*domain.Paymen
 }
 
 func (r *paymentRepositoryImpl) UpdatePaymentStatus(paymentID int, status string) error {
-	query := `UPDATE payments SET status = $1 WHERE id = $2`
+	query := `UPDATE payments SET status = $1 WHERE id = $2 AND status = ANY($3)`
+	return r.transition(query, paymentID, status)
+}
+
+// SetProviderPaymentID записывает ID платежа у провайдера вместо
+// временного, под которым платёж сохранён до запроса к провайдеру.
+func (r *paymentRepositoryImpl) SetProviderPaymentID(paymentID int, providerPaymentID string) error {
+	query := `UPDATE payments SET payment_id = $1 WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, providerPaymentID, paymentID)
+	return err
+}
+
+func (r *paymentRepositoryImpl) SetPaymentKey(paymentID, keyID int) error {
+	query := `UPDATE payments SET vpn_key_id = $1 WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, keyID, paymentID)
+	return err
+}
+
+func (r *paymentRepositoryImpl) SetTelegramChargeID(paymentID int, chargeID string) error {
+	query := `UPDATE payments SET telegram_payment_charge_id = $1 WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, chargeID, paymentID)
+	return err
+}
+
+func (r *paymentRepositoryImpl) SetReceiptRegistration(paymentID int, status string) error {
+	query := `UPDATE payments SET receipt_registration = $1 WHERE id = $2`
 	_, err := r.db.Exec(context.Background(), query, status, paymentID)
 	return err
 }
+
+func (r *paymentRepositoryImpl) MarkRefunded(paymentID int) error {
+	query := `UPDATE payments SET status = $1, refunded_at = NOW() WHERE id = $2 AND status = ANY($3)`
+	return r.transition(query, paymentID, domain.PaymentStatusRefunded)
+}
+
+func (r *paymentRepositoryImpl) MarkCanceled(paymentID int, party, reason string) error {
+	query := `UPDATE payments
+              SET status = $1, cancellation_party = $4, cancellation_reason = $5
+              WHERE id = $2 AND status = ANY($3)`
+	return r.transition(query, paymentID, domain.PaymentStatusCanceled, party, reason)
+}
+
+// transition выполняет query, переводящий платёж в статус status, только если
+// текущий статус допускает такой переход. Параметры query: $1 — новый статус,
+// $2 — id платежа, $3 — допустимые исходные статусы, далее — extra.
+func (r *paymentRepositoryImpl) transition(query string, paymentID int, status string, extra ...any) error {
+	from, ok := paymentTransitions[status]
+	if !ok {
+		return fmt.Errorf("%w: неизвестный статус %q", ErrInvalidPaymentTransition, status)
+	}
+
+	args := append([]any{status, paymentID, from}, extra...)
+	tag, err := r.db.Exec(context.Background(), query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: платёж %d -> %s", ErrInvalidPaymentTransition, paymentID, status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"vpn-bot/internal/domain"
+)
+
+type pendingDeliveryRepositoryImpl struct {
+	db DBTX
+}
+
+func NewPendingDeliveryRepository(db DBTX) PendingDeliveryRepository {
+	return &pendingDeliveryRepositoryImpl{db: db}
+}
+
+func (r *pendingDeliveryRepositoryImpl) Enqueue(userID, paymentID int) error {
+	query := `INSERT INTO pending_deliveries (user_id, payment_id, created_at)
+              VALUES ($1, $2, NOW())
+              ON CONFLICT (payment_id) DO NOTHING`
+	_, err := r.db.Exec(context.Background(), query, userID, paymentID)
+	return err
+}
+
+// LockOldestPending блокирует самую старую невыданную запись очереди.
+// Если очередь пуста, возвращает nil без ошибки.
+func (r *pendingDeliveryRepositoryImpl) LockOldestPending() (*domain.PendingDelivery, error) {
+	query := `SELECT id, user_id, payment_id, vpn_key_id, created_at, delivered_at
+              FROM pending_deliveries
+              WHERE delivered_at IS NULL
+              ORDER BY created_at, id
+              LIMIT 1
+              FOR UPDATE SKIP LOCKED`
+	row := r.db.QueryRow(context.Background(), query)
+
+	var d domain.PendingDelivery
+	err := row.Scan(&d.ID, &d.UserID, &d.PaymentID, &d.VPNKeyID, &d.CreatedAt, &d.DeliveredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *pendingDeliveryRepositoryImpl) MarkDelivered(deliveryID, keyID int) error {
+	query := `UPDATE pending_deliveries SET vpn_key_id = $1, delivered_at = NOW() WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, keyID, deliveryID)
+	return err
+}
+
+// CancelByPayment убирает из очереди невыданную запись платежа, например
+// после возврата или отмены.
+func (r *pendingDeliveryRepositoryImpl) CancelByPayment(paymentID int) error {
+	query := `DELETE FROM pending_deliveries WHERE payment_id = $1 AND delivered_at IS NULL`
+	_, err := r.db.Exec(context.Background(), query, paymentID)
+	return err
+}
+
+func (r *pendingDeliveryRepositoryImpl) CountPending() (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM pending_deliveries WHERE delivered_at IS NULL`
+	err := r.db.QueryRow(context.Background(), query).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"vpn-bot/internal/domain"
+)
+
+type planRepositoryImpl struct {
+	db DBTX
+}
+
+func NewPlanRepository(db DBTX) PlanRepository {
+	return &planRepositoryImpl{db: db}
+}
+
+func (r *planRepositoryImpl) GetActivePlans() ([]domain.Plan, error) {
+	query := `SELECT id, name, months, price, currency, COALESCE(stars_price, 0), is_active
+              FROM plans
+              WHERE is_active = true
+              ORDER BY months`
+	rows, err := r.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []domain.Plan
+	for rows.Next() {
+		var p domain.Plan
+		if err := rows.Scan(&p.ID, &p.Name, &p.Months, &p.Price, &p.Currency, &p.StarsPrice, &p.IsActive); err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+func (r *planRepositoryImpl) GetByID(planID int) (*domain.Plan, error) {
+	query := `SELECT id, name, months, price, currency, COALESCE(stars_price, 0), is_active
+              FROM plans
+              WHERE id = $1`
+	row := r.db.QueryRow(context.Background(), query, planID)
+
+	var p domain.Plan
+	err := row.Scan(&p.ID, &p.Name, &p.Months, &p.Price, &p.Currency, &p.StarsPrice, &p.IsActive)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Repositories — набор репозиториев, работающих в одной транзакции.
+type Repositories struct {
+	Users          UserRepository
+	VPNKeys        VPNKeyRepository
+	Payments       PaymentRepository
+	Anomalies      PaymentAnomalyRepository
+	Plans          PlanRepository
+	Deliveries     PendingDeliveryRepository
+	Notifications  NotificationRepository
+	WebhookEvents  WebhookEventRepository
+	WireGuardPeers WireGuardPeerRepository
+
+	hooks *txHooks
+}
+
+// txHooks — действия вне базы, которые зависят от исхода транзакции.
+type txHooks struct {
+	afterCommit []func()
+	onRollback  []func()
+}
+
+// AfterCommit откладывает fn до коммита транзакции: так делается то, что
+// нельзя отменить, например удаление клиента на VPN-сервере. Вне
+// UnitOfWork fn выполняется сразу.
+func (r Repositories) AfterCommit(fn func()) {
+	if r.hooks == nil {
+		fn()
+		return
+	}
+	r.hooks.afterCommit = append(r.hooks.afterCommit, fn)
+}
+
+// OnRollback регистрирует fn, которая отменяет уже сделанное вне базы,
+// если транзакция откатится. Вне UnitOfWork откатывать нечего.
+func (r Repositories) OnRollback(fn func()) {
+	if r.hooks == nil {
+		return
+	}
+	r.hooks.onRollback = append(r.hooks.onRollback, fn)
+}
+
+type unitOfWorkImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewUnitOfWork(db *pgxpool.Pool) UnitOfWork {
+	return &unitOfWorkImpl{db: db}
+}
+
+func (u *unitOfWorkImpl) Do(fn func(r Repositories) error) error {
+	ctx := context.Background()
+	tx, err := u.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Println("❌ Ошибка отката транзакции:", err)
+		}
+	}()
+
+	repos := Repositories{
+		Users:          NewUserRepository(tx),
+		VPNKeys:        NewVPNKeyRepository(tx),
+		Payments:       NewPaymentRepository(tx),
+		Anomalies:      NewPaymentAnomalyRepository(tx),
+		Plans:          NewPlanRepository(tx),
+		Deliveries:     NewPendingDeliveryRepository(tx),
+		Notifications:  NewNotificationRepository(tx),
+		WebhookEvents:  NewWebhookEventRepository(tx),
+		WireGuardPeers: NewWireGuardPeerRepository(tx),
+	}
+	return RunInTx(repos, func() error { return tx.Commit(ctx) }, fn)
+}
+
+// RunInTx вызывает fn с репозиториями транзакции r, фиксирует её через
+// commit и выполняет хуки по исходу: AfterCommit — после коммита, OnRollback —
+// если fn или commit вернули ошибку. Так же работают и поддельные
+// транзакции в тестах.
+func RunInTx(r Repositories, commit func() error, fn func(r Repositories) error) error {
+	r.hooks = &txHooks{}
+	if err := fn(r); err != nil {
+		r.hooks.rollback()
+		return err
+	}
+	if err := commit(); err != nil {
+		r.hooks.rollback()
+		return err
+	}
+	for _, hook := range r.hooks.afterCommit {
+		hook()
+	}
+	return nil
+}
+
+// rollback отменяет действия в обратном порядке, как defer.
+func (h *txHooks) rollback() {
+	for i := len(h.onRollback) - 1; i >= 0; i-- {
+		h.onRollback[i]()
+	}
+}
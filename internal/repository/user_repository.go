@@ -3,15 +3,15 @@ package repository
 import (
 	"context"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"vpn-bot/internal/domain"
 )
 
 type userRepositoryImpl struct {
-	db *pgxpool.Pool
+	db DBTX
 }
 
-func NewUserRepository(db *pgxpool.Pool) UserRepository {
+func NewUserRepository(db DBTX) UserRepository {
 	return &userRepositoryImpl{db: db}
 }
 
@@ -23,12 +23,60 @@ func (r *userRepositoryImpl) CreateUser(telegramID int64, username, chatLink str
 }
 
 func (r *userRepositoryImpl) GetByTelegramID(telegramID int64) (*domain.User, error) {
-	query := `SELECT id, telegram_id, username, chat_link, created_at
+	query := `SELECT id, telegram_id, username, chat_link, created_at,
+                     auto_renew, COALESCE(payment_method_id, ''), COALESCE(payment_method_provider, ''),
+                     COALESCE(email, ''), COALESCE(phone, '')
               FROM users WHERE telegram_id = $1 LIMIT 1`
-	row := r.db.QueryRow(context.Background(), query, telegramID)
+	return scanUser(r.db.QueryRow(context.Background(), query, telegramID))
+}
+
+func (r *userRepositoryImpl) GetByID(userID int) (*domain.User, error) {
+	query := `SELECT id, telegram_id, username, chat_link, created_at,
+                     auto_renew, COALESCE(payment_method_id, ''), COALESCE(payment_method_provider, ''),
+                     COALESCE(email, ''), COALESCE(phone, '')
+              FROM users WHERE id = $1`
+	return scanUser(r.db.QueryRow(context.Background(), query, userID))
+}
+
+// SetAutoRenew включает или отключает автопродление. При отключении
+// сохранённый способ оплаты забывается.
+func (r *userRepositoryImpl) SetAutoRenew(userID int, enabled bool) error {
+	query := `UPDATE users
+              SET auto_renew = $1,
+                  payment_method_id = CASE WHEN $1 THEN payment_method_id END,
+                  payment_method_provider = CASE WHEN $1 THEN payment_method_provider END
+              WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, enabled, userID)
+	return err
+}
+
+func (r *userRepositoryImpl) SavePaymentMethod(userID int, provider, paymentMethodID string) error {
+	query := `UPDATE users SET payment_method_id = $1, payment_method_provider = $2 WHERE id = $3`
+	_, err := r.db.Exec(context.Background(), query, paymentMethodID, provider, userID)
+	return err
+}
+
+func (r *userRepositoryImpl) ClearPaymentMethod(userID int) error {
+	query := `UPDATE users SET payment_method_id = NULL, payment_method_provider = NULL WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, userID)
+	return err
+}
+
+// SetContact сохраняет контакт для чеков; пустое значение не меняет
+// сохранённое.
+func (r *userRepositoryImpl) SetContact(userID int, email, phone string) error {
+	query := `UPDATE users
+              SET email = COALESCE(NULLIF($1, ''), email),
+                  phone = COALESCE(NULLIF($2, ''), phone)
+              WHERE id = $3`
+	_, err := r.db.Exec(context.Background(), query, email, phone, userID)
+	return err
+}
 
+func scanUser(row pgx.Row) (*domain.User, error) {
 	var u domain.User
-	err := row.Scan(&u.ID, &u.TelegramID, &u.Username, &u.ChatLink, &u.CreatedAt)
+	err := row.Scan(&u.ID, &u.TelegramID, &u.Username, &u.ChatLink, &u.CreatedAt,
+		&u.AutoRenew, &u.PaymentMethodID, &u.PaymentMethodProvider, &u.Email, &u.Phone)
 	if err != nil {
 		return nil, err
 	}
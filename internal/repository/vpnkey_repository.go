@@ -5,44 +5,144 @@ import (
 	"errors"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"vpn-bot/internal/domain"
 )
 
 type vpnKeyRepositoryImpl struct {
-	db *pgxpool.Pool
+	db DBTX
 }
 
-func NewVPNKeyRepository(db *pgxpool.Pool) VPNKeyRepository {
+func NewVPNKeyRepository(db DBTX) VPNKeyRepository {
 	return &vpnKeyRepositoryImpl{db: db}
 }
 
-func (r *vpnKeyRepositoryImpl) FindFreeKey() (*domain.VPNKey, error) {
-	query := `SELECT id, key, is_used
+// freeKeyCondition — ключ свободен, если он не выдан и не зарезервирован
+// (или срок резерва уже истёк).
+const freeKeyCondition = `is_used = false AND (reserved_until IS NULL OR reserved_until <= NOW())`
+
+// ClaimFreeKey атомарно назначает пользователю первый свободный ключ.
+// Строки, заблокированные параллельными транзакциями, пропускаются,
+// поэтому один ключ не может достаться двум платежам.
+func (r *vpnKeyRepositoryImpl) ClaimFreeKey(userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	query := `UPDATE vpn_keys
+              SET is_used = true, user_id = $1, expires_at = $2, status = 'active',
+                  reserved_payment_id = NULL, reserved_until = NULL
+              WHERE id = (
+                  SELECT id FROM vpn_keys
+                  WHERE ` + freeKeyCondition + `
+                  ORDER BY id
+                  LIMIT 1
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING id, key, is_used, user_id, expires_at, status, backend, COALESCE(client_id, '')`
+	return r.scanClaimedKey(r.db.QueryRow(context.Background(), query, userID, expiresAt))
+}
+
+// ReserveFreeKey удерживает свободный ключ за неоплаченным платежом до until.
+func (r *vpnKeyRepositoryImpl) ReserveFreeKey(paymentID int, until time.Time) (*domain.VPNKey, error) {
+	query := `UPDATE vpn_keys
+              SET reserved_payment_id = $1, reserved_until = $2
+              WHERE id = (
+                  SELECT id FROM vpn_keys
+                  WHERE ` + freeKeyCondition + `
+                  ORDER BY id
+                  LIMIT 1
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING id, key, is_used, user_id, expires_at, status, backend, COALESCE(client_id, '')`
+	return r.scanClaimedKey(r.db.QueryRow(context.Background(), query, paymentID, until))
+}
+
+// MoveUserReservation переносит действующий резерв пользователя на его
+// новый платёж, чтобы повторные нажатия «Купить» не занимали весь пул.
+// Если резерва нет, возвращает ErrNoFreeKeys.
+func (r *vpnKeyRepositoryImpl) MoveUserReservation(userID, paymentID int, until time.Time) (*domain.VPNKey, error) {
+	query := `UPDATE vpn_keys
+              SET reserved_payment_id = $2, reserved_until = $3
+              WHERE id = (
+                  SELECT vk.id FROM vpn_keys vk
+                  INNER JOIN payments p ON p.id = vk.reserved_payment_id
+                  WHERE p.user_id = $1 AND vk.is_used = false AND vk.reserved_until > NOW()
+                  ORDER BY vk.id
+                  LIMIT 1
+                  FOR UPDATE OF vk SKIP LOCKED
+              )
+              RETURNING id, key, is_used, user_id, expires_at, status, backend, COALESCE(client_id, '')`
+	return r.scanClaimedKey(r.db.QueryRow(context.Background(), query, userID, paymentID, until))
+}
+
+// ClaimReservedKey выдаёт пользователю ключ, зарезервированный за платежом.
+// Резерв учитывается и после истечения TTL, если ключ ещё никому не выдан.
+func (r *vpnKeyRepositoryImpl) ClaimReservedKey(paymentID, userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	query := `UPDATE vpn_keys
+              SET is_used = true, user_id = $2, expires_at = $3, status = 'active',
+                  reserved_payment_id = NULL, reserved_until = NULL
+              WHERE reserved_payment_id = $1 AND is_used = false
+              RETURNING id, key, is_used, user_id, expires_at, status, backend, COALESCE(client_id, '')`
+	return r.scanClaimedKey(r.db.QueryRow(context.Background(), query, paymentID, userID, expiresAt))
+}
+
+func (r *vpnKeyRepositoryImpl) ReleaseReservation(paymentID int) error {
+	query := `UPDATE vpn_keys
+              SET reserved_payment_id = NULL, reserved_until = NULL
+              WHERE reserved_payment_id = $1 AND is_used = false`
+	_, err := r.db.Exec(context.Background(), query, paymentID)
+	return err
+}
+
+func (r *vpnKeyRepositoryImpl) ReleaseExpiredReservations(now time.Time) (int, error) {
+	query := `UPDATE vpn_keys
+              SET reserved_payment_id = NULL, reserved_until = NULL
+              WHERE is_used = false AND reserved_until <= $1`
+	tag, err := r.db.Exec(context.Background(), query, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *vpnKeyRepositoryImpl) scanClaimedKey(row pgx.Row) (*domain.VPNKey, error) {
+	var vk domain.VPNKey
+	err := row.Scan(&vk.ID, &vk.Key, &vk.IsUsed, &vk.UserID, &vk.ExpiresAt, &vk.Status, &vk.Backend, &vk.ClientID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoFreeKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &vk, nil
+}
+
+func (r *vpnKeyRepositoryImpl) GetByID(keyID int) (*domain.VPNKey, error) {
+	query := `SELECT id, key, is_used, user_id, expires_at, status, backend, COALESCE(client_id, '')
               FROM vpn_keys
-              WHERE is_used = false
-              LIMIT 1`
-	row := r.db.QueryRow(context.Background(), query)
+              WHERE id = $1`
+	row := r.db.QueryRow(context.Background(), query, keyID)
 
 	var vk domain.VPNKey
-	err := row.Scan(&vk.ID, &vk.Key, &vk.IsUsed)
+	err := row.Scan(&vk.ID, &vk.Key, &vk.IsUsed, &vk.UserID, &vk.ExpiresAt, &vk.Status, &vk.Backend, &vk.ClientID)
 	if err != nil {
-		return nil, errors.New("нет свободных VPN-ключей")
+		return nil, err
 	}
 	return &vk, nil
 }
 
-func (r *vpnKeyRepositoryImpl) AssignKeyToUser(keyID, userID int, expiresAt time.Time) error {
-	query := `UPDATE vpn_keys
-              SET is_used = true, user_id = $1, expires_at = $2
-              WHERE id = $3`
-	_, err := r.db.Exec(context.Background(), query, userID, expiresAt, keyID)
+func (r *vpnKeyRepositoryImpl) ExtendKey(keyID int, expiresAt time.Time) error {
+	query := `UPDATE vpn_keys SET expires_at = $1, status = 'active' WHERE id = $2`
+	_, err := r.db.Exec(context.Background(), query, expiresAt, keyID)
+	return err
+}
+
+func (r *vpnKeyRepositoryImpl) RevokeKey(keyID int) error {
+	query := `UPDATE vpn_keys SET status = 'revoked', expires_at = NOW() WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, keyID)
 	return err
 }
 
 func (r *vpnKeyRepositoryImpl) GetKeysByTelegramID(telegramID int64) ([]domain.VPNKey, error) {
 	query := `
-        SELECT vk.id, vk.key, vk.is_used, vk.user_id, vk.expires_at
+        SELECT vk.id, vk.key, vk.is_used, vk.user_id, vk.expires_at, vk.status, vk.backend, COALESCE(vk.client_id, '')
         FROM vpn_keys vk
         INNER JOIN users u ON vk.user_id = u.id
         WHERE u.telegram_id = $1
@@ -56,7 +156,7 @@ func (r *vpnKeyRepositoryImpl) GetKeysByTelegramID(telegramID int64) ([]domain.V
 	var keys []domain.VPNKey
 	for rows.Next() {
 		var k domain.VPNKey
-		if err := rows.Scan(&k.ID, &k.Key, &k.IsUsed, &k.UserID, &k.ExpiresAt); err != nil {
+		if err := rows.Scan(&k.ID, &k.Key, &k.IsUsed, &k.UserID, &k.ExpiresAt, &k.Status, &k.Backend, &k.ClientID); err != nil {
 			return nil, err
 		}
 		keys = append(keys, k)
@@ -70,12 +170,164 @@ func (r *vpnKeyRepositoryImpl) AddKey(key string) error {
 	return err
 }
 
+// AddIssuedKey сохраняет ключ, созданный для пользователя на VPN-сервере.
+func (r *vpnKeyRepositoryImpl) AddIssuedKey(k *domain.VPNKey) error {
+	query := `INSERT INTO vpn_keys (key, is_used, user_id, expires_at, status, backend, client_id)
+              VALUES ($1, true, $2, $3, 'active', $4, $5)
+              RETURNING id, is_used, status`
+	row := r.db.QueryRow(context.Background(), query, k.Key, k.UserID, k.ExpiresAt, k.Backend, k.ClientID)
+	return row.Scan(&k.ID, &k.IsUsed, &k.Status)
+}
+
 func (r *vpnKeyRepositoryImpl) CountFreeKeys() (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM vpn_keys WHERE is_used = false`
+	query := `SELECT COUNT(*) FROM vpn_keys WHERE ` + freeKeyCondition
 	err := r.db.QueryRow(context.Background(), query).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
+
+func (r *vpnKeyRepositoryImpl) FindKeysExpiringBetween(from, to time.Time, notificationKind string) ([]domain.VPNKeyOwner, error) {
+	query := `
+        SELECT vk.id, vk.key, vk.is_used, vk.user_id, vk.expires_at, vk.status, vk.backend, COALESCE(vk.client_id, ''), u.telegram_id
+        FROM vpn_keys vk
+        INNER JOIN users u ON vk.user_id = u.id
+        WHERE vk.is_used = true
+          AND vk.status = 'active'
+          AND vk.expires_at > $1
+          AND vk.expires_at <= $2
+          AND NOT EXISTS (
+              SELECT 1 FROM key_notifications kn
+              WHERE kn.key_id = vk.id AND kn.kind = $3 AND kn.expires_at = vk.expires_at
+          )
+    `
+	return r.queryKeyOwners(query, from, to, notificationKind)
+}
+
+func (r *vpnKeyRepositoryImpl) MarkKeyNotified(keyID int, notificationKind string, expiresAt time.Time) error {
+	query := `INSERT INTO key_notifications (key_id, kind, expires_at, sent_at)
+              VALUES ($1, $2, $3, NOW())
+              ON CONFLICT (key_id, kind, expires_at) DO NOTHING`
+	_, err := r.db.Exec(context.Background(), query, keyID, notificationKind, expiresAt)
+	return err
+}
+
+// FindKeysForAutoRenew ищет ключи с включённым автопродлением, истекающие
+// в (from, to]. Тариф берётся из последней успешной оплаты ключа; попытка
+// списания отмечается в key_notifications с видом notificationKind.
+func (r *vpnKeyRepositoryImpl) FindKeysForAutoRenew(from, to time.Time, notificationKind string) ([]domain.AutoRenewal, error) {
+	query := `
+        SELECT vk.id, vk.key, vk.is_used, vk.user_id, vk.expires_at, vk.status, vk.backend, COALESCE(vk.client_id, ''), u.telegram_id,
+               p.plan_id, u.payment_method_id, u.payment_method_provider
+        FROM vpn_keys vk
+        INNER JOIN users u ON vk.user_id = u.id
+        INNER JOIN LATERAL (
+            SELECT plan_id FROM payments
+            WHERE vpn_key_id = vk.id AND status = 'succeeded' AND plan_id IS NOT NULL
+            ORDER BY created_at DESC
+            LIMIT 1
+        ) p ON true
+        WHERE vk.is_used = true
+          AND vk.status = 'active'
+          AND vk.expires_at > $1
+          AND vk.expires_at <= $2
+          AND u.auto_renew
+          AND u.payment_method_id IS NOT NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM key_notifications kn
+              WHERE kn.key_id = vk.id AND kn.kind = $3 AND kn.expires_at = vk.expires_at
+          )
+    `
+	rows, err := r.db.Query(context.Background(), query, from, to, notificationKind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var renewals []domain.AutoRenewal
+	for rows.Next() {
+		var a domain.AutoRenewal
+		err := rows.Scan(&a.ID, &a.Key, &a.IsUsed, &a.UserID, &a.ExpiresAt, &a.Status, &a.Backend, &a.ClientID, &a.TelegramID,
+			&a.PlanID, &a.PaymentMethodID, &a.Provider)
+		if err != nil {
+			return nil, err
+		}
+		renewals = append(renewals, a)
+	}
+	return renewals, rows.Err()
+}
+
+func (r *vpnKeyRepositoryImpl) FindExpiredKeys(now time.Time) ([]domain.VPNKeyOwner, error) {
+	query := `
+        SELECT vk.id, vk.key, vk.is_used, vk.user_id, vk.expires_at, vk.status, vk.backend, COALESCE(vk.client_id, ''), u.telegram_id
+        FROM vpn_keys vk
+        INNER JOIN users u ON vk.user_id = u.id
+        WHERE vk.is_used = true
+          AND vk.status = 'active'
+          AND vk.expires_at <= $1
+    `
+	return r.queryKeyOwners(query, now)
+}
+
+func (r *vpnKeyRepositoryImpl) MarkKeyExpired(keyID int) (bool, error) {
+	query := `UPDATE vpn_keys SET status = 'expired' WHERE id = $1 AND status = 'active'`
+	tag, err := r.db.Exec(context.Background(), query, keyID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *vpnKeyRepositoryImpl) ReleaseExpiredKeys(expiredBefore time.Time) (int, error) {
+	query := `UPDATE vpn_keys
+              SET is_used = false, user_id = NULL, expires_at = NULL, status = 'active'
+              WHERE status = 'expired' AND expires_at <= $1 AND backend = 'pool'`
+	tag, err := r.db.Exec(context.Background(), query, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// FindExpiredIssuedKeys ищет созданные на VPN-сервере ключи, истёкшие до
+// expiredBefore.
+func (r *vpnKeyRepositoryImpl) FindExpiredIssuedKeys(expiredBefore time.Time) ([]domain.VPNKey, error) {
+	query := `SELECT id, key, is_used, user_id, expires_at, status, backend, client_id
+              FROM vpn_keys
+              WHERE status = 'expired' AND expires_at <= $1 AND client_id IS NOT NULL`
+	rows, err := r.db.Query(context.Background(), query, expiredBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []domain.VPNKey
+	for rows.Next() {
+		var k domain.VPNKey
+		if err := rows.Scan(&k.ID, &k.Key, &k.IsUsed, &k.UserID, &k.ExpiresAt, &k.Status, &k.Backend, &k.ClientID); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *vpnKeyRepositoryImpl) queryKeyOwners(query string, args ...any) ([]domain.VPNKeyOwner, error) {
+	rows, err := r.db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []domain.VPNKeyOwner
+	for rows.Next() {
+		var k domain.VPNKeyOwner
+		if err := rows.Scan(&k.ID, &k.Key, &k.IsUsed, &k.UserID, &k.ExpiresAt, &k.Status, &k.Backend, &k.ClientID, &k.TelegramID); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
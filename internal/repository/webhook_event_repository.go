@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"vpn-bot/internal/domain"
+)
+
+type webhookEventRepositoryImpl struct {
+	db DBTX
+}
+
+func NewWebhookEventRepository(db DBTX) WebhookEventRepository {
+	return &webhookEventRepositoryImpl{db: db}
+}
+
+// Record сохраняет событие и заполняет e.ID. Если такое событие уже было,
+// в e подставляются ID и статус сохранённой записи, а created равен false.
+func (r *webhookEventRepositoryImpl) Record(e *domain.WebhookEvent) (bool, error) {
+	query := `INSERT INTO webhook_events (provider, event, object_id, payload, status, received_at)
+              VALUES ($1, $2, $3, $4, 'received', NOW())
+              ON CONFLICT (provider, event, object_id) DO NOTHING
+              RETURNING id, status`
+	err := r.db.QueryRow(context.Background(), query, e.Provider, e.Event, e.ObjectID, e.Payload).Scan(&e.ID, &e.Status)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+
+	query = `SELECT id, status FROM webhook_events WHERE provider = $1 AND event = $2 AND object_id = $3`
+	err = r.db.QueryRow(context.Background(), query, e.Provider, e.Event, e.ObjectID).Scan(&e.ID, &e.Status)
+	return false, err
+}
+
+// GetByIDForUpdate блокирует событие до конца транзакции: параллельная
+// доставка того же события дождётся коммита и увидит итоговый статус.
+func (r *webhookEventRepositoryImpl) GetByIDForUpdate(id int64) (*domain.WebhookEvent, error) {
+	query := `SELECT id, provider, event, object_id, payload, status, attempts, last_error, received_at, processed_at
+              FROM webhook_events
+              WHERE id = $1
+              FOR UPDATE`
+	var e domain.WebhookEvent
+	err := r.db.QueryRow(context.Background(), query, id).Scan(&e.ID, &e.Provider, &e.Event, &e.ObjectID, &e.Payload,
+		&e.Status, &e.Attempts, &e.LastError, &e.ReceivedAt, &e.ProcessedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *webhookEventRepositoryImpl) MarkProcessed(id int64) error {
+	query := `UPDATE webhook_events
+              SET status = 'processed', attempts = attempts + 1, last_error = '', processed_at = NOW()
+              WHERE id = $1`
+	_, err := r.db.Exec(context.Background(), query, id)
+	return err
+}
+
+// MarkFailed помечает событие как необработанное и возвращает число попыток.
+func (r *webhookEventRepositoryImpl) MarkFailed(id int64, lastError string) (int, error) {
+	query := `UPDATE webhook_events
+              SET status = 'failed', attempts = attempts + 1, last_error = $2
+              WHERE id = $1
+              RETURNING attempts`
+	var attempts int
+	err := r.db.QueryRow(context.Background(), query, id, lastError).Scan(&attempts)
+	return attempts, err
+}
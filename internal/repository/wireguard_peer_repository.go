@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+
+	"github.com/jackc/pgx/v5"
+	"vpn-bot/internal/domain"
+)
+
+const wireGuardPeerColumns = `id, public_key, preshared_key, host(address), name, enabled, created_at`
+
+type wireGuardPeerRepositoryImpl struct {
+	db DBTX
+}
+
+func NewWireGuardPeerRepository(db DBTX) WireGuardPeerRepository {
+	return &wireGuardPeerRepositoryImpl{db: db}
+}
+
+// wireGuardAllocateLock — ключ блокировки, которая выстраивает выдачу
+// адресов в очередь.
+const wireGuardAllocateLock = 25032510
+
+// Allocate перебирает адреса подсети по порядку, пропуская адрес сети,
+// адрес сервера и широковещательный, и занимает первый свободный. В
+// транзакции выдача адресов блокируется до её конца: иначе параллельная
+// транзакция не увидит занятый адрес и споткнётся о него.
+func (r *wireGuardPeerRepositoryImpl) Allocate(peer *domain.WireGuardPeer, subnet netip.Prefix) error {
+	if _, err := r.db.Exec(context.Background(), `SELECT pg_advisory_xact_lock($1)`, wireGuardAllocateLock); err != nil {
+		return err
+	}
+	subnet = subnet.Masked()
+	lastHost := int64(1)<<(subnet.Addr().BitLen()-subnet.Bits()) - 2
+	query := `INSERT INTO wireguard_peers (public_key, preshared_key, address, name, enabled, created_at)
+              SELECT $1, $2, c.address, $3, TRUE, NOW()
+              FROM (SELECT $4::inet + n AS address FROM generate_series(2, $5::bigint) AS n) c
+              WHERE NOT EXISTS (SELECT 1 FROM wireguard_peers p WHERE p.address = c.address)
+              ORDER BY c.address
+              LIMIT 1
+              ON CONFLICT (address) DO NOTHING
+              RETURNING ` + wireGuardPeerColumns
+	row := r.db.QueryRow(context.Background(), query,
+		peer.PublicKey, peer.PresharedKey, peer.Name, subnet.Addr().String(), lastHost)
+	allocated, err := scanWireGuardPeer(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNoFreeAddresses
+	}
+	if err != nil {
+		return err
+	}
+	*peer = *allocated
+	return nil
+}
+
+// GetByPublicKey возвращает nil, если пира нет.
+func (r *wireGuardPeerRepositoryImpl) GetByPublicKey(publicKey string) (*domain.WireGuardPeer, error) {
+	query := `SELECT ` + wireGuardPeerColumns + ` FROM wireguard_peers WHERE public_key = $1`
+	peer, err := scanWireGuardPeer(r.db.QueryRow(context.Background(), query, publicKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return peer, err
+}
+
+func (r *wireGuardPeerRepositoryImpl) SetEnabled(publicKey string, enabled bool) error {
+	query := `UPDATE wireguard_peers SET enabled = $2 WHERE public_key = $1`
+	_, err := r.db.Exec(context.Background(), query, publicKey, enabled)
+	return err
+}
+
+func (r *wireGuardPeerRepositoryImpl) Delete(publicKey string) error {
+	query := `DELETE FROM wireguard_peers WHERE public_key = $1`
+	_, err := r.db.Exec(context.Background(), query, publicKey)
+	return err
+}
+
+func (r *wireGuardPeerRepositoryImpl) ListEnabled() ([]domain.WireGuardPeer, error) {
+	query := `SELECT ` + wireGuardPeerColumns + ` FROM wireguard_peers WHERE enabled ORDER BY address`
+	rows, err := r.db.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peers []domain.WireGuardPeer
+	for rows.Next() {
+		peer, err := scanWireGuardPeer(rows)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, *peer)
+	}
+	return peers, rows.Err()
+}
+
+func scanWireGuardPeer(row pgx.Row) (*domain.WireGuardPeer, error) {
+	var p domain.WireGuardPeer
+	err := row.Scan(&p.ID, &p.PublicKey, &p.PresharedKey, &p.Address, &p.Name, &p.Enabled, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
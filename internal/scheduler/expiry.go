@@ -0,0 +1,204 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+)
+
+const (
+	notificationExpired = "expired"
+	// notificationAutoRenew отмечает попытку автопродления: по одному сроку
+	// действия ключа списание выполняется не больше одного раза.
+	notificationAutoRenew = "auto_renew"
+)
+
+type reminder struct {
+	kind   string
+	before time.Duration
+	text   string
+}
+
+// reminders упорядочены от ближайшего к дальнему: окно каждого напоминания
+// начинается там, где заканчивается окно предыдущего.
+var reminders = []reminder{
+	{kind: "reminder_1d", before: 24 * time.Hour, text: "⏳ Ваш VPN-ключ %s истекает завтра (%s). Продлите его через «Продлить ключ»."},
+	{kind: "reminder_3d", before: 3 * 24 * time.Hour, text: "⏳ Ваш VPN-ключ %s истекает через 3 дня (%s). Продлите его через «Продлить ключ»."},
+}
+
+// ExpiryScheduler напоминает об окончании подписки, помечает истёкшие ключи
+// и отключает их на VPN-сервере, снимает просроченные резервы и, если задан
+// GracePeriod, возвращает истёкшие ключи в пул свободных, а созданные на
+// сервере — удаляет с него. Если задан autoRenewBefore, за столько
+// до окончания ключи с автопродлением продлеваются списанием с карты.
+type ExpiryScheduler struct {
+	repo            repository.VPNKeyRepository
+	keys            service.VPNKeyService
+	notifier        service.Notifier
+	payments        service.PaymentService
+	interval        time.Duration
+	gracePeriod     time.Duration
+	autoRenewBefore time.Duration
+}
+
+func NewExpiryScheduler(
+	repo repository.VPNKeyRepository,
+	keys service.VPNKeyService,
+	notifier service.Notifier,
+	payments service.PaymentService,
+	interval, gracePeriod, autoRenewBefore time.Duration,
+) *ExpiryScheduler {
+	return &ExpiryScheduler{
+		repo:            repo,
+		keys:            keys,
+		notifier:        notifier,
+		payments:        payments,
+		interval:        interval,
+		gracePeriod:     gracePeriod,
+		autoRenewBefore: autoRenewBefore,
+	}
+}
+
+func (s *ExpiryScheduler) Run(ctx context.Context) {
+	log.Printf("⏰ Планировщик истечения ключей запущен (интервал %s)", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("⏰ Планировщик истечения ключей остановлен")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ExpiryScheduler) tick(now time.Time) {
+	// Автопродление идёт первым: продлённым ключам напоминания не нужны.
+	if s.autoRenewBefore > 0 {
+		s.autoRenew(now)
+	}
+	s.sendReminders(now)
+	s.expireKeys(now)
+	s.releaseReservations(now)
+	if s.gracePeriod > 0 {
+		s.releaseKeys(now)
+	}
+}
+
+func (s *ExpiryScheduler) sendReminders(now time.Time) {
+	from := now
+	for _, r := range reminders {
+		to := now.Add(r.before)
+		keys, err := s.repo.FindKeysExpiringBetween(from, to, r.kind)
+		if err != nil {
+			log.Printf("❌ Ошибка поиска ключей для напоминания %s: %v", r.kind, err)
+			return
+		}
+
+		for _, k := range keys {
+			text := fmt.Sprintf(r.text, k.Label(), k.ExpiresAt.Format("02.01.2006"))
+			s.notifyOnce(k, r.kind, text)
+		}
+		from = to
+	}
+}
+
+func (s *ExpiryScheduler) autoRenew(now time.Time) {
+	renewals, err := s.repo.FindKeysForAutoRenew(now, now.Add(s.autoRenewBefore), notificationAutoRenew)
+	if err != nil {
+		log.Println("❌ Ошибка поиска ключей для автопродления:", err)
+		return
+	}
+
+	for _, k := range renewals {
+		// Попытку отмечаем до списания: лучше пропустить автопродление, чем
+		// списать дважды, если бот упадёт между списанием и отметкой.
+		if err := s.repo.MarkKeyNotified(k.ID, notificationAutoRenew, *k.ExpiresAt); err != nil {
+			log.Printf("❌ Ошибка сохранения попытки автопродления ключа %d: %v", k.ID, err)
+			continue
+		}
+		if err := s.payments.AutoRenewKey(k); err != nil {
+			log.Printf("❌ Ошибка автопродления ключа %d: %v", k.ID, err)
+		}
+	}
+}
+
+func (s *ExpiryScheduler) expireKeys(now time.Time) {
+	keys, err := s.repo.FindExpiredKeys(now)
+	if err != nil {
+		log.Println("❌ Ошибка поиска истёкших ключей:", err)
+		return
+	}
+
+	for _, k := range keys {
+		expired, err := s.repo.MarkKeyExpired(k.ID)
+		if err != nil {
+			log.Printf("❌ Ошибка пометки ключа %d как истёкшего: %v", k.ID, err)
+			continue
+		}
+		if !expired {
+			continue
+		}
+
+		log.Printf("⌛ VPN-ключ %d истёк", k.ID)
+		if err := s.keys.SuspendKey(&k.VPNKey); err != nil {
+			log.Printf("❌ Ошибка отключения истёкшего ключа %d на VPN-сервере: %v", k.ID, err)
+		}
+		text := fmt.Sprintf("⌛ Срок действия VPN-ключа %s истёк. Продлите его через «Продлить ключ».", k.Label())
+		s.notifyOnce(k, notificationExpired, text)
+	}
+}
+
+func (s *ExpiryScheduler) releaseReservations(now time.Time) {
+	released, err := s.repo.ReleaseExpiredReservations(now)
+	if err != nil {
+		log.Println("❌ Ошибка снятия просроченных резервов:", err)
+		return
+	}
+	if released > 0 {
+		log.Printf("🔓 Снято просроченных резервов ключей: %d", released)
+	}
+}
+
+// releaseKeys возвращает в пул ключи, истёкшие больше gracePeriod назад,
+// а созданные на VPN-сервере удаляет с него.
+func (s *ExpiryScheduler) releaseKeys(now time.Time) {
+	expiredBefore := now.Add(-s.gracePeriod)
+	released, err := s.repo.ReleaseExpiredKeys(expiredBefore)
+	if err != nil {
+		log.Println("❌ Ошибка возврата истёкших ключей в пул:", err)
+	}
+	if released > 0 {
+		log.Printf("♻️ В пул свободных возвращено ключей: %d", released)
+	}
+
+	deleted, err := s.keys.DeleteExpiredKeys(expiredBefore)
+	if err != nil {
+		log.Println("❌ Ошибка удаления истёкших ключей с VPN-сервера:", err)
+	}
+	if deleted > 0 {
+		log.Printf("🗑 С VPN-сервера удалено истёкших ключей: %d", deleted)
+	}
+}
+
+// notifyOnce отправляет уведомление и запоминает его, чтобы после
+// перезапуска бот не отправил его повторно.
+func (s *ExpiryScheduler) notifyOnce(k domain.VPNKeyOwner, kind, text string) {
+	if err := s.notifier.Notify(k.TelegramID, text); err != nil {
+		log.Printf("❌ Ошибка отправки уведомления %s по ключу %d: %v", kind, k.ID, err)
+		return
+	}
+	if err := s.repo.MarkKeyNotified(k.ID, kind, *k.ExpiresAt); err != nil {
+		log.Printf("❌ Ошибка сохранения уведомления %s по ключу %d: %v", kind, k.ID, err)
+	}
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+)
+
+const (
+	outboxBatchSize   = 20
+	outboxMaxAttempts = 10
+	outboxBaseBackoff = 10 * time.Second
+	outboxMaxBackoff  = time.Hour
+	// outboxClaimLease — на сколько забранное уведомление скрыто от других
+	// отправителей; с запасом больше времени отправки пачки.
+	outboxClaimLease = 10 * time.Minute
+)
+
+// OutboxWorker доставляет уведомления из таблицы notifications. Временные
+// ошибки повторяются с экспоненциальной задержкой, ограничение частоты
+// Telegram (429) выдерживается целиком, а заблокировавшие бота получатели
+// помечаются как failed сразу. Об уведомлениях, не доставленных после всех
+// попыток, воркер сообщает администраторам adminIDs.
+type OutboxWorker struct {
+	uow      repository.UnitOfWork
+	sender   service.NotificationSender
+	adminIDs []int64
+	interval time.Duration
+	wake     chan struct{}
+
+	// pauseUntil — до какого момента Telegram просил не отправлять сообщения.
+	pauseUntil time.Time
+}
+
+func NewOutboxWorker(uow repository.UnitOfWork, sender service.NotificationSender, adminIDs []int64, interval time.Duration) *OutboxWorker {
+	return &OutboxWorker{
+		uow:      uow,
+		sender:   sender,
+		adminIDs: adminIDs,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake будит воркер, не дожидаясь следующего опроса. Не блокируется.
+func (w *OutboxWorker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *OutboxWorker) Run(ctx context.Context) {
+	log.Printf("📬 Доставка уведомлений запущена (интервал %s)", w.interval)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.drain()
+
+		select {
+		case <-ctx.Done():
+			log.Println("📬 Доставка уведомлений остановлена")
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// drain обрабатывает пачки, пока в outbox есть готовые к отправке уведомления.
+func (w *OutboxWorker) drain() {
+	for time.Now().After(w.pauseUntil) {
+		processed, err := w.processBatch()
+		if err != nil {
+			log.Println("❌ Ошибка обработки outbox:", err)
+			return
+		}
+		if processed < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// processBatch забирает пачку уведомлений в короткой транзакции и отправляет
+// их уже после коммита: блокировки не держатся на время запросов к Telegram.
+// Результат каждой отправки сохраняется отдельной транзакцией, так что ошибка
+// базы на одном уведомлении не приводит к повторной отправке остальных.
+func (w *OutboxWorker) processBatch() (int, error) {
+	var batch []domain.Notification
+	err := w.uow.Do(func(r repository.Repositories) error {
+		var err error
+		batch, err = r.Notifications.ClaimDue(outboxBatchSize, outboxClaimLease)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, n := range batch {
+		var retryAfter time.Duration
+		err := w.uow.Do(func(r repository.Repositories) error {
+			var err error
+			retryAfter, err = w.deliver(r.Notifications, n)
+			return err
+		})
+		if err != nil {
+			// Остальные уведомления пачки вернутся в очередь по истечении lease.
+			return i + 1, err
+		}
+		if retryAfter > 0 {
+			// Остальные сообщения пачки уйдут после паузы.
+			w.pauseUntil = time.Now().Add(retryAfter)
+			return i + 1, w.postpone(batch[i+1:])
+		}
+	}
+	return len(batch), nil
+}
+
+// postpone возвращает забранные, но не отправленные уведомления в очередь
+// к концу паузы, не засчитывая попытку.
+func (w *OutboxWorker) postpone(rest []domain.Notification) error {
+	if len(rest) == 0 {
+		return nil
+	}
+	return w.uow.Do(func(r repository.Repositories) error {
+		for _, n := range rest {
+			if err := r.Notifications.ScheduleRetry(n.ID, n.Attempts, w.pauseUntil, n.LastError); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deliver отправляет одно уведомление и сохраняет результат. Если Telegram
+// ограничил частоту, возвращает время, которое нужно подождать.
+func (w *OutboxWorker) deliver(repo repository.NotificationRepository, n domain.Notification) (time.Duration, error) {
+	sendErr := w.sender.Send(n)
+	if sendErr == nil {
+		return 0, repo.MarkSent(n.ID)
+	}
+
+	var rateLimited *service.RetryAfterError
+	switch {
+	case errors.As(sendErr, &rateLimited):
+		// Попытку не засчитываем: сообщение не виновато в лимите.
+		log.Printf("⏳ Telegram ограничил отправку, пауза %s", rateLimited.RetryAfter)
+		next := time.Now().Add(rateLimited.RetryAfter)
+		return rateLimited.RetryAfter, repo.ScheduleRetry(n.ID, n.Attempts, next, sendErr.Error())
+	case errors.Is(sendErr, service.ErrRecipientUnavailable):
+		log.Printf("🚫 Уведомление %d не доставлено, получатель %d недоступен: %v", n.ID, n.TelegramID, sendErr)
+		return 0, repo.MarkFailed(n.ID, sendErr.Error())
+	}
+
+	attempts := n.Attempts + 1
+	if attempts >= outboxMaxAttempts {
+		log.Printf("❌ Уведомление %d не доставлено после %d попыток: %v", n.ID, attempts, sendErr)
+		if err := repo.MarkFailed(n.ID, sendErr.Error()); err != nil {
+			return 0, err
+		}
+		return 0, w.reportFailure(repo, n, sendErr)
+	}
+
+	delay := backoff(attempts)
+	log.Printf("⚠️ Ошибка отправки уведомления %d (попытка %d), повтор через %s: %v", n.ID, attempts, delay, sendErr)
+	return 0, repo.ScheduleRetry(n.ID, attempts, time.Now().Add(delay), sendErr.Error())
+}
+
+// reportFailure передаёт администраторам уведомление, которое так и не
+// ушло пользователю: в нём мог быть оплаченный ключ. О сообщениях самим
+// администраторам не сообщаем, чтобы не зациклиться.
+func (w *OutboxWorker) reportFailure(repo repository.NotificationRepository, n domain.Notification, sendErr error) error {
+	if slices.Contains(w.adminIDs, n.TelegramID) {
+		return nil
+	}
+	text := fmt.Sprintf("⚠️ Уведомление %d пользователю %d не доставлено: %v\n\n%s", n.ID, n.TelegramID, sendErr, n.Text)
+	return service.NewOutboxNotifier(repo, w.adminIDs, nil).NotifyAdmins(text)
+}
+
+// backoff возвращает задержку перед следующей попыткой: 10с, 20с, 40с… но не больше часа.
+func backoff(attempts int) time.Duration {
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+)
+
+// reconcileWindow — насколько старые платежи ещё сверяются с провайдером:
+// ЮKassa держит платёж в waiting_for_capture до 7 дней.
+const reconcileWindow = 8 * 24 * time.Hour
+
+// PaymentReconciler сверяет с провайдерами платежи, которые дольше after
+// остаются незавершёнными: уведомление о них могло не дойти, пока бот был
+// недоступен. Статус применяется так же, как из уведомления.
+type PaymentReconciler struct {
+	repo     repository.PaymentRepository
+	payments service.PaymentService
+	interval time.Duration
+	after    time.Duration
+}
+
+func NewPaymentReconciler(
+	repo repository.PaymentRepository,
+	payments service.PaymentService,
+	interval, after time.Duration,
+) *PaymentReconciler {
+	return &PaymentReconciler{
+		repo:     repo,
+		payments: payments,
+		interval: interval,
+		after:    after,
+	}
+}
+
+func (r *PaymentReconciler) Run(ctx context.Context) {
+	log.Printf("🔍 Сверка платежей запущена (интервал %s)", r.interval)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.tick(time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Println("🔍 Сверка платежей остановлена")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *PaymentReconciler) tick(now time.Time) {
+	payments, err := r.repo.FindUnfinished(now.Add(-reconcileWindow), now.Add(-r.after))
+	if err != nil {
+		log.Println("❌ Ошибка поиска незавершённых платежей:", err)
+		return
+	}
+
+	for _, p := range payments {
+		if err := r.payments.SyncPayment(p.PaymentID); err != nil {
+			log.Printf("❌ Ошибка сверки платежа %s: %v", p.PaymentID, err)
+		}
+	}
+}
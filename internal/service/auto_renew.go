@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+)
+
+// autoRenewPrefix начинает временный ID платежа автопродления: под ним
+// платёж сохраняется до списания, и он же служит ключом идемпотентности.
+const autoRenewPrefix = "autorenew-"
+
+// Причины отмены автопродления, которое провайдер точно не списал.
+const (
+	reasonChargeRejected  = "charge_rejected"
+	reasonContactRequired = "receipt_contact_required"
+)
+
+// idempotenceKeyTTL — сколько ЮKassa помнит ключ идемпотентности. Позже
+// повтор списания с тем же ключом создаст новый платёж.
+const idempotenceKeyTTL = 24 * time.Hour
+
+// AutoRenewKey продлевает ключ списанием с сохранённого способа оплаты. Если
+// списать не удалось, пользователь получает ссылку для оплаты вручную.
+func (s *paymentServiceImpl) AutoRenewKey(renewal domain.AutoRenewal) error {
+	var plan *domain.Plan
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		plan, err = r.Plans.GetByID(renewal.PlanID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Ключ идемпотентности зависит только от ключа и его срока: сколько бы
+	// раз ни повторилось списание за этот срок, платёж будет один.
+	pay := &domain.Payment{
+		UserID:    *renewal.UserID,
+		Purpose:   domain.PaymentPurposeRenewal,
+		PaymentID: fmt.Sprintf("%s%d-%d", autoRenewPrefix, renewal.ID, renewal.ExpiresAt.Unix()),
+		Status:    domain.PaymentStatusPending,
+		VPNKeyID:  &renewal.ID,
+		PlanID:    &plan.ID,
+		Recurring: true,
+	}
+
+	recurring, err := s.saveRecurringPayment(pay, plan, renewal.Provider)
+	if err != nil {
+		log.Printf("❌ Не удалось списать автопродление ключа %d: %v", renewal.ID, err)
+		if offerErr := s.offerManualRenewal(pay, ""); offerErr != nil {
+			log.Printf("❌ Ошибка отправки ссылки на продление ключа %d: %v", renewal.ID, offerErr)
+		}
+		return err
+	}
+
+	return s.chargeSaved(pay, plan, recurring, renewal.TelegramID, renewal.PaymentMethodID)
+}
+
+// saveRecurringPayment рассчитывает сумму в валюте провайдера и сохраняет
+// платёж до списания, чтобы списание не осталось без записи.
+func (s *paymentServiceImpl) saveRecurringPayment(pay *domain.Payment, plan *domain.Plan, providerName string) (payment.Recurring, error) {
+	provider, recurring, err := s.recurringProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	pay.Provider = provider.Name()
+	pay.Currency = providerCurrency(provider, plan)
+	pay.Amount, err = plan.PriceIn(pay.Currency)
+	if err != nil {
+		return nil, err
+	}
+	err = s.uow.Do(func(r repository.Repositories) error {
+		return r.Payments.CreatePayment(pay)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// recurringProvider находит провайдера, сохранившего способ оплаты.
+func (s *paymentServiceImpl) recurringProvider(name string) (payment.Provider, payment.Recurring, error) {
+	provider, err := s.providers.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	recurring, ok := provider.(payment.Recurring)
+	if !ok {
+		return nil, nil, fmt.Errorf("провайдер %s не поддерживает автоплатежи", provider.Name())
+	}
+	return provider, recurring, nil
+}
+
+// chargeSaved списывает сохранённый платёж pay с ключом идемпотентности,
+// равным его временному ID, и записывает ID платежа у провайдера. Если
+// ответ провайдера потерялся, сверка платежей повторит списание с тем же
+// ключом, и второго платежа не будет. Отклонённое списание отменяется сразу.
+func (s *paymentServiceImpl) chargeSaved(pay *domain.Payment, plan *domain.Plan, recurring payment.Recurring, telegramID int64, paymentMethodID string) error {
+	user, err := s.userRepo.GetByID(pay.UserID)
+	if err != nil {
+		return err
+	}
+
+	info, err := recurring.ChargeSaved(payment.CreateRequest{
+		TelegramID:     telegramID,
+		Amount:         paymentAmount(pay),
+		Title:          "VPN: " + plan.Name,
+		Description:    "Автопродление VPN: " + plan.Name,
+		Customer:       customer(user),
+		Capture:        true,
+		IdempotenceKey: pay.PaymentID,
+	}, paymentMethodID)
+	if reason := chargeFailureReason(err); reason != "" {
+		// Списание точно не прошло: отменяем платёж, и пользователь сразу
+		// получает ссылку на оплату вручную.
+		log.Printf("❌ Автопродление по платежу %s отклонено: %v", pay.PaymentID, err)
+		return s.HandleCancellation(pay.PaymentID, "merchant", reason)
+	}
+	if err != nil {
+		log.Printf("❌ Не удалось списать автопродление по платежу %s, повторим при сверке: %v", pay.PaymentID, err)
+		return err
+	}
+
+	err = s.uow.Do(func(r repository.Repositories) error {
+		return r.Payments.SetProviderPaymentID(pay.ID, info.PaymentID)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("🔁 Автопродление по платежу %s: платёж %s в статусе %s", pay.PaymentID, info.PaymentID, info.Status)
+	pay.PaymentID = info.PaymentID
+
+	switch info.Status {
+	case domain.PaymentStatusSucceeded:
+		return s.confirmPaid(pay.PaymentID, info)
+	case domain.PaymentStatusCanceled:
+		return s.HandleCancellation(pay.PaymentID, info.CancellationParty, info.CancellationReason)
+	}
+	// Итоговый статус провайдер пришлёт уведомлением.
+	return nil
+}
+
+// chargeFailureReason возвращает причину отмены, если списание точно не
+// выполнено. Для потерянного ответа или сбоя на стороне провайдера она
+// пустая: такое списание повторяется с тем же ключом идемпотентности.
+func chargeFailureReason(err error) string {
+	switch {
+	case errors.Is(err, payment.ErrCustomerContactRequired):
+		return reasonContactRequired
+	case errors.Is(err, payment.ErrRejected):
+		return reasonChargeRejected
+	}
+	return ""
+}
+
+// resumeCharge повторяет списание автопродления, на которое провайдер не
+// ответил. Когда ключ идемпотентности уже забыт, повтор мог бы списать
+// второй раз, поэтому платёж отменяется и пользователь платит вручную.
+func (s *paymentServiceImpl) resumeCharge(pay *domain.Payment) error {
+	user, err := s.userRepo.GetByID(pay.UserID)
+	if err != nil {
+		return err
+	}
+	if time.Since(pay.CreatedAt) > idempotenceKeyTTL || user.PaymentMethodID == "" || user.PaymentMethodProvider != pay.Provider {
+		log.Printf("⚠️ Списание автопродления по платежу %s не подтверждено, отменяем", pay.PaymentID)
+		return s.HandleCancellation(pay.PaymentID, "merchant", "")
+	}
+
+	var plan *domain.Plan
+	err = s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		plan, err = paymentPlan(r.Plans, pay)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, recurring, err := s.recurringProvider(pay.Provider)
+	if err != nil {
+		return err
+	}
+	return s.chargeSaved(pay, plan, recurring, user.TelegramID, user.PaymentMethodID)
+}
+
+// offerManualRenewal сообщает, что автопродление не прошло, и присылает
+// ссылку на обычную оплату продления.
+func (s *paymentServiceImpl) offerManualRenewal(pay *domain.Payment, reason string) error {
+	user, err := s.userRepo.GetByID(pay.UserID)
+	if err != nil {
+		return err
+	}
+	text := "❌ Не удалось автоматически продлить VPN-ключ" + cancellationText(reason) + "."
+
+	var plan *domain.Plan
+	err = s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		plan, err = paymentPlan(r.Plans, pay)
+		return err
+	})
+	if err != nil || pay.VPNKeyID == nil {
+		return s.notifier.Notify(user.TelegramID, text+" Продлите его через «Продлить ключ».")
+	}
+
+	checkout, err := s.CreateRenewalPayment(pay.UserID, *pay.VPNKeyID, plan)
+	switch {
+	case err != nil:
+		log.Printf("❌ Ошибка создания платежа на продление ключа %d: %v", *pay.VPNKeyID, err)
+		text += " Продлите его через «Продлить ключ»."
+	case checkout.ConfirmationURL == "":
+		// Счёт уже отправлен в чат платежами Telegram.
+		text += " Оплатите продление по счёту выше."
+	default:
+		text += " Оплатите продление по ссылке: " + checkout.ConfirmationURL
+	}
+	return s.notifier.Notify(user.TelegramID, text)
+}
+
+// savePaymentMethod запоминает способ оплаты, сохранённый провайдером при
+// оплате, если пользователь не отключил автопродление, пока платил.
+func (s *paymentServiceImpl) savePaymentMethod(r repository.Repositories, pay *domain.Payment, paymentMethodID string) error {
+	if paymentMethodID == "" {
+		return nil
+	}
+	user, err := r.Users.GetByID(pay.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.AutoRenew {
+		return nil
+	}
+	if err := r.Users.SavePaymentMethod(pay.UserID, pay.Provider, paymentMethodID); err != nil {
+		return err
+	}
+	log.Printf("💾 Для пользователя %d сохранён способ оплаты для автопродления", pay.UserID)
+	return nil
+}
@@ -0,0 +1,98 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+	"vpn-bot/internal/service/servicetest"
+)
+
+func TestAutoRenewFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		chargeErr error
+		canceled  bool
+	}{
+		{"списание отклонено", fmt.Errorf("%w: Ошибка от YooKassa: 403", payment.ErrRejected), true},
+		{"нет контакта для чека", payment.ErrCustomerContactRequired, true},
+		{"ответ потерян", errors.New("context deadline exceeded"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const (
+				userID     = 7
+				telegramID = 700100
+			)
+			planID := 1
+			expiresAt := time.Now().AddDate(0, 0, 2)
+
+			users := &fakeUsers{user: domain.User{ID: userID, TelegramID: telegramID, AutoRenew: true, PaymentMethodID: "pm-1", PaymentMethodProvider: "fake"}}
+			payments := &fakePayments{}
+			uow := &fakeUnitOfWork{repos: repository.Repositories{
+				Users:      users,
+				Payments:   payments,
+				Plans:      &fakePlans{plan: domain.Plan{ID: planID, Name: "1 месяц", Months: 1, Price: 199, Currency: "RUB"}},
+				VPNKeys:    &fakeVPNKeys{},
+				Deliveries: &fakeDeliveries{},
+			}}
+			provider := &fakeProvider{chargeErr: tt.chargeErr}
+			providers, err := payment.NewRegistry("fake", nil, provider)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notifier := servicetest.NewFakeNotifier()
+			svc := service.NewPaymentService(uow, payments, users, notifier, providers,
+				service.NewPoolProvisioner(&fakeVPNKeys{}), false, time.Hour, "", service.DescriptionTemplates{})
+
+			renewal := domain.AutoRenewal{
+				VPNKeyOwner:     domain.VPNKeyOwner{VPNKey: domain.VPNKey{ID: 3, UserID: &users.user.ID, ExpiresAt: &expiresAt}, TelegramID: telegramID},
+				PlanID:          planID,
+				PaymentMethodID: "pm-1",
+				Provider:        "fake",
+			}
+			autoRenewErr := svc.AutoRenewKey(renewal)
+
+			pay := payments.byID(1)
+			if pay == nil || !pay.Recurring {
+				t.Fatalf("платёж автопродления не сохранён до списания: %+v", payments.payments)
+			}
+			if provider.charges != 1 {
+				t.Errorf("списаний %d, ожидалось 1", provider.charges)
+			}
+			sent := notifier.SentTo(telegramID)
+
+			if !tt.canceled {
+				if autoRenewErr == nil {
+					t.Error("ошибка списания не возвращена")
+				}
+				if pay.Status != domain.PaymentStatusPending {
+					t.Errorf("статус %q, платёж должен ждать повторного списания", pay.Status)
+				}
+				if len(sent) != 0 {
+					t.Errorf("пользователь получил сообщения до повтора списания: %q", sent)
+				}
+				return
+			}
+
+			if autoRenewErr != nil {
+				t.Errorf("AutoRenewKey: %v", autoRenewErr)
+			}
+			if pay.Status != domain.PaymentStatusCanceled {
+				t.Errorf("статус %q, ожидался %q", pay.Status, domain.PaymentStatusCanceled)
+			}
+			if len(sent) != 1 || !strings.Contains(sent[0], "https://pay.example/manual-1") {
+				t.Errorf("пользователь не получил ссылку на оплату вручную: %q", sent)
+			}
+			if manual := payments.get("manual-1"); manual == nil || manual.Purpose != domain.PaymentPurposeRenewal {
+				t.Errorf("платёж на продление вручную не создан: %+v", manual)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+// ErrNoFreeKeys возвращается, когда в пуле не осталось ключей для выдачи или резерва.
+var ErrNoFreeKeys = repository.ErrNoFreeKeys
+
+// ErrVPNNotSupported — у VPN-сервера или ключа нет такой операции, например
+// статистики трафика у ключей из пула.
+var ErrVPNNotSupported = vpn.ErrNotSupported
+
+// ErrPaymentNotFound — платежа нет или он принадлежит другому пользователю.
+var ErrPaymentNotFound = repository.ErrPaymentNotFound
+
+// ErrInvalidWebhook — тело вебхука не удалось разобрать.
+var ErrInvalidWebhook = payment.ErrInvalidEvent
+
+// ErrWebhookNotConfirmed — API провайдера не подтвердило событие из вебхука:
+// статус, сумма или валюта в API не совпадают с телом вебхука.
+var ErrWebhookNotConfirmed = payment.ErrEventNotConfirmed
+
+// ErrInvalidWebhookSignature — подпись вебхука не совпала.
+var ErrInvalidWebhookSignature = payment.ErrInvalidSignature
+
+// ErrContactRequired — для чека нужен email или телефон пользователя.
+var ErrContactRequired = payment.ErrCustomerContactRequired
+
+// ErrInvalidContact — пользователь прислал не email и не телефон.
+var ErrInvalidContact = errors.New("ожидается email или номер телефона")
+
+// ErrRecipientUnavailable — получатель заблокировал бота или чат не существует;
+// повторять отправку бессмысленно.
+var ErrRecipientUnavailable = errors.New("получатель недоступен")
+
+// RetryAfterError — Telegram ограничил частоту отправки (HTTP 429).
+type RetryAfterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("слишком много запросов, повторить через %s", e.RetryAfter)
+}
@@ -1,20 +1,94 @@
 package service
 
-import "vpn-bot/internal/domain"
+import (
+	"net/http"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
 
 type UserService interface {
 	RegisterUser(telegramID int64, username, chatLink string) error
 	GetUserByTelegramID(telegramID int64) (*domain.User, error)
+	SetAutoRenew(telegramID int64, enabled bool) (*domain.User, error)
+	SetReceiptContact(telegramID int64, contact string) error
 }
 
 type VPNKeyService interface {
-	AssignFreeKeyToUser(userID int) (string, error)
 	GetKeysByUserTelegramID(telegramID int64) ([]domain.VPNKey, error)
 	AddNewKey(key string) error
+	AddNewKeys(keys []string) (int, error)
+	DeliverPending() (int, error)
+	HasFreeKeys() (bool, error)
+	GetKeyUsage(key *domain.VPNKey) (*vpn.Usage, error)
+	SuspendKey(key *domain.VPNKey) error
+	DeleteExpiredKeys(expiredBefore time.Time) (int, error)
+}
+
+// VPNProvisioner выдаёт пользователям VPN-ключи и управляет ими: берёт их
+// из пула или создаёт на VPN-сервере. Выданный ключ сохраняется в vpn_keys.
+type VPNProvisioner interface {
+	CreateClient(userID int, expiresAt time.Time) (*domain.VPNKey, error)
+	RevokeClient(key *domain.VPNKey) error
+	ExtendClient(key *domain.VPNKey, expiresAt time.Time) error
+	// SuspendClient отключает истёкший ключ, если сервер не делает этого сам.
+	SuspendClient(key *domain.VPNKey) error
+	Usage(key *domain.VPNKey) (*vpn.Usage, error)
+	// WithTx возвращает VPNProvisioner, сохраняющий ключи в транзакции r и
+	// согласующий изменения на VPN-сервере с её исходом.
+	WithTx(r repository.Repositories) VPNProvisioner
+}
+
+// VPNKeyPool реализует VPNProvisioner с конечным запасом ключей: перед
+// покупкой проверяется, что ключи есть, а при оформлении ключ резервируется
+// за платежом. У пользователя не больше одного действующего резерва.
+type VPNKeyPool interface {
 	HasFreeKeys() (bool, error)
+	ReserveKey(userID, paymentID int, until time.Time) (*domain.VPNKey, error)
+	ClaimReservedKey(paymentID, userID int, expiresAt time.Time) (*domain.VPNKey, error)
 }
 
 type PaymentService interface {
-	CreatePayment(userID int, amount float64, description string) (string, error)
-	ConfirmPayment(paymentID string) error
+	CreatePayment(userID int, plan *domain.Plan) (*Checkout, error)
+	CreateRenewalPayment(userID, keyID int, plan *domain.Plan) (*Checkout, error)
+	HandleRefund(paymentID string) error
+	HandleWaitingForCapture(paymentID string) error
+	HandleCancellation(paymentID, party, reason string) error
+	CapturePayment(paymentID string) error
+	CancelPayment(paymentID string) error
+	RefundPayment(paymentID string) error
+	PlanPrice(plan *domain.Plan) (float64, string, error)
+	HandleWebhook(provider string, header http.Header, payload []byte) error
+	HandleEvent(provider string, event *payment.Event) error
+	HandleInvoicePayment(event *payment.Event) error
+	CheckPreCheckout(paymentID string, amount payment.Amount) error
+	ReplayWebhookEvent(eventID int64) error
+	AutoRenewKey(renewal domain.AutoRenewal) error
+	CheckPayment(telegramID int64, returnToken string) (*domain.Payment, error)
+	SyncPayment(paymentID string) error
+}
+
+type PlanService interface {
+	GetActivePlans() ([]domain.Plan, error)
+	GetActivePlan(planID int) (*domain.Plan, error)
+}
+
+// Notifier доставляет сообщения пользователям по их Telegram ID.
+type Notifier interface {
+	Notify(telegramID int64, text string) error
+	NotifyMarkdown(telegramID int64, text string) error
+	// NotifyDocument отправляет файл name с подписью caption.
+	NotifyDocument(telegramID int64, caption, name string, data []byte) error
+	// NotifyPhoto отправляет картинку PNG с подписью caption в Markdown.
+	NotifyPhoto(telegramID int64, caption string, photo []byte) error
+	NotifyAdmins(text string) error
+}
+
+// NotificationSender отправляет одно уведомление из outbox в Telegram.
+// Ошибки ErrRecipientUnavailable и *RetryAfterError обрабатываются воркером особо.
+type NotificationSender interface {
+	Send(n domain.Notification) error
 }
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+)
+
+// TxNotifier — Notifier, который умеет записывать уведомления в транзакции
+// UnitOfWork, чтобы они сохранялись вместе с бизнес-изменением.
+type TxNotifier interface {
+	Notifier
+	WithTx(r repository.Repositories) Notifier
+}
+
+// notifierInTx возвращает Notifier, пишущий в транзакцию r, если это
+// поддерживается, иначе сам n.
+func notifierInTx(n Notifier, r repository.Repositories) Notifier {
+	if tn, ok := n.(TxNotifier); ok {
+		return tn.WithTx(r)
+	}
+	return n
+}
+
+// outboxNotifier не отправляет сообщения сам, а складывает их в таблицу
+// notifications; доставкой занимается scheduler.OutboxWorker.
+type outboxNotifier struct {
+	repo     repository.NotificationRepository
+	adminIDs []int64
+	wake     func()
+}
+
+// NewOutboxNotifier создаёт Notifier поверх outbox. wake вызывается после
+// каждой записи, чтобы разбудить воркер доставки; может быть nil.
+func NewOutboxNotifier(repo repository.NotificationRepository, adminIDs []int64, wake func()) TxNotifier {
+	return &outboxNotifier{repo: repo, adminIDs: adminIDs, wake: wake}
+}
+
+func (n *outboxNotifier) Notify(telegramID int64, text string) error {
+	return n.enqueue(&domain.Notification{TelegramID: telegramID, Text: text})
+}
+
+func (n *outboxNotifier) NotifyMarkdown(telegramID int64, text string) error {
+	return n.enqueue(&domain.Notification{TelegramID: telegramID, Text: text, ParseMode: "Markdown"})
+}
+
+func (n *outboxNotifier) NotifyDocument(telegramID int64, caption, name string, data []byte) error {
+	return n.enqueue(&domain.Notification{
+		TelegramID:   telegramID,
+		Text:         caption,
+		DocumentName: name,
+		Document:     data,
+	})
+}
+
+func (n *outboxNotifier) NotifyPhoto(telegramID int64, caption string, photo []byte) error {
+	return n.enqueue(&domain.Notification{
+		TelegramID: telegramID,
+		Text:       caption,
+		ParseMode:  "Markdown",
+		Photo:      photo,
+	})
+}
+
+func (n *outboxNotifier) NotifyAdmins(text string) error {
+	for _, id := range n.adminIDs {
+		if err := n.enqueue(&domain.Notification{TelegramID: id, Text: text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *outboxNotifier) WithTx(r repository.Repositories) Notifier {
+	return &outboxNotifier{repo: r.Notifications, adminIDs: n.adminIDs, wake: n.wake}
+}
+
+func (n *outboxNotifier) enqueue(notification *domain.Notification) error {
+	if err := n.repo.Enqueue(notification); err != nil {
+		return err
+	}
+	if n.wake != nil {
+		n.wake()
+	}
+	return nil
+}
@@ -1,159 +1,800 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"io"
 	"log"
-	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
 	"vpn-bot/internal/repository"
 )
 
+// defaultPlan используется для платежей, созданных до появления тарифов.
+var defaultPlan = &domain.Plan{Name: "1 месяц", Months: 1}
+
 type paymentServiceImpl struct {
-	repo          repository.PaymentRepository
-	vpnKeyService VPNKeyService
+	uow       repository.UnitOfWork
+	repo      repository.PaymentRepository
+	userRepo  repository.UserRepository
+	notifier  Notifier
+	providers *payment.Registry
+
+	provisioner    VPNProvisioner
+	manualCapture  bool
+	reservationTTL time.Duration
+	returnURL      string
+	descriptions   DescriptionTemplates
+}
 
-	yooShopID string
-	yooSecret string
+// DescriptionTemplates — шаблоны описания платежа у провайдера. Подстановки:
+// {plan} — название тарифа, {months} — срок в месяцах, {user} — Telegram ID
+// покупателя.
+type DescriptionTemplates struct {
+	Purchase string
+	Renewal  string
 }
 
-type yooCreatePaymentRequest struct {
-	Amount struct {
-		Value    string `json:"value"`
-		Currency string `json:"currency"`
-	} `json:"amount"`
-	Capture      bool   `json:"capture"`
-	Description  string `json:"description"`
-	Confirmation struct {
-		Type      string `json:"type"`
-		ReturnURL string `json:"return_url"`
-	} `json:"confirmation"`
+// Checkout — созданный платёж. Пустой ConfirmationURL означает, что провайдер
+// сам отправил пользователю счёт; по ReturnToken пользователь проверяет оплату.
+type Checkout struct {
+	ConfirmationURL string
+	ReturnToken     string
 }
 
-type yooCreatePaymentResponse struct {
-	ID           string `json:"id"`
-	Status       string `json:"status"`
-	Confirmation struct {
-		Type            string `json:"type"`
-		ConfirmationURL string `json:"confirmation_url"`
-	} `json:"confirmation"`
+// cancellationReasons — описания причин отмены из cancellation_details ЮKassa.
+var cancellationReasons = map[string]string{
+	"3d_secure_failed":              "не пройдена аутентификация 3-D Secure",
+	"call_issuer":                   "оплата отклонена банком, обратитесь в банк",
+	"canceled_by_merchant":          "платёж отменён магазином",
+	"card_expired":                  "истёк срок действия карты",
+	"country_forbidden":             "оплата картой этой страны недоступна",
+	"expired_on_capture":            "истёк срок подтверждения платежа",
+	"expired_on_confirmation":       "истекло время на оплату",
+	"fraud_suspected":               "платёж заблокирован из-за подозрения в мошенничестве",
+	"general_decline":               "оплата отклонена",
+	"identification_required":       "превышены лимиты кошелька без идентификации",
+	"insufficient_funds":            "недостаточно средств",
+	"invalid_card_number":           "неверный номер карты",
+	"invalid_csc":                   "неверный CVV/CVC код",
+	"issuer_unavailable":            "банк недоступен",
+	"payment_method_limit_exceeded": "исчерпан лимит платежей",
+	"payment_method_restricted":     "операции данным способом оплаты запрещены",
+	"permission_revoked":            "отозвано разрешение на автоплатежи",
+	"internal_timeout":              "технические неполадки, попробуйте ещё раз",
+
+	// Причины, по которым бот сам отменяет списание автопродления.
+	reasonChargeRejected:  "платёжная система отклонила списание",
+	reasonContactRequired: "для чека нужен email или телефон",
 }
 
 func NewPaymentService(
+	uow repository.UnitOfWork,
 	payRepo repository.PaymentRepository,
-	vpnService VPNKeyService,
-	shopID, secret string,
+	userRepo repository.UserRepository,
+	notifier Notifier,
+	providers *payment.Registry,
+	provisioner VPNProvisioner,
+	manualCapture bool,
+	reservationTTL time.Duration,
+	returnURL string,
+	descriptions DescriptionTemplates,
 ) PaymentService {
 	return &paymentServiceImpl{
-		repo:          payRepo,
-		vpnKeyService: vpnService,
-		yooShopID:     shopID,
-		yooSecret:     secret,
+		uow:       uow,
+		repo:      payRepo,
+		userRepo:  userRepo,
+		notifier:  notifier,
+		providers: providers,
+
+		provisioner:    provisioner,
+		manualCapture:  manualCapture,
+		reservationTTL: reservationTTL,
+		returnURL:      returnURL,
+		descriptions:   descriptions,
 	}
 }
 
-func (s *paymentServiceImpl) CreatePayment(
-	userID int,
-	amount float64,
-	description string,
-) (string, error) {
+func (s *paymentServiceImpl) CreatePayment(userID int, plan *domain.Plan) (*Checkout, error) {
+	return s.createPayment(&domain.Payment{
+		UserID:  userID,
+		Purpose: domain.PaymentPurposePurchase,
+		PlanID:  &plan.ID,
+	}, plan, s.descriptions.Purchase)
+}
 
-	reqBody := yooCreatePaymentRequest{}
-	reqBody.Amount.Value = fmt.Sprintf("%.2f", amount)
-	reqBody.Amount.Currency = "RUB"
-	reqBody.Capture = true
-	reqBody.Description = description
-	reqBody.Confirmation.Type = "redirect"
-	reqBody.Confirmation.ReturnURL = "https://ramcache.online/payment-success"
+func (s *paymentServiceImpl) CreateRenewalPayment(userID, keyID int, plan *domain.Plan) (*Checkout, error) {
+	return s.createPayment(&domain.Payment{
+		UserID:   userID,
+		Purpose:  domain.PaymentPurposeRenewal,
+		VPNKeyID: &keyID,
+		PlanID:   &plan.ID,
+	}, plan, s.descriptions.Renewal)
+}
 
-	bodyBytes, err := json.Marshal(reqBody)
+// createPayment создаёт платёж у провайдера тарифа и сохраняет его.
+func (s *paymentServiceImpl) createPayment(pay *domain.Payment, plan *domain.Plan, descriptionTemplate string) (*Checkout, error) {
+	user, err := s.userRepo.GetByID(pay.UserID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	token, err := newReturnToken()
+	if err != nil {
+		return nil, err
+	}
+	pay.ReturnToken = &token
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("POST", "https://api.yookassa.ru/v3/payments", bytes.NewReader(bodyBytes))
+	provider := s.providers.ForPlan(plan.ID)
+	pay.Currency = providerCurrency(provider, plan)
+	pay.Amount, err = plan.PriceIn(pay.Currency)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.SetBasicAuth(s.yooShopID, s.yooSecret)
-	req.Header.Set("Idempotence-Key", fmt.Sprintf("my-key-%d", time.Now().UnixNano()))
-	req.Header.Set("Content-Type", "application/json")
+	checkout, err := provider.CreatePayment(payment.CreateRequest{
+		TelegramID:  user.TelegramID,
+		Amount:      paymentAmount(pay),
+		Title:       "VPN: " + plan.Name,
+		Description: describePayment(descriptionTemplate, plan, user),
+		Customer:    customer(user),
+		ReturnURL:   strings.ReplaceAll(s.returnURL, "{payment}", token),
+		Capture:     !s.manualCapture,
+		// Способ оплаты сохраняется, только если пользователь включил автопродление.
+		SavePaymentMethod: user.AutoRenew,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pay.Provider = provider.Name()
+	pay.PaymentID = checkout.PaymentID
+	pay.Status = checkout.Status
 
-	resp, err := client.Do(req)
+	// Покупка сразу резервирует ключ: если к моменту оплаты пул опустеет,
+	// оплативший пользователь всё равно получит свой ключ.
+	err = s.uow.Do(func(r repository.Repositories) error {
+		if err := r.Payments.CreatePayment(pay); err != nil {
+			return err
+		}
+		pool, ok := s.provisioner.WithTx(r).(VPNKeyPool)
+		if pay.Purpose != domain.PaymentPurposePurchase || !ok {
+			return nil
+		}
+		key, err := pool.ReserveKey(pay.UserID, pay.ID, time.Now().Add(s.reservationTTL))
+		if err != nil {
+			return err
+		}
+		log.Printf("🔒 VPN-ключ %d зарезервирован за платежом %s", key.ID, pay.PaymentID)
+		return nil
+	})
 	if err != nil {
-		return "", err
+		// Ссылку на оплату пользователь не получит, а неоплаченный платёж провайдер отменит сам.
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		errBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Ошибка от YooKassa: %d %s", resp.StatusCode, string(errBody))
+	return &Checkout{ConfirmationURL: checkout.ConfirmationURL, ReturnToken: token}, nil
+}
+
+// PlanPrice возвращает цену тарифа в валюте провайдера, которым он оплачивается.
+func (s *paymentServiceImpl) PlanPrice(plan *domain.Plan) (float64, string, error) {
+	currency := providerCurrency(s.providers.ForPlan(plan.ID), plan)
+	price, err := plan.PriceIn(currency)
+	return price, currency, err
+}
+
+func providerCurrency(provider payment.Provider, plan *domain.Plan) string {
+	if fc, ok := provider.(payment.FixedCurrency); ok {
+		return fc.Currency()
 	}
+	return plan.Currency
+}
+
+// describePayment подставляет в шаблон описания тариф и покупателя.
+func describePayment(template string, plan *domain.Plan, user *domain.User) string {
+	return strings.NewReplacer(
+		"{plan}", plan.Name,
+		"{months}", strconv.Itoa(plan.Months),
+		"{user}", strconv.FormatInt(user.TelegramID, 10),
+	).Replace(template)
+}
 
-	var yooResp yooCreatePaymentResponse
-	if err := json.NewDecoder(resp.Body).Decode(&yooResp); err != nil {
+func newReturnToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
+	return hex.EncodeToString(b), nil
+}
+
+// customer — контакт пользователя для чека.
+func customer(user *domain.User) payment.Customer {
+	return payment.Customer{Email: user.Email, Phone: user.Phone}
+}
 
-	paymentID := yooResp.ID
-	status := yooResp.Status
-	confirmationURL := yooResp.Confirmation.ConfirmationURL
+// paymentAmount — сумма платежа в формате провайдеров.
+func paymentAmount(pay *domain.Payment) payment.Amount {
+	return payment.Amount{Value: fmt.Sprintf("%.2f", pay.Amount), Currency: pay.Currency}
+}
 
-	err = s.repo.CreatePayment(userID, amount, status, paymentID)
+// confirmation — итог подтверждения платежа. keyErr — ошибка продления,
+// которая не отменяет фиксацию оплаты: её разбирает администратор.
+// anomaly — оплачена не та сумма, ключ не выдан.
+type confirmation struct {
+	pay     *domain.Payment
+	paid    payment.Amount
+	key     *domain.VPNKey
+	keyErr  error
+	anomaly bool
+	already bool
+}
+
+// confirmPaid подтверждает платёж по его состоянию у провайдера.
+func (s *paymentServiceImpl) confirmPaid(paymentID string, info *payment.Info) error {
+	var c *confirmation
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		c, err = s.confirmPayment(r, paymentID, info.Amount)
+		if err != nil || c.already {
+			return err
+		}
+		if err := s.savePaymentMethod(r, c.pay, info.PaymentMethodID); err != nil {
+			return err
+		}
+		return s.recordReceipt(r, c.pay, info.ReceiptRegistration)
+	})
 	if err != nil {
-		return "", err
+		return err
+	}
+	return c.report()
+}
+
+// confirmPayment меняет статус платежа, выдаёт ключ и пишет сообщение
+// пользователю в транзакции r. Строка платежа заблокирована, поэтому
+// параллельное подтверждение дождётся коммита и увидит статус succeeded.
+func (s *paymentServiceImpl) confirmPayment(r repository.Repositories, paymentID string, paid payment.Amount) (*confirmation, error) {
+	pay, err := r.Payments.GetByPaymentIDForUpdate(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	c := &confirmation{pay: pay, paid: paid}
+	if pay.Status == domain.PaymentStatusSucceeded {
+		c.already = true
+		return c, nil
+	}
+
+	if !amountMatches(pay, paid) {
+		c.anomaly = true
+		return c, s.flagAmountMismatch(r, pay, paid)
 	}
 
-	return confirmationURL, nil
+	plan, err := paymentPlan(r.Plans, pay)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Payments.UpdatePaymentStatus(pay.ID, domain.PaymentStatusSucceeded)
+	if err != nil {
+		return nil, err
+	}
+
+	if pay.Purpose == domain.PaymentPurposeRenewal {
+		if pay.VPNKeyID == nil {
+			c.keyErr = fmt.Errorf("платёж %s на продление не привязан к VPN-ключу", pay.PaymentID)
+		} else {
+			c.key, c.keyErr = renewKey(r.VPNKeys, s.provisioner.WithTx(r), pay.UserID, *pay.VPNKeyID, plan)
+		}
+		if c.keyErr != nil && !errors.Is(c.keyErr, errKeyNotOwned) && !errors.Is(c.keyErr, errKeyRevoked) {
+			return nil, c.keyErr
+		}
+		// Деньги получены — фиксируем оплату, даже если продление разберёт администратор.
+		return c, s.notifyRenewal(r, pay, c.key, c.keyErr)
+	}
+
+	c.key, c.keyErr = claimKeyForPayment(s.provisioner.WithTx(r), pay, plan)
+	if errors.Is(c.keyErr, repository.ErrNoFreeKeys) {
+		return c, s.enqueueDelivery(r, pay)
+	}
+	if c.keyErr != nil {
+		return nil, c.keyErr
+	}
+	if err := r.Payments.SetPaymentKey(pay.ID, c.key.ID); err != nil {
+		return nil, err
+	}
+
+	msg := fmt.Sprintf("✅ Оплата прошла успешно! Ваш VPN-ключ: %s", c.key.Label())
+	return c, s.notifyUserKey(r, pay.UserID, msg, c.key)
 }
 
-func (s *paymentServiceImpl) ConfirmPayment(paymentID string) error {
-	pay, err := s.repo.GetByPaymentID(paymentID)
+// report пишет итог подтверждения в лог после коммита.
+func (c *confirmation) report() error {
+	if c.already {
+		return nil
+	}
+
+	switch {
+	case c.anomaly:
+		log.Printf("⚠️ Платёж %s оплачен на %s %s вместо %.2f %s, ключ не выдан",
+			c.pay.PaymentID, c.paid.Value, c.paid.Currency, c.pay.Amount, c.pay.Currency)
+	case c.pay.Purpose == domain.PaymentPurposeRenewal && c.keyErr != nil:
+		log.Println("❌ Ошибка при продлении VPN-ключа:", c.keyErr)
+		return c.keyErr
+	case c.pay.Purpose == domain.PaymentPurposeRenewal:
+		log.Printf("✅ VPN-ключ %d продлён по платежу %s", c.key.ID, c.pay.PaymentID)
+	case c.keyErr != nil:
+		log.Printf("⏳ Нет свободных VPN-ключей, платёж %s поставлен в очередь выдачи", c.pay.PaymentID)
+	default:
+		log.Println("✅ Пользователю отправлен VPN-ключ:", c.key.Label())
+	}
+	return nil
+}
+
+// amountMatches сверяет оплаченную сумму с сохранённой в платеже: она
+// зафиксирована по цене тарифа при оформлении и не зависит от её изменений.
+func amountMatches(pay *domain.Payment, paid payment.Amount) bool {
+	return paid.Value == fmt.Sprintf("%.2f", pay.Amount) && paid.Currency == pay.Currency
+}
+
+// flagAmountMismatch фиксирует оплату, но вместо выдачи ключа записывает
+// расхождение и передаёт платёж администраторам.
+func (s *paymentServiceImpl) flagAmountMismatch(r repository.Repositories, pay *domain.Payment, paid payment.Amount) error {
+	err := r.Payments.UpdatePaymentStatus(pay.ID, domain.PaymentStatusSucceeded)
 	if err != nil {
 		return err
 	}
-	if pay.Status == "succeeded" {
-		return nil
+	if err := r.VPNKeys.ReleaseReservation(pay.ID); err != nil {
+		return err
 	}
 
-	err = s.repo.UpdatePaymentStatus(pay.ID, "succeeded")
+	err = r.Anomalies.Create(&domain.PaymentAnomaly{
+		PaymentID:        pay.ID,
+		Kind:             domain.PaymentAnomalyAmountMismatch,
+		ExpectedAmount:   pay.Amount,
+		ExpectedCurrency: pay.Currency,
+		ActualAmount:     paid.Value,
+		ActualCurrency:   paid.Currency,
+	})
 	if err != nil {
 		return err
 	}
 
-	key, err := s.vpnKeyService.AssignFreeKeyToUser(pay.UserID)
+	msg := "⚠️ Оплата получена, но её сумма не совпадает с ценой тарифа. Администратор проверит платёж и свяжется с вами."
+	if err := s.notifyUser(r, pay.UserID, msg); err != nil {
+		return err
+	}
+
+	adminText := fmt.Sprintf("🚨 Платёж %s (пользователь %d) оплачен на %s %s, а ожидалось %.2f %s. Ключ не выдан.",
+		pay.PaymentID, pay.UserID, paid.Value, paid.Currency, pay.Amount, pay.Currency)
+	return notifierInTx(s.notifier, r).NotifyAdmins(adminText)
+}
+
+// enqueueDelivery ставит покупку в очередь: ключ выдаст DeliverPending после пополнения пула.
+func (s *paymentServiceImpl) enqueueDelivery(r repository.Repositories, pay *domain.Payment) error {
+	if err := r.Deliveries.Enqueue(pay.UserID, pay.ID); err != nil {
+		return err
+	}
+	backlog, err := r.Deliveries.CountPending()
+	if err != nil {
+		return err
+	}
+
+	msg := "✅ Оплата прошла, но пока нет свободных VPN-ключей. Мы скоро их добавим и пришлём вам ключ."
+	if err := s.notifyUser(r, pay.UserID, msg); err != nil {
+		return err
+	}
+
+	adminText := fmt.Sprintf("📦 Закончились VPN-ключи! Оплаченных покупок в очереди: %d. Добавьте ключи командой /add_key или /add_keys.", backlog)
+	return notifierInTx(s.notifier, r).NotifyAdmins(adminText)
+}
+
+// HandleRefund отмечает платёж возвращённым и отзывает или сокращает
+// выданный по нему ключ.
+func (s *paymentServiceImpl) HandleRefund(paymentID string) error {
+	var (
+		pay     *domain.Payment
+		already bool
+	)
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		pay, already, err = s.refundPayment(r, paymentID)
+		return err
+	})
 	if err != nil {
-		log.Println("❌ Ошибка при выдаче VPN-ключа:", err)
+		return err
+	}
+	if !already {
+		log.Printf("🔄 Платёж %s помечен как возвращённый", pay.PaymentID)
+	}
+	return nil
+}
 
-		msg := fmt.Sprintf("✅ Оплата прошла, но пока нет свободных VPN-ключей. Мы скоро их добавим и пришлём вам ключ.")
-		s.sendTelegramMessage(pay.UserID, msg)
+// refundPayment отмечает возврат в транзакции r и забирает то, что было
+// получено по платежу. already — возврат уже был обработан раньше.
+func (s *paymentServiceImpl) refundPayment(r repository.Repositories, paymentID string) (*domain.Payment, bool, error) {
+	pay, err := r.Payments.GetByPaymentIDForUpdate(paymentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if pay.Status == domain.PaymentStatusRefunded {
+		return pay, true, nil
+	}
 
-		return errors.New("нет свободных VPN-ключей")
+	err = r.Payments.MarkRefunded(pay.ID)
+	if err != nil {
+		return nil, false, err
 	}
 
-	msg := fmt.Sprintf("✅ Оплата прошла успешно! Ваш VPN-ключ: %s", key)
-	s.sendTelegramMessage(pay.UserID, msg)
+	if pay.VPNKeyID == nil {
+		// Покупка могла ждать ключ в очереди — после возврата выдавать его не нужно.
+		if err := r.Deliveries.CancelByPayment(pay.ID); err != nil {
+			return nil, false, err
+		}
+		return pay, false, s.notifyRefund(r, pay, "🔄 Средства по платежу возвращены.")
+	}
 
-	log.Println("✅ Пользователю отправлен VPN-ключ:", key)
+	if pay.Purpose == domain.PaymentPurposeRenewal {
+		plan, err := paymentPlan(r.Plans, pay)
+		if err != nil {
+			return nil, false, err
+		}
+		key, err := shortenKey(r.VPNKeys, s.provisioner.WithTx(r), pay.UserID, *pay.VPNKeyID, plan)
+		if errors.Is(err, errKeyNotOwned) {
+			return pay, false, s.refundWithoutKey(r, pay)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return pay, false, s.notifyRefund(r, pay, fmt.Sprintf("🔄 Средства за продление возвращены. Ключ %s действует до %s.",
+			key.Label(), key.ExpiresAt.Format("02.01.2006")))
+	}
+
+	key, err := revokeKey(r.VPNKeys, s.provisioner.WithTx(r), pay.UserID, *pay.VPNKeyID)
+	if errors.Is(err, errKeyNotOwned) {
+		return pay, false, s.refundWithoutKey(r, pay)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return pay, false, s.notifyRefund(r, pay, fmt.Sprintf("🔄 Средства возвращены. VPN-ключ %s аннулирован.", key.Label()))
+}
+
+// refundWithoutKey завершает возврат, когда ключ платежа уже выдан другому
+// пользователю после истечения: трогать его нельзя.
+func (s *paymentServiceImpl) refundWithoutKey(r repository.Repositories, pay *domain.Payment) error {
+	log.Printf("⚠️ Ключ %d платежа %s уже у другого пользователя, возврат без отзыва", *pay.VPNKeyID, pay.PaymentID)
+	return s.notifyRefund(r, pay, "🔄 Средства по платежу возвращены.")
+}
+
+func (s *paymentServiceImpl) HandleWaitingForCapture(paymentID string) error {
+	var already bool
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		_, already, err = s.markWaitingForCapture(r, paymentID)
+		return err
+	})
+	if err != nil || already || s.manualCapture {
+		return err
+	}
+	// Платёж создан с capture=false до отключения ручного режима — подтверждаем сразу.
+	return s.CapturePayment(paymentID)
+}
+
+// markWaitingForCapture переводит платёж в waiting_for_capture и в ручном
+// режиме просит администраторов подтвердить списание.
+func (s *paymentServiceImpl) markWaitingForCapture(r repository.Repositories, paymentID string) (*domain.Payment, bool, error) {
+	pay, err := r.Payments.GetByPaymentIDForUpdate(paymentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if pay.Status == domain.PaymentStatusWaitingForCapture {
+		return pay, true, nil
+	}
+
+	err = r.Payments.UpdatePaymentStatus(pay.ID, domain.PaymentStatusWaitingForCapture)
+	if err != nil {
+		return nil, false, err
+	}
+	if !s.manualCapture {
+		return pay, false, nil
+	}
+
+	text := fmt.Sprintf("💳 Платёж %s на %.2f (пользователь %d) ожидает подтверждения.\n"+
+		"/capture %s — подтвердить\n/cancel_payment %s — отменить",
+		pay.PaymentID, pay.Amount, pay.UserID, pay.PaymentID, pay.PaymentID)
+	return pay, false, notifierInTx(s.notifier, r).NotifyAdmins(text)
+}
+
+func (s *paymentServiceImpl) HandleCancellation(paymentID, party, reason string) error {
+	var (
+		pay     *domain.Payment
+		already bool
+	)
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		pay, already, err = s.cancelPayment(r, paymentID, party, reason)
+		return err
+	})
+	if err != nil || already {
+		return err
+	}
+	log.Printf("❌ Платёж %s отменён (%s: %s)", paymentID, party, reason)
+	if pay.Recurring {
+		return s.offerManualRenewal(pay, reason)
+	}
 	return nil
 }
 
-func (s *paymentServiceImpl) sendTelegramMessage(userID int, text string) {
-	bot, err := tgbotapi.NewBotAPI("YOUR_BOT_TOKEN")
+// cancelPayment отмечает отмену в транзакции r и снимает резерв ключа. Об
+// отмене автопродления пользователю сообщает offerManualRenewal после коммита.
+func (s *paymentServiceImpl) cancelPayment(r repository.Repositories, paymentID, party, reason string) (*domain.Payment, bool, error) {
+	pay, err := r.Payments.GetByPaymentIDForUpdate(paymentID)
 	if err != nil {
-		log.Println("❌ Ошибка создания Telegram-бота:", err)
-		return
+		return nil, false, err
+	}
+	if pay.Status == domain.PaymentStatusCanceled {
+		return pay, true, nil
 	}
 
-	msg := tgbotapi.NewMessage(int64(userID), text)
-	_, err = bot.Send(msg)
+	if err := r.Payments.MarkCanceled(pay.ID, party, reason); err != nil {
+		return nil, false, err
+	}
+	if err := r.VPNKeys.ReleaseReservation(pay.ID); err != nil {
+		return nil, false, err
+	}
+	if err := r.Deliveries.CancelByPayment(pay.ID); err != nil {
+		return nil, false, err
+	}
+
+	if pay.Recurring {
+		if reason == "permission_revoked" {
+			// Пользователь отозвал разрешение на списания — карта больше не подойдёт.
+			return pay, false, r.Users.ClearPaymentMethod(pay.UserID)
+		}
+		return pay, false, nil
+	}
+	text := "❌ Платёж отменён" + cancellationText(reason)
+	return pay, false, s.notifyUser(r, pay.UserID, text+". Вы можете попробовать оплатить ещё раз.")
+}
+
+// cancellationText — причина отмены для сообщения пользователю.
+func cancellationText(reason string) string {
+	if description, ok := cancellationReasons[reason]; ok {
+		return ": " + description
+	}
+	if reason != "" {
+		return ": " + reason
+	}
+	return ""
+}
+
+func (s *paymentServiceImpl) CapturePayment(paymentID string) error {
+	pay, provider, err := s.paymentProvider(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.Status != domain.PaymentStatusWaitingForCapture {
+		return fmt.Errorf("%w: платёж %s в статусе %s", repository.ErrInvalidPaymentTransition, paymentID, pay.Status)
+	}
+
+	info, err := provider.CapturePayment(paymentID)
+	if err != nil {
+		return err
+	}
+	log.Printf("💳 Платёж %s подтверждён, статус: %s", paymentID, info.Status)
+
+	if info.Status == domain.PaymentStatusSucceeded {
+		return s.confirmPaid(paymentID, info)
+	}
+	return nil
+}
+
+func (s *paymentServiceImpl) CancelPayment(paymentID string) error {
+	pay, provider, err := s.paymentProvider(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.Status != domain.PaymentStatusWaitingForCapture {
+		return fmt.Errorf("%w: платёж %s в статусе %s", repository.ErrInvalidPaymentTransition, paymentID, pay.Status)
+	}
+
+	info, err := provider.CancelPayment(paymentID)
+	if err != nil {
+		return err
+	}
+
+	if info.Status == domain.PaymentStatusCanceled {
+		return s.HandleCancellation(paymentID, info.CancellationParty, info.CancellationReason)
+	}
+	return nil
+}
+
+// RefundPayment возвращает деньги по оплаченному платежу. Если провайдер
+// провёл возврат сразу, он применяется так же, как уведомление о возврате.
+func (s *paymentServiceImpl) RefundPayment(paymentID string) error {
+	pay, provider, err := s.paymentProvider(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.Status != domain.PaymentStatusSucceeded {
+		return fmt.Errorf("%w: платёж %s в статусе %s", repository.ErrInvalidPaymentTransition, paymentID, pay.Status)
+	}
+	user, err := s.userRepo.GetByID(pay.UserID)
+	if err != nil {
+		return err
+	}
+	var plan *domain.Plan
+	err = s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		plan, err = paymentPlan(r.Plans, pay)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	req := payment.RefundRequest{
+		PaymentID:  pay.PaymentID,
+		Amount:     paymentAmount(pay),
+		TelegramID: user.TelegramID,
+		Title:      "VPN: " + plan.Name,
+		Customer:   customer(user),
+	}
+	if pay.TelegramChargeID != nil {
+		req.TelegramChargeID = *pay.TelegramChargeID
+	}
+	refund, err := provider.Refund(req)
+	if err != nil {
+		return err
+	}
+	log.Printf("🔄 Возврат %s по платежу %s создан, статус: %s", refund.ID, paymentID, refund.Status)
+
+	if refund.Status != domain.PaymentStatusSucceeded {
+		// Провайдер пришлёт уведомление, когда возврат завершится.
+		return nil
+	}
+	return s.HandleEvent(provider.Name(), &payment.Event{
+		Name:      payment.EventRefundSucceeded,
+		ObjectID:  refund.ID,
+		PaymentID: pay.PaymentID,
+		Amount:    paymentAmount(pay),
+	})
+}
+
+// CheckPayment находит платёж пользователя по токену — из ссылки возврата
+// в бота или кнопки «Проверить оплату» — и, если он ещё не завершён, сверяет
+// его статус с провайдером: уведомление о платеже могло ещё не дойти.
+func (s *paymentServiceImpl) CheckPayment(telegramID int64, returnToken string) (*domain.Payment, error) {
+	pay, err := s.repo.GetByReturnToken(returnToken)
 	if err != nil {
-		log.Println("❌ Ошибка отправки сообщения пользователю:", err)
+		return nil, err
+	}
+	user, err := s.userRepo.GetByID(pay.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TelegramID != telegramID {
+		return nil, ErrPaymentNotFound
+	}
+
+	if err := s.syncPayment(pay); err != nil {
+		log.Printf("⚠️ Не удалось сверить платёж %s с провайдером: %v", pay.PaymentID, err)
+		return pay, nil
+	}
+	return s.repo.GetByPaymentID(pay.PaymentID)
+}
+
+// SyncPayment сверяет незавершённый платёж с провайдером на случай, если
+// уведомление о нём потерялось.
+func (s *paymentServiceImpl) SyncPayment(paymentID string) error {
+	pay, err := s.repo.GetByPaymentID(paymentID)
+	if err != nil {
+		return err
+	}
+	return s.syncPayment(pay)
+}
+
+// syncPayment применяет статус незавершённого платежа у провайдера так же,
+// как уведомление о нём.
+func (s *paymentServiceImpl) syncPayment(pay *domain.Payment) error {
+	if pay.Status != domain.PaymentStatusPending && pay.Status != domain.PaymentStatusWaitingForCapture {
+		return nil
+	}
+	if pay.Recurring && strings.HasPrefix(pay.PaymentID, autoRenewPrefix) {
+		// Провайдер не ответил на списание автопродления — ID платежа у него неизвестен.
+		return s.resumeCharge(pay)
+	}
+	provider, err := s.providers.Get(pay.Provider)
+	if err != nil {
+		return err
+	}
+	info, err := provider.FetchPayment(pay.PaymentID)
+	if errors.Is(err, payment.ErrNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch info.Status {
+	case domain.PaymentStatusSucceeded:
+		return s.confirmPaid(pay.PaymentID, info)
+	case domain.PaymentStatusWaitingForCapture:
+		if pay.Status == domain.PaymentStatusPending {
+			return s.HandleWaitingForCapture(pay.PaymentID)
+		}
+	case domain.PaymentStatusCanceled:
+		return s.HandleCancellation(pay.PaymentID, info.CancellationParty, info.CancellationReason)
+	}
+	return nil
+}
+
+// paymentProvider находит платёж и провайдера, через которого он создан.
+func (s *paymentServiceImpl) paymentProvider(paymentID string) (*domain.Payment, payment.Provider, error) {
+	pay, err := s.repo.GetByPaymentID(paymentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	provider, err := s.providers.Get(pay.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pay, provider, nil
+}
+
+// notifyUser записывает сообщение пользователю в транзакцию r: платежи
+// хранят внутренний users.id, а писать в Telegram нужно по telegram_id.
+func (s *paymentServiceImpl) notifyUser(r repository.Repositories, userID int, text string) error {
+	user, err := r.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return notifierInTx(s.notifier, r).Notify(user.TelegramID, text)
+}
+
+// notifyUserKey сообщает пользователю о выданном ключе; конфигурация
+// WireGuard уходит файлом с text в подписи.
+func (s *paymentServiceImpl) notifyUserKey(r repository.Repositories, userID int, text string, key *domain.VPNKey) error {
+	user, err := r.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return notifyKey(notifierInTx(s.notifier, r), user.TelegramID, text, key)
+}
+
+func (s *paymentServiceImpl) notifyRefund(r repository.Repositories, pay *domain.Payment, userText string) error {
+	if err := s.notifyUser(r, pay.UserID, userText); err != nil {
+		return err
+	}
+
+	adminText := fmt.Sprintf("🔄 Возврат по платежу %s (пользователь %d, %.2f).\n%s",
+		pay.PaymentID, pay.UserID, pay.Amount, userText)
+	return notifierInTx(s.notifier, r).NotifyAdmins(adminText)
+}
+
+func paymentPlan(plans repository.PlanRepository, pay *domain.Payment) (*domain.Plan, error) {
+	if pay.PlanID == nil {
+		return defaultPlan, nil
+	}
+	return plans.GetByID(*pay.PlanID)
+}
+
+func (s *paymentServiceImpl) notifyRenewal(r repository.Repositories, pay *domain.Payment, key *domain.VPNKey, keyErr error) error {
+	if keyErr != nil {
+		msg := "✅ Оплата прошла, но продлить ключ не удалось. Мы свяжемся с вами."
+		if err := s.notifyUser(r, pay.UserID, msg); err != nil {
+			return err
+		}
+
+		adminText := fmt.Sprintf("⚠️ Оплачено продление по платежу %s, но продлить ключ не удалось: %v", pay.PaymentID, keyErr)
+		return notifierInTx(s.notifier, r).NotifyAdmins(adminText)
+	}
+
+	msg := fmt.Sprintf("✅ Оплата прошла успешно! Ключ %s продлён до %s", key.Label(), key.ExpiresAt.Format("02.01.2006"))
+	if pay.Recurring {
+		msg = fmt.Sprintf("🔁 Автопродление: оплата списана, ключ %s продлён до %s", key.Label(), key.ExpiresAt.Format("02.01.2006"))
 	}
+	return s.notifyUser(r, pay.UserID, msg)
 }
@@ -0,0 +1,236 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+	"vpn-bot/internal/service/servicetest"
+)
+
+// Репозитории ниже хранят по одной записи и реализуют только то, что нужно
+// подтверждению оплаты; остальные методы встроенного интерфейса не вызываются.
+
+// fakeUnitOfWork выполняет хуки транзакции, как настоящая: коммит всегда
+// успешен, а откатывается транзакция, если fn вернула ошибку.
+type fakeUnitOfWork struct {
+	repos repository.Repositories
+}
+
+func (u *fakeUnitOfWork) Do(fn func(r repository.Repositories) error) error {
+	return repository.RunInTx(u.repos, func() error { return nil }, fn)
+}
+
+type fakeUsers struct {
+	repository.UserRepository
+	user domain.User
+}
+
+func (r *fakeUsers) GetByID(userID int) (*domain.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+type fakePayments struct {
+	repository.PaymentRepository
+	payments []*domain.Payment
+}
+
+func (r *fakePayments) get(paymentID string) *domain.Payment {
+	for _, pay := range r.payments {
+		if pay.PaymentID == paymentID {
+			return pay
+		}
+	}
+	return nil
+}
+
+func (r *fakePayments) byID(id int) *domain.Payment {
+	for _, pay := range r.payments {
+		if pay.ID == id {
+			return pay
+		}
+	}
+	return nil
+}
+
+func (r *fakePayments) CreatePayment(p *domain.Payment) error {
+	p.ID = len(r.payments) + 1
+	pay := *p
+	r.payments = append(r.payments, &pay)
+	return nil
+}
+
+func (r *fakePayments) GetByPaymentID(paymentID string) (*domain.Payment, error) {
+	pay := r.get(paymentID)
+	if pay == nil {
+		return nil, repository.ErrPaymentNotFound
+	}
+	found := *pay
+	return &found, nil
+}
+
+func (r *fakePayments) GetByPaymentIDForUpdate(paymentID string) (*domain.Payment, error) {
+	return r.GetByPaymentID(paymentID)
+}
+
+func (r *fakePayments) UpdatePaymentStatus(paymentID int, status string) error {
+	r.byID(paymentID).Status = status
+	return nil
+}
+
+func (r *fakePayments) MarkCanceled(paymentID int, party, reason string) error {
+	r.byID(paymentID).Status = domain.PaymentStatusCanceled
+	return nil
+}
+
+func (r *fakePayments) SetPaymentKey(paymentID, keyID int) error {
+	r.byID(paymentID).VPNKeyID = &keyID
+	return nil
+}
+
+type fakePlans struct {
+	repository.PlanRepository
+	plan domain.Plan
+}
+
+func (r *fakePlans) GetByID(int) (*domain.Plan, error) {
+	plan := r.plan
+	return &plan, nil
+}
+
+type fakeVPNKeys struct {
+	repository.VPNKeyRepository
+	key domain.VPNKey
+}
+
+func (r *fakeVPNKeys) ClaimReservedKey(paymentID, userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	r.key.IsUsed = true
+	r.key.UserID = &userID
+	r.key.ExpiresAt = &expiresAt
+	key := r.key
+	return &key, nil
+}
+
+func (r *fakeVPNKeys) ReleaseReservation(paymentID int) error {
+	return nil
+}
+
+func (r *fakeVPNKeys) AddIssuedKey(key *domain.VPNKey) error {
+	key.ID = 1
+	key.IsUsed = true
+	r.key = *key
+	return nil
+}
+
+func (r *fakeVPNKeys) ExtendKey(keyID int, expiresAt time.Time) error {
+	r.key.ExpiresAt = &expiresAt
+	return nil
+}
+
+func (r *fakeVPNKeys) RevokeKey(keyID int) error {
+	r.key.Status = domain.VPNKeyStatusRevoked
+	return nil
+}
+
+type fakeDeliveries struct {
+	repository.PendingDeliveryRepository
+}
+
+func (r *fakeDeliveries) CancelByPayment(paymentID int) error {
+	return nil
+}
+
+type fakeProvider struct {
+	payment.Provider
+	info payment.Info
+	// chargeErr — ошибка списания с сохранённого способа оплаты.
+	chargeErr error
+	charges   int
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) FetchPayment(string) (*payment.Info, error) {
+	info := p.info
+	return &info, nil
+}
+
+func (p *fakeProvider) CreatePayment(req payment.CreateRequest) (*payment.Checkout, error) {
+	return &payment.Checkout{PaymentID: "manual-1", Status: domain.PaymentStatusPending, ConfirmationURL: "https://pay.example/manual-1"}, nil
+}
+
+func (p *fakeProvider) ChargeSaved(req payment.CreateRequest, paymentMethodID string) (*payment.Info, error) {
+	p.charges++
+	if p.chargeErr != nil {
+		return nil, p.chargeErr
+	}
+	info := p.info
+	return &info, nil
+}
+
+func TestSyncPaymentNotifiesUserByTelegramID(t *testing.T) {
+	const (
+		userID     = 7
+		telegramID = 700100
+	)
+	planID := 1
+
+	users := &fakeUsers{user: domain.User{ID: userID, TelegramID: telegramID}}
+	payments := &fakePayments{payments: []*domain.Payment{{
+		ID:        1,
+		UserID:    userID,
+		Amount:    199,
+		Currency:  "RUB",
+		Status:    domain.PaymentStatusPending,
+		Provider:  "fake",
+		PaymentID: "pay-1",
+		Purpose:   domain.PaymentPurposePurchase,
+		PlanID:    &planID,
+	}}}
+	keys := &fakeVPNKeys{key: domain.VPNKey{ID: 3, Key: "ss://secret@vpn.example:443#vpn", Backend: "pool"}}
+	uow := &fakeUnitOfWork{repos: repository.Repositories{
+		Users:    users,
+		Payments: payments,
+		Plans:    &fakePlans{plan: domain.Plan{ID: planID, Name: "1 месяц", Months: 1, Price: 199, Currency: "RUB"}},
+		VPNKeys:  keys,
+	}}
+
+	provider := &fakeProvider{info: payment.Info{
+		PaymentID: "pay-1",
+		Status:    domain.PaymentStatusSucceeded,
+		Amount:    payment.Amount{Value: "199.00", Currency: "RUB"},
+	}}
+	providers, err := payment.NewRegistry("fake", nil, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := servicetest.NewFakeNotifier()
+	svc := service.NewPaymentService(uow, payments, users, notifier, providers,
+		service.NewPoolProvisioner(keys), false, time.Hour, "", service.DescriptionTemplates{})
+
+	if err := svc.SyncPayment("pay-1"); err != nil {
+		t.Fatalf("SyncPayment: %v", err)
+	}
+
+	if status := payments.get("pay-1").Status; status != domain.PaymentStatusSucceeded {
+		t.Errorf("статус платежа %q, ожидался %q", status, domain.PaymentStatusSucceeded)
+	}
+	if got := notifier.SentTo(userID); len(got) != 0 {
+		t.Errorf("сообщения ушли на users.id %d: %q", userID, got)
+	}
+	sent := notifier.SentTo(telegramID)
+	if len(sent) == 0 {
+		t.Fatalf("пользователь %d не получил сообщений, отправлено: %+v", telegramID, notifier.Messages)
+	}
+	if !strings.Contains(sent[0], keys.key.Key) {
+		t.Errorf("в сообщении нет ключа: %q", sent[0])
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"errors"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+)
+
+type planServiceImpl struct {
+	repo repository.PlanRepository
+}
+
+func NewPlanService(r repository.PlanRepository) PlanService {
+	return &planServiceImpl{repo: r}
+}
+
+func (s *planServiceImpl) GetActivePlans() ([]domain.Plan, error) {
+	return s.repo.GetActivePlans()
+}
+
+func (s *planServiceImpl) GetActivePlan(planID int) (*domain.Plan, error) {
+	plan, err := s.repo.GetByID(planID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive {
+		return nil, errors.New("тариф недоступен")
+	}
+	return plan, nil
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+// poolProvisioner выдаёт ключи из пула, который администратор пополняет
+// командами /add_key и /add_keys.
+type poolProvisioner struct {
+	repo repository.VPNKeyRepository
+}
+
+func NewPoolProvisioner(repo repository.VPNKeyRepository) VPNProvisioner {
+	return &poolProvisioner{repo: repo}
+}
+
+func (p *poolProvisioner) CreateClient(userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	return p.repo.ClaimFreeKey(userID, expiresAt)
+}
+
+func (p *poolProvisioner) RevokeClient(key *domain.VPNKey) error {
+	return p.repo.RevokeKey(key.ID)
+}
+
+func (p *poolProvisioner) ExtendClient(key *domain.VPNKey, expiresAt time.Time) error {
+	return p.repo.ExtendKey(key.ID, expiresAt)
+}
+
+// SuspendClient ничего не делает: ключ из пула нельзя отключить на сервере.
+func (p *poolProvisioner) SuspendClient(key *domain.VPNKey) error {
+	return nil
+}
+
+func (p *poolProvisioner) Usage(key *domain.VPNKey) (*vpn.Usage, error) {
+	return nil, vpn.ErrNotSupported
+}
+
+func (p *poolProvisioner) WithTx(r repository.Repositories) VPNProvisioner {
+	return &poolProvisioner{repo: r.VPNKeys}
+}
+
+func (p *poolProvisioner) HasFreeKeys() (bool, error) {
+	count, err := p.repo.CountFreeKeys()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ReserveKey сначала забирает резерв прежнего неоплаченного платежа
+// пользователя и только без него занимает свободный ключ.
+func (p *poolProvisioner) ReserveKey(userID, paymentID int, until time.Time) (*domain.VPNKey, error) {
+	key, err := p.repo.MoveUserReservation(userID, paymentID, until)
+	if !errors.Is(err, repository.ErrNoFreeKeys) {
+		return key, err
+	}
+	return p.repo.ReserveFreeKey(paymentID, until)
+}
+
+func (p *poolProvisioner) ClaimReservedKey(paymentID, userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	return p.repo.ClaimReservedKey(paymentID, userID, expiresAt)
+}
+
+// backendProvisioner создаёт каждому покупателю отдельного клиента на
+// VPN-сервере. Ключи из пула, выданные до перехода на сервер, продлеваются
+// и отзываются только в базе.
+//
+// В транзакции изменения на сервере согласуются с её исходом: созданный
+// клиент удаляется и прежний срок возвращается при откате, а клиент
+// удаляется с сервера только после коммита.
+type backendProvisioner struct {
+	backend vpn.Backend
+	repo    repository.VPNKeyRepository
+	users   repository.UserRepository
+	// tx — транзакция UnitOfWork; nil вне неё.
+	tx *repository.Repositories
+}
+
+func NewBackendProvisioner(backend vpn.Backend, repo repository.VPNKeyRepository, users repository.UserRepository) VPNProvisioner {
+	return &backendProvisioner{backend: backend, repo: repo, users: users}
+}
+
+func (p *backendProvisioner) CreateClient(userID int, expiresAt time.Time) (*domain.VPNKey, error) {
+	user, err := p.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := p.backend.CreateClient(vpn.CreateRequest{
+		Name:      clientName(user),
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key := &domain.VPNKey{
+		Key:       client.Key,
+		UserID:    &userID,
+		ExpiresAt: &expiresAt,
+		Backend:   p.backend.Name(),
+		ClientID:  client.ID,
+	}
+	if err := p.repo.AddIssuedKey(key); err != nil {
+		// Без записи в базе клиент на сервере никому не достанется.
+		if revokeErr := p.backend.RevokeClient(client.ID); revokeErr != nil {
+			log.Printf("❌ Не удалось удалить клиента %s с VPN-сервера %s: %v", client.ID, p.backend.Name(), revokeErr)
+		}
+		return nil, err
+	}
+	if p.tx != nil {
+		p.tx.OnRollback(func() {
+			log.Printf("↩️ Транзакция откатилась, удаляем клиента %s с VPN-сервера %s", client.ID, p.backend.Name())
+			if err := p.backend.RevokeClient(client.ID); err != nil {
+				log.Printf("❌ Не удалось удалить клиента %s с VPN-сервера %s: %v", client.ID, p.backend.Name(), err)
+			}
+		})
+	}
+	log.Printf("🆕 На VPN-сервере %s создан клиент %s для пользователя %d", p.backend.Name(), client.ID, userID)
+	return key, nil
+}
+
+// RevokeClient удаляет клиента с сервера, а затем отзывает ключ в базе. В
+// транзакции порядок обратный: удаление клиента не отменить, поэтому оно
+// ждёт коммита.
+func (p *backendProvisioner) RevokeClient(key *domain.VPNKey) error {
+	if err := p.onBackend(key); err != nil {
+		return err
+	}
+	if key.ClientID == "" {
+		return p.repo.RevokeKey(key.ID)
+	}
+	if p.tx == nil {
+		if err := p.revokeOnBackend(key.ClientID); err != nil {
+			return err
+		}
+		return p.repo.RevokeKey(key.ID)
+	}
+
+	if err := p.repo.RevokeKey(key.ID); err != nil {
+		return err
+	}
+	clientID := key.ClientID
+	p.tx.AfterCommit(func() {
+		if err := p.revokeOnBackend(clientID); err != nil {
+			log.Printf("❌ VPN-ключ %d отозван, но клиент %s остался на VPN-сервере %s, удалите его вручную: %v",
+				key.ID, clientID, p.backend.Name(), err)
+		}
+	})
+	return nil
+}
+
+func (p *backendProvisioner) revokeOnBackend(clientID string) error {
+	err := p.backend.RevokeClient(clientID)
+	if errors.Is(err, vpn.ErrClientNotFound) {
+		log.Printf("⚠️ Клиента %s уже нет на VPN-сервере %s", clientID, p.backend.Name())
+		return nil
+	}
+	return err
+}
+
+// ExtendClient меняет срок на сервере, а затем в базе. Если транзакция
+// откатится, на сервере восстанавливается прежний срок.
+func (p *backendProvisioner) ExtendClient(key *domain.VPNKey, expiresAt time.Time) error {
+	if err := p.onBackend(key); err != nil {
+		return err
+	}
+	if key.ClientID != "" {
+		if err := p.backend.ExtendClient(key.ClientID, expiresAt); err != nil {
+			return err
+		}
+		if p.tx != nil && key.ExpiresAt != nil {
+			previous := *key
+			p.tx.OnRollback(func() { p.restoreClient(previous) })
+		}
+	}
+	return p.repo.ExtendKey(key.ID, expiresAt)
+}
+
+// restoreClient возвращает клиенту на сервере срок и состояние key.
+func (p *backendProvisioner) restoreClient(key domain.VPNKey) {
+	log.Printf("↩️ Транзакция откатилась, возвращаем клиенту %s срок до %s", key.ClientID, key.ExpiresAt.Format("02.01.2006"))
+	if err := p.backend.ExtendClient(key.ClientID, *key.ExpiresAt); err != nil {
+		log.Printf("❌ Не удалось вернуть срок клиенту %s на VPN-сервере %s: %v", key.ClientID, p.backend.Name(), err)
+		return
+	}
+	if suspender, ok := p.backend.(vpn.Suspender); ok && key.Status == domain.VPNKeyStatusExpired {
+		if err := suspender.SuspendClient(key.ClientID); err != nil {
+			log.Printf("❌ Не удалось снова отключить клиента %s на VPN-сервере %s: %v", key.ClientID, p.backend.Name(), err)
+		}
+	}
+}
+
+func (p *backendProvisioner) SuspendClient(key *domain.VPNKey) error {
+	suspender, ok := p.backend.(vpn.Suspender)
+	if !ok || key.ClientID == "" {
+		return nil
+	}
+	if err := p.onBackend(key); err != nil {
+		return err
+	}
+	return suspender.SuspendClient(key.ClientID)
+}
+
+func (p *backendProvisioner) Usage(key *domain.VPNKey) (*vpn.Usage, error) {
+	if key.ClientID == "" {
+		return nil, vpn.ErrNotSupported
+	}
+	if err := p.onBackend(key); err != nil {
+		return nil, err
+	}
+	return p.backend.Usage(key.ClientID)
+}
+
+// txBackend реализуют VPN-серверы, которые хранят клиентов в нашей базе,
+// например WireGuard. В транзакции они пишут через её репозитории, и откат
+// отменяет их изменения без компенсации.
+type txBackend interface {
+	WithTx(r repository.Repositories) vpn.Backend
+}
+
+func (p *backendProvisioner) WithTx(r repository.Repositories) VPNProvisioner {
+	if b, ok := p.backend.(txBackend); ok {
+		return &backendProvisioner{backend: b.WithTx(r), repo: r.VPNKeys, users: r.Users}
+	}
+	return &backendProvisioner{backend: p.backend, repo: r.VPNKeys, users: r.Users, tx: &r}
+}
+
+// clientName — имя клиента на сервере: Telegram username, а без него —
+// Telegram ID.
+func clientName(user *domain.User) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	return "tg" + strconv.FormatInt(user.TelegramID, 10)
+}
+
+// onBackend проверяет, что ключ создан на этом сервере, а не на том, что
+// был настроен раньше.
+func (p *backendProvisioner) onBackend(key *domain.VPNKey) error {
+	if key.ClientID != "" && key.Backend != p.backend.Name() {
+		return fmt.Errorf("VPN-ключ %d создан на сервере %s, а настроен %s", key.ID, key.Backend, p.backend.Name())
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/service"
+	"vpn-bot/internal/vpn"
+	"vpn-bot/internal/vpn/fakevpn"
+	"vpn-bot/internal/vpn/fakevpn/fakevpntest"
+)
+
+var errRollback = errors.New("транзакция откатывается")
+
+// suspendingBackend добавляет поддельной панели приостановку клиентов, как
+// у серверов, которые сами не отключают истёкшие ключи.
+type suspendingBackend struct {
+	vpn.Backend
+	suspended map[string]bool
+}
+
+func (b *suspendingBackend) SuspendClient(clientID string) error {
+	b.suspended[clientID] = true
+	return nil
+}
+
+func (b *suspendingBackend) ExtendClient(clientID string, expiresAt time.Time) error {
+	if err := b.Backend.ExtendClient(clientID, expiresAt); err != nil {
+		return err
+	}
+	delete(b.suspended, clientID)
+	return nil
+}
+
+type provisionerFixture struct {
+	provisioner service.VPNProvisioner
+	uow         *fakeUnitOfWork
+	srv         *fakevpntest.Server
+	backend     *suspendingBackend
+}
+
+func newProvisionerFixture(t *testing.T) *provisionerFixture {
+	t.Helper()
+	srv := fakevpntest.NewServer("token")
+	ts := srv.Start()
+	t.Cleanup(ts.Close)
+
+	backend := &suspendingBackend{Backend: fakevpn.NewBackend(ts.URL+"/api", "token"), suspended: map[string]bool{}}
+	users := &fakeUsers{user: domain.User{ID: 7, TelegramID: 700100, Username: "alice"}}
+	keys := &fakeVPNKeys{}
+	return &provisionerFixture{
+		provisioner: service.NewBackendProvisioner(backend, keys, users),
+		uow:         &fakeUnitOfWork{repos: repository.Repositories{Users: users, VPNKeys: keys}},
+		srv:         srv,
+		backend:     backend,
+	}
+}
+
+// issuedKey создаёт клиента на сервере напрямую, как если бы ключ был выдан раньше.
+func (f *provisionerFixture) issuedKey(t *testing.T, expiresAt time.Time, status string) domain.VPNKey {
+	t.Helper()
+	client, err := f.backend.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	userID := 7
+	return domain.VPNKey{ID: 1, Key: client.Key, UserID: &userID, ExpiresAt: &expiresAt, Status: status,
+		Backend: fakevpn.Name, ClientID: client.ID}
+}
+
+func TestBackendProvisionerCreateClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		revoked bool
+	}{
+		{"коммит", nil, false},
+		{"откат", errRollback, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProvisionerFixture(t)
+			expiresAt := time.Now().AddDate(0, 1, 0)
+
+			var key *domain.VPNKey
+			err := f.uow.Do(func(r repository.Repositories) error {
+				var err error
+				key, err = f.provisioner.WithTx(r).CreateClient(7, expiresAt)
+				if err != nil {
+					return err
+				}
+				return tt.fnErr
+			})
+			if !errors.Is(err, tt.fnErr) {
+				t.Fatalf("Do: %v, ожидалось %v", err, tt.fnErr)
+			}
+
+			client, ok := f.srv.Client(key.ClientID)
+			if !ok {
+				t.Fatalf("клиента %s нет на сервере", key.ClientID)
+			}
+			if client.Revoked != tt.revoked {
+				t.Errorf("клиент удалён: %v, ожидалось %v", client.Revoked, tt.revoked)
+			}
+			if client.Name != "alice" || key.Backend != fakevpn.Name {
+				t.Errorf("клиент %q на сервере %q, ожидались alice и %q", client.Name, key.Backend, fakevpn.Name)
+			}
+		})
+	}
+}
+
+func TestBackendProvisionerRollbackRestoresClient(t *testing.T) {
+	f := newProvisionerFixture(t)
+	previous := time.Now().AddDate(0, 0, -1).Truncate(time.Second)
+	key := f.issuedKey(t, previous, domain.VPNKeyStatusExpired)
+	if err := f.backend.SuspendClient(key.ClientID); err != nil {
+		t.Fatal(err)
+	}
+
+	extended := time.Now().AddDate(0, 1, 0).Truncate(time.Second)
+	err := f.uow.Do(func(r repository.Repositories) error {
+		if err := f.provisioner.WithTx(r).ExtendClient(&key, extended); err != nil {
+			return err
+		}
+		client, _ := f.srv.Client(key.ClientID)
+		if !client.ExpiresAt.Equal(extended) || f.backend.suspended[key.ClientID] {
+			t.Errorf("до отката клиент до %s, отключён: %v", client.ExpiresAt, f.backend.suspended[key.ClientID])
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Do: %v", err)
+	}
+
+	client, _ := f.srv.Client(key.ClientID)
+	if !client.ExpiresAt.Equal(previous) {
+		t.Errorf("после отката клиент до %s, ожидался прежний срок %s", client.ExpiresAt, previous)
+	}
+	if !f.backend.suspended[key.ClientID] {
+		t.Error("истёкший клиент после отката снова включён")
+	}
+}
+
+func TestBackendProvisionerRevokeAfterCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		revoked bool
+	}{
+		{"коммит", nil, true},
+		{"откат", errRollback, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newProvisionerFixture(t)
+			key := f.issuedKey(t, time.Now().AddDate(0, 1, 0), domain.VPNKeyStatusActive)
+
+			err := f.uow.Do(func(r repository.Repositories) error {
+				if err := f.provisioner.WithTx(r).RevokeClient(&key); err != nil {
+					return err
+				}
+				if client, _ := f.srv.Client(key.ClientID); client.Revoked {
+					t.Error("клиент удалён с сервера до коммита")
+				}
+				return tt.fnErr
+			})
+			if !errors.Is(err, tt.fnErr) {
+				t.Fatalf("Do: %v, ожидалось %v", err, tt.fnErr)
+			}
+
+			if client, _ := f.srv.Client(key.ClientID); client.Revoked != tt.revoked {
+				t.Errorf("клиент удалён: %v, ожидалось %v", client.Revoked, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestBackendProvisionerRejectsKeyFromOtherBackend(t *testing.T) {
+	f := newProvisionerFixture(t)
+	expiresAt := time.Now().AddDate(0, 1, 0).Truncate(time.Second)
+	key := f.issuedKey(t, expiresAt, domain.VPNKeyStatusActive)
+	key.Backend = "outline"
+
+	err := f.uow.Do(func(r repository.Repositories) error {
+		return f.provisioner.WithTx(r).ExtendClient(&key, expiresAt.AddDate(0, 1, 0))
+	})
+	if err == nil {
+		t.Error("продлён ключ чужого сервера")
+	}
+	err = f.uow.Do(func(r repository.Repositories) error {
+		return f.provisioner.WithTx(r).RevokeClient(&key)
+	})
+	if err == nil {
+		t.Error("отозван ключ чужого сервера")
+	}
+
+	client, _ := f.srv.Client(key.ClientID)
+	if client.Revoked || !client.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("клиент с тем же ID изменён: до %s, удалён: %v", client.ExpiresAt, client.Revoked)
+	}
+}
@@ -0,0 +1,104 @@
+// Package servicetest содержит поддельные реализации зависимостей сервисов для тестов.
+package servicetest
+
+import (
+	"sync"
+
+	"vpn-bot/internal/service"
+)
+
+// Message — сообщение, отправленное через FakeNotifier.
+// Для файла и картинки Text — подпись, а DocumentName, Document и Photo —
+// они сами.
+type Message struct {
+	TelegramID   int64
+	Text         string
+	ParseMode    string
+	DocumentName string
+	Document     []byte
+	Photo        []byte
+}
+
+// FakeNotifier запоминает отправленные сообщения вместо доставки в Telegram.
+// Если задан Err, все отправки завершаются этой ошибкой.
+type FakeNotifier struct {
+	mu            sync.Mutex
+	Err           error
+	Messages      []Message
+	AdminMessages []string
+}
+
+var _ service.Notifier = (*FakeNotifier)(nil)
+
+func NewFakeNotifier() *FakeNotifier {
+	return &FakeNotifier{}
+}
+
+func (n *FakeNotifier) Notify(telegramID int64, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Err != nil {
+		return n.Err
+	}
+	n.Messages = append(n.Messages, Message{TelegramID: telegramID, Text: text})
+	return nil
+}
+
+func (n *FakeNotifier) NotifyMarkdown(telegramID int64, text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Err != nil {
+		return n.Err
+	}
+	n.Messages = append(n.Messages, Message{TelegramID: telegramID, Text: text, ParseMode: "Markdown"})
+	return nil
+}
+
+func (n *FakeNotifier) NotifyDocument(telegramID int64, caption, name string, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Err != nil {
+		return n.Err
+	}
+	n.Messages = append(n.Messages, Message{TelegramID: telegramID, Text: caption, DocumentName: name, Document: data})
+	return nil
+}
+
+func (n *FakeNotifier) NotifyPhoto(telegramID int64, caption string, photo []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Err != nil {
+		return n.Err
+	}
+	n.Messages = append(n.Messages, Message{TelegramID: telegramID, Text: caption, ParseMode: "Markdown", Photo: photo})
+	return nil
+}
+
+func (n *FakeNotifier) NotifyAdmins(text string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.Err != nil {
+		return n.Err
+	}
+	n.AdminMessages = append(n.AdminMessages, text)
+	return nil
+}
+
+// SentTo возвращает тексты сообщений, отправленных пользователю telegramID.
+func (n *FakeNotifier) SentTo(telegramID int64) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var texts []string
+	for _, m := range n.Messages {
+		if m.TelegramID == telegramID {
+			texts = append(texts, m.Text)
+		}
+	}
+	return texts
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"net/mail"
+	"strings"
 	"vpn-bot/internal/domain"
 	"vpn-bot/internal/repository"
 )
@@ -30,3 +32,67 @@ func (s *userServiceImpl) RegisterUser(telegramID int64, username, chatLink stri
 func (s *userServiceImpl) GetUserByTelegramID(telegramID int64) (*domain.User, error) {
 	return s.repo.GetByTelegramID(telegramID)
 }
+
+// SetAutoRenew включает или отключает автопродление и возвращает
+// обновлённого пользователя. При отключении сохранённая карта забывается.
+func (s *userServiceImpl) SetAutoRenew(telegramID int64, enabled bool) (*domain.User, error) {
+	user, err := s.repo.GetByTelegramID(telegramID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetAutoRenew(user.ID, enabled); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(user.ID)
+}
+
+// SetReceiptContact сохраняет email или телефон, на который провайдер
+// отправит чек.
+func (s *userServiceImpl) SetReceiptContact(telegramID int64, contact string) error {
+	user, err := s.repo.GetByTelegramID(telegramID)
+	if err != nil {
+		return err
+	}
+
+	contact = strings.TrimSpace(contact)
+	if strings.Contains(contact, "@") {
+		addr, err := mail.ParseAddress(contact)
+		if err != nil || addr.Address != contact {
+			return ErrInvalidContact
+		}
+		return s.repo.SetContact(user.ID, contact, "")
+	}
+
+	phone, ok := normalizePhone(contact)
+	if !ok {
+		return ErrInvalidContact
+	}
+	return s.repo.SetContact(user.ID, "", phone)
+}
+
+// normalizePhone приводит номер к формату E.164 без плюса, который ждёт
+// ЮKassa: 79001234567. Российские номера с 8 или без кода страны дополняются.
+func normalizePhone(s string) (string, bool) {
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune("+-() ", r):
+		default:
+			return "", false
+		}
+	}
+
+	phone := digits.String()
+	switch {
+	case len(phone) == 10:
+		phone = "7" + phone
+	case len(phone) == 11 && phone[0] == '8':
+		phone = "7" + phone[1:]
+	}
+	if len(phone) < 11 || len(phone) > 15 {
+		return "", false
+	}
+	return phone, true
+}
@@ -2,39 +2,183 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"time"
 	"vpn-bot/internal/domain"
+	"vpn-bot/internal/qr"
 	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+var (
+	errKeyNotOwned = errors.New("VPN-ключ не принадлежит пользователю")
+	errKeyRevoked  = errors.New("VPN-ключ отозван")
 )
 
 type vpnKeyServiceImpl struct {
-	repo repository.VPNKeyRepository
+	repo        repository.VPNKeyRepository
+	deliveries  repository.PendingDeliveryRepository
+	uow         repository.UnitOfWork
+	notifier    Notifier
+	provisioner VPNProvisioner
 }
 
-func NewVPNKeyService(r repository.VPNKeyRepository) VPNKeyService {
-	return &vpnKeyServiceImpl{repo: r}
+func NewVPNKeyService(
+	r repository.VPNKeyRepository,
+	deliveries repository.PendingDeliveryRepository,
+	uow repository.UnitOfWork,
+	notifier Notifier,
+	provisioner VPNProvisioner,
+) VPNKeyService {
+	return &vpnKeyServiceImpl{
+		repo:        r,
+		deliveries:  deliveries,
+		uow:         uow,
+		notifier:    notifier,
+		provisioner: provisioner,
+	}
 }
 
-func (s *vpnKeyServiceImpl) AssignFreeKeyToUser(userID int) (string, error) {
-	key, err := s.repo.FindFreeKey()
+// Функции ниже принимают репозиторий и VPNProvisioner явно, чтобы их
+// вызывали с привязанными к транзакции UnitOfWork.
+
+func claimKey(p VPNProvisioner, userID int, plan *domain.Plan) (*domain.VPNKey, error) {
+	key, err := p.CreateClient(userID, plan.ExpiresAt(time.Now()))
+	if errors.Is(err, repository.ErrNoFreeKeys) {
+		log.Println("⚠️ Нет свободных VPN-ключей. Добавьте новые в базу!")
+		return nil, err
+	}
 	if err != nil {
-		log.Println("❌ Ошибка при поиске VPN-ключа:", err)
-		return "", err
+		log.Println("❌ Ошибка при назначении VPN-ключа:", err)
+		return nil, err
 	}
-	if key == nil {
-		log.Println("⚠️ Нет свободных VPN-ключей. Добавьте новые в базу!")
-		return "", errors.New("нет свободных VPN-ключей")
+
+	log.Printf("✅ VPN-ключ %s назначен пользователю %d", key.Label(), userID)
+	return key, nil
+}
+
+// claimKeyForPayment выдаёт ключ, зарезервированный за платежом при оформлении,
+// а если резерв уже занят или его не было — любой свободный. Без пула ключ
+// сразу создаётся на VPN-сервере.
+func claimKeyForPayment(p VPNProvisioner, pay *domain.Payment, plan *domain.Plan) (*domain.VPNKey, error) {
+	pool, ok := p.(VPNKeyPool)
+	if !ok {
+		return claimKey(p, pay.UserID, plan)
 	}
+	key, err := pool.ClaimReservedKey(pay.ID, pay.UserID, plan.ExpiresAt(time.Now()))
+	if errors.Is(err, repository.ErrNoFreeKeys) {
+		log.Printf("⚠️ Резерв по платежу %s не найден, выдаём свободный ключ", pay.PaymentID)
+		return claimKey(p, pay.UserID, plan)
+	}
+	if err != nil {
+		log.Println("❌ Ошибка при выдаче зарезервированного VPN-ключа:", err)
+		return nil, err
+	}
+
+	log.Printf("✅ Зарезервированный VPN-ключ %s назначен пользователю %d", key.Label(), pay.UserID)
+	return key, nil
+}
 
-	err = s.repo.AssignKeyToUser(key.ID, userID, time.Now().Add(30*24*time.Hour))
+// notifyKey отправляет сообщение о выданном ключе и его QR-код.
+// Конфигурация WireGuard не помещается в сообщение и уходит файлом,
+// подписью к которому становится text.
+func notifyKey(n Notifier, telegramID int64, text string, key *domain.VPNKey) error {
+	var err error
+	if key.IsConfig() {
+		err = n.NotifyDocument(telegramID, text, key.FileName(), []byte(key.Key))
+	} else {
+		err = n.Notify(telegramID, text)
+	}
 	if err != nil {
-		log.Println("❌ Ошибка при назначении VPN-ключа:", err)
-		return "", err
+		return err
+	}
+
+	png, caption, err := qr.KeyPhoto(key)
+	if err != nil {
+		// Ключ уже отправлен текстом, без картинки пользователь обойдётся.
+		log.Printf("⚠️ Не удалось построить QR-код VPN-ключа %d: %v", key.ID, err)
+		return nil
+	}
+	return n.NotifyPhoto(telegramID, caption, png)
+}
+
+func renewKey(repo repository.VPNKeyRepository, p VPNProvisioner, userID, keyID int, plan *domain.Plan) (*domain.VPNKey, error) {
+	key, err := repo.GetByID(keyID)
+	if err != nil {
+		log.Println("❌ Ошибка при поиске VPN-ключа для продления:", err)
+		return nil, err
+	}
+	if key.UserID == nil || *key.UserID != userID {
+		return nil, errKeyNotOwned
+	}
+	if key.Status == domain.VPNKeyStatusRevoked {
+		return nil, errKeyRevoked
+	}
+
+	// Продлеваем от текущей даты окончания, а если ключ уже истёк — от текущего момента.
+	base := time.Now()
+	if key.ExpiresAt != nil && key.ExpiresAt.After(base) {
+		base = *key.ExpiresAt
+	}
+	expiresAt := plan.ExpiresAt(base)
+
+	err = p.ExtendClient(key, expiresAt)
+	if err != nil {
+		log.Println("❌ Ошибка при продлении VPN-ключа:", err)
+		return nil, err
+	}
+	key.ExpiresAt = &expiresAt
+	key.Status = domain.VPNKeyStatusActive
+
+	log.Printf("✅ VPN-ключ %d продлён до %s", key.ID, expiresAt.Format("02.01.2006"))
+	return key, nil
+}
+
+// shortenKey и revokeKey возвращают errKeyNotOwned, если ключ успел
+// перейти к другому пользователю: пул выдаёт освободившиеся ключи заново.
+func shortenKey(repo repository.VPNKeyRepository, p VPNProvisioner, userID, keyID int, plan *domain.Plan) (*domain.VPNKey, error) {
+	key, err := repo.GetByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.UserID == nil || *key.UserID != userID {
+		return nil, errKeyNotOwned
+	}
+	if key.ExpiresAt == nil || key.Status == domain.VPNKeyStatusRevoked {
+		return key, nil
+	}
+
+	expiresAt := key.ExpiresAt.AddDate(0, -plan.Months, 0)
+	err = p.ExtendClient(key, expiresAt)
+	if err != nil {
+		log.Println("❌ Ошибка при сокращении срока VPN-ключа:", err)
+		return nil, err
 	}
+	key.ExpiresAt = &expiresAt
 
-	log.Printf("✅ VPN-ключ %s назначен пользователю %d", key.Key, userID)
-	return key.Key, nil
+	log.Printf("↩️ Срок VPN-ключа %d сокращён до %s", key.ID, expiresAt.Format("02.01.2006"))
+	return key, nil
+}
+
+func revokeKey(repo repository.VPNKeyRepository, p VPNProvisioner, userID, keyID int) (*domain.VPNKey, error) {
+	key, err := repo.GetByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key.UserID == nil || *key.UserID != userID {
+		return nil, errKeyNotOwned
+	}
+
+	err = p.RevokeClient(key)
+	if err != nil {
+		log.Println("❌ Ошибка при отзыве VPN-ключа:", err)
+		return nil, err
+	}
+	key.Status = domain.VPNKeyStatusRevoked
+
+	log.Printf("🚫 VPN-ключ %d отозван", key.ID)
+	return key, nil
 }
 
 func (s *vpnKeyServiceImpl) GetKeysByUserTelegramID(telegramID int64) ([]domain.VPNKey, error) {
@@ -42,13 +186,152 @@ func (s *vpnKeyServiceImpl) GetKeysByUserTelegramID(telegramID int64) ([]domain.
 }
 
 func (s *vpnKeyServiceImpl) AddNewKey(key string) error {
-	return s.repo.AddKey(key)
+	if err := s.repo.AddKey(key); err != nil {
+		return err
+	}
+	s.deliverAfterRestock()
+	return nil
 }
 
+func (s *vpnKeyServiceImpl) AddNewKeys(keys []string) (int, error) {
+	added := 0
+	for _, key := range keys {
+		if err := s.repo.AddKey(key); err != nil {
+			if added > 0 {
+				s.deliverAfterRestock()
+			}
+			return added, err
+		}
+		added++
+	}
+	if added > 0 {
+		s.deliverAfterRestock()
+	}
+	return added, nil
+}
+
+// DeliverPending раздаёт свободные ключи оплаченным покупкам из очереди
+// в порядке поступления и возвращает число выданных ключей.
+func (s *vpnKeyServiceImpl) DeliverPending() (int, error) {
+	delivered := 0
+	for {
+		done, dropped := false, false
+
+		err := s.uow.Do(func(r repository.Repositories) error {
+			d, err := r.Deliveries.LockOldestPending()
+			if err != nil {
+				return err
+			}
+			if d == nil {
+				done = true
+				return nil
+			}
+
+			pay, err := r.Payments.GetByID(d.PaymentID)
+			if err != nil {
+				return err
+			}
+			if pay.Status != domain.PaymentStatusSucceeded {
+				// Платёж вернули или отменили, пока покупка ждала ключ.
+				log.Printf("⚠️ Платёж %s в статусе %s, убираем его из очереди выдачи", pay.PaymentID, pay.Status)
+				dropped = true
+				return r.Deliveries.CancelByPayment(pay.ID)
+			}
+			plan, err := paymentPlan(r.Plans, pay)
+			if err != nil {
+				return err
+			}
+
+			key, err := claimKey(s.provisioner.WithTx(r), d.UserID, plan)
+			if errors.Is(err, repository.ErrNoFreeKeys) {
+				done = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := r.Payments.SetPaymentKey(pay.ID, key.ID); err != nil {
+				return err
+			}
+			if err := r.Deliveries.MarkDelivered(d.ID, key.ID); err != nil {
+				return err
+			}
+
+			user, err := r.Users.GetByID(d.UserID)
+			if err != nil {
+				return err
+			}
+			msg := fmt.Sprintf("✅ Ключи пополнены! Ваш VPN-ключ: %s (действует до %s)", key.Label(), key.ExpiresAt.Format("02.01.2006"))
+			return notifyKey(notifierInTx(s.notifier, r), user.TelegramID, msg, key)
+		})
+		if err != nil {
+			return delivered, err
+		}
+		if done {
+			return delivered, nil
+		}
+		if !dropped {
+			delivered++
+		}
+	}
+}
+
+func (s *vpnKeyServiceImpl) deliverAfterRestock() {
+	delivered, err := s.DeliverPending()
+	if err != nil {
+		log.Println("❌ Ошибка выдачи ключей из очереди:", err)
+	}
+	if delivered == 0 {
+		return
+	}
+
+	log.Printf("📦 Выдано ключей из очереди: %d", delivered)
+
+	remaining, err := s.deliveries.CountPending()
+	if err != nil {
+		log.Println("❌ Ошибка подсчёта очереди выдачи:", err)
+		return
+	}
+	text := fmt.Sprintf("📦 Выдано ключей из очереди: %d. Ещё ожидают: %d.", delivered, remaining)
+	if err := s.notifier.NotifyAdmins(text); err != nil {
+		log.Println("❌ Ошибка уведомления администраторов об очереди:", err)
+	}
+}
+
+// HasFreeKeys проверяет запас пула; VPN-сервер создаёт ключи без ограничений.
 func (s *vpnKeyServiceImpl) HasFreeKeys() (bool, error) {
-	count, err := s.repo.CountFreeKeys()
+	pool, ok := s.provisioner.(VPNKeyPool)
+	if !ok {
+		return true, nil
+	}
+	return pool.HasFreeKeys()
+}
+
+func (s *vpnKeyServiceImpl) GetKeyUsage(key *domain.VPNKey) (*vpn.Usage, error) {
+	return s.provisioner.Usage(key)
+}
+
+// SuspendKey отключает истёкший ключ на сервере; продление включит его снова.
+func (s *vpnKeyServiceImpl) SuspendKey(key *domain.VPNKey) error {
+	return s.provisioner.SuspendClient(key)
+}
+
+// DeleteExpiredKeys удаляет с VPN-сервера клиентов, чьи ключи истекли до
+// expiredBefore, и отмечает ключи отозванными. Ключи из пула не трогает.
+func (s *vpnKeyServiceImpl) DeleteExpiredKeys(expiredBefore time.Time) (int, error) {
+	keys, err := s.repo.FindExpiredIssuedKeys(expiredBefore)
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+
+	deleted := 0
+	for i := range keys {
+		if err := s.provisioner.RevokeClient(&keys[i]); err != nil {
+			log.Printf("❌ Ошибка удаления ключа %d с VPN-сервера: %v", keys[i].ID, err)
+			continue
+		}
+		deleted++
 	}
-	return count > 0, nil
+	return deleted, nil
 }
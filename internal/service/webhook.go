@@ -0,0 +1,249 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/repository"
+)
+
+// HandleWebhook разбирает уведомление провайдера и обрабатывает его событие.
+func (s *paymentServiceImpl) HandleWebhook(providerName string, header http.Header, payload []byte) error {
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+	event, err := provider.ParseWebhook(header, payload)
+	if err != nil {
+		return err
+	}
+	return s.HandleEvent(providerName, event)
+}
+
+// HandleEvent сохраняет событие провайдера и обрабатывает его ровно один
+// раз: повторные доставки уже обработанного события игнорируются.
+func (s *paymentServiceImpl) HandleEvent(providerName string, e *payment.Event) error {
+	log.Printf("📩 Событие %s от %s: объект %s, платёж %s, сумма %s %s",
+		e.Name, providerName, e.ObjectID, e.PaymentID, e.Amount.Value, e.Amount.Currency)
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	event := &domain.WebhookEvent{
+		Provider: providerName,
+		Event:    e.Name,
+		ObjectID: e.ObjectID,
+		Payload:  payload,
+	}
+
+	var created bool
+	err = s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		created, err = r.WebhookEvents.Record(event)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !created && event.Status == domain.WebhookEventStatusProcessed {
+		log.Printf("🔁 Повторная доставка события %d (%s), пропускаем", event.ID, event.Event)
+		return nil
+	}
+
+	return s.processEvent(event.ID, false)
+}
+
+// HandleInvoicePayment обрабатывает оплату счёта Telegram. Обновление
+// successful_payment не говорит, деньгами или звёздами оплачен счёт, поэтому
+// событие записывается от провайдера, через которого создан платёж: под тем
+// же именем потом записывается и возврат.
+func (s *paymentServiceImpl) HandleInvoicePayment(e *payment.Event) error {
+	pay, err := s.repo.GetByPaymentID(e.PaymentID)
+	if err != nil {
+		return err
+	}
+	return s.HandleEvent(pay.Provider, e)
+}
+
+// CheckPreCheckout проверяет перед списанием, что счёт ещё можно оплатить
+// и на ту сумму, на которую он выставлен.
+func (s *paymentServiceImpl) CheckPreCheckout(paymentID string, amount payment.Amount) error {
+	pay, err := s.repo.GetByPaymentID(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.Status != domain.PaymentStatusPending {
+		return fmt.Errorf("%w: платёж %s в статусе %s", repository.ErrInvalidPaymentTransition, paymentID, pay.Status)
+	}
+	if !amountMatches(pay, amount) {
+		return fmt.Errorf("платёж %s выставлен на %.2f %s, а оплачивается %s %s",
+			paymentID, pay.Amount, pay.Currency, amount.Value, amount.Currency)
+	}
+	return nil
+}
+
+// ReplayWebhookEvent повторно обрабатывает сохранённое событие, даже если
+// оно уже было обработано. Обработчики событий идемпотентны, поэтому
+// повтор не выдаст ключ и не отправит сообщения дважды.
+func (s *paymentServiceImpl) ReplayWebhookEvent(eventID int64) error {
+	return s.processEvent(eventID, true)
+}
+
+// processEvent обрабатывает событие в одной транзакции с блокировкой его
+// строки: параллельная доставка дождётся коммита и увидит статус processed.
+func (s *paymentServiceImpl) processEvent(eventID int64, force bool) error {
+	var after func() error
+	err := s.uow.Do(func(r repository.Repositories) error {
+		event, err := r.WebhookEvents.GetByIDForUpdate(eventID)
+		if err != nil {
+			return err
+		}
+		if event.Status == domain.WebhookEventStatusProcessed && !force {
+			log.Printf("🔁 Событие %d уже обработано параллельной доставкой", event.ID)
+			return nil
+		}
+
+		after, err = s.dispatchEvent(r, event)
+		if err != nil {
+			return err
+		}
+		return r.WebhookEvents.MarkProcessed(event.ID)
+	})
+	if err != nil {
+		s.recordEventFailure(eventID, err)
+		return err
+	}
+	if after != nil {
+		return after()
+	}
+	return nil
+}
+
+// dispatchEvent применяет событие в транзакции r. Возвращённая функция
+// выполняется после коммита: там то, что нельзя делать внутри транзакции.
+func (s *paymentServiceImpl) dispatchEvent(r repository.Repositories, event *domain.WebhookEvent) (func() error, error) {
+	var e payment.Event
+	if err := json.Unmarshal(event.Payload, &e); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	switch e.Name {
+	case payment.EventPaymentSucceeded:
+		c, err := s.confirmPayment(r, e.PaymentID, e.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if e.TelegramChargeID != "" && !c.already {
+			if err := r.Payments.SetTelegramChargeID(c.pay.ID, e.TelegramChargeID); err != nil {
+				return nil, err
+			}
+		}
+		if !c.already {
+			if err := s.savePaymentMethod(r, c.pay, e.PaymentMethodID); err != nil {
+				return nil, err
+			}
+			if err := s.recordReceipt(r, c.pay, e.ReceiptRegistration); err != nil {
+				return nil, err
+			}
+		}
+		return func() error {
+			// Ошибка продления уже передана администраторам, событие обработано.
+			_ = c.report()
+			return nil
+		}, nil
+
+	case payment.EventPaymentWaitingForCapture:
+		_, already, err := s.markWaitingForCapture(r, e.PaymentID)
+		if err != nil || already || s.manualCapture {
+			return nil, err
+		}
+		// Платёж создан с capture=false до отключения ручного режима — подтверждаем сразу.
+		return func() error {
+			if err := s.CapturePayment(e.PaymentID); err != nil {
+				text := fmt.Sprintf("⚠️ Не удалось автоматически подтвердить платёж %s: %v\n/capture %s — повторить",
+					e.PaymentID, err, e.PaymentID)
+				return s.notifier.NotifyAdmins(text)
+			}
+			return nil
+		}, nil
+
+	case payment.EventPaymentCanceled:
+		pay, already, err := s.cancelPayment(r, e.PaymentID, e.CancellationParty, e.CancellationReason)
+		if err != nil || already {
+			return nil, err
+		}
+		log.Printf("❌ Платёж %s отменён (%s: %s)", e.PaymentID, e.CancellationParty, e.CancellationReason)
+		if !pay.Recurring {
+			return nil, nil
+		}
+		return func() error {
+			// Событие уже обработано: ошибку только передаём администраторам.
+			if err := s.offerManualRenewal(pay, e.CancellationReason); err != nil {
+				return s.notifier.NotifyAdmins(fmt.Sprintf("⚠️ Не удалось предложить продление по платежу %s: %v", e.PaymentID, err))
+			}
+			return nil
+		}, nil
+
+	case payment.EventRefundSucceeded:
+		if e.PartialRefund {
+			log.Printf("🔄 Частичный возврат %s по платежу %s: %s %s", e.ObjectID, e.PaymentID, e.Amount.Value, e.Amount.Currency)
+			text := fmt.Sprintf("🔄 По платежу %s вернули часть суммы: %s %s. Ключ не отозван — проверьте покупку вручную.",
+				e.PaymentID, e.Amount.Value, e.Amount.Currency)
+			return nil, notifierInTx(s.notifier, r).NotifyAdmins(text)
+		}
+		_, already, err := s.refundPayment(r, e.PaymentID)
+		if err != nil {
+			return nil, err
+		}
+		if !already {
+			log.Printf("🔄 Платёж %s помечен как возвращённый", e.PaymentID)
+		}
+		return nil, nil
+	}
+
+	log.Println("❓ Неизвестное событие:", e.Name)
+	return nil, nil
+}
+
+// recordReceipt сохраняет статус регистрации чека. Если касса отказалась
+// регистрировать чек, администратор должен пробить его вручную.
+func (s *paymentServiceImpl) recordReceipt(r repository.Repositories, pay *domain.Payment, status string) error {
+	if status == "" {
+		return nil
+	}
+	if err := r.Payments.SetReceiptRegistration(pay.ID, status); err != nil {
+		return err
+	}
+	if status != payment.ReceiptRegistrationCanceled {
+		return nil
+	}
+	text := fmt.Sprintf("🧾 Чек по платежу %s (пользователь %d, %.2f %s) не зарегистрирован. Пробейте его вручную.",
+		pay.PaymentID, pay.UserID, pay.Amount, pay.Currency)
+	return notifierInTx(s.notifier, r).NotifyAdmins(text)
+}
+
+// recordEventFailure сохраняет ошибку обработки. Администраторов оповещаем
+// только о первой неудаче, чтобы повторные доставки не засыпали их сообщениями.
+func (s *paymentServiceImpl) recordEventFailure(eventID int64, procErr error) {
+	log.Printf("❌ Ошибка обработки события %d: %v", eventID, procErr)
+
+	var attempts int
+	err := s.uow.Do(func(r repository.Repositories) error {
+		var err error
+		attempts, err = r.WebhookEvents.MarkFailed(eventID, procErr.Error())
+		if err != nil || attempts > 1 {
+			return err
+		}
+		text := fmt.Sprintf("⚠️ Не удалось обработать вебхук %d: %v\n/replay_event %d — обработать повторно",
+			eventID, procErr, eventID)
+		return notifierInTx(s.notifier, r).NotifyAdmins(text)
+	})
+	if err != nil {
+		log.Printf("❌ Ошибка сохранения неудачи события %d: %v", eventID, err)
+	}
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPAllowlist пропускает к обработчику только запросы с разрешённых адресов.
+type IPAllowlist struct {
+	nets []*net.IPNet
+	// trustForwardedFor — бот стоит за обратным прокси, и адрес клиента
+	// берётся из последнего значения X-Forwarded-For.
+	trustForwardedFor bool
+}
+
+// NewIPAllowlist разбирает список адресов и подсетей в нотации CIDR.
+// Пустой список отключает проверку.
+func NewIPAllowlist(entries []string, trustForwardedFor bool) (*IPAllowlist, error) {
+	a := &IPAllowlist{trustForwardedFor: trustForwardedFor}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный адрес в списке разрешённых: %w", err)
+		}
+		a.nets = append(a.nets, ipNet)
+	}
+	return a, nil
+}
+
+func (a *IPAllowlist) Wrap(next http.Handler) http.Handler {
+	if len(a.nets) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := a.clientIP(r)
+		if !a.allowed(ip) {
+			if !a.trustForwardedFor && ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+				// Так выглядят все вебхуки, если бот стоит за nginx или балансировщиком.
+				log.Printf("🚨 Вебхук на %s отклонён: адрес %s похож на обратный прокси. "+
+					"Включите TRUST_FORWARDED_FOR=true или отключите YOOKASSA_ALLOWED_IPS, иначе платежи не подтверждаются", r.URL.Path, ip)
+			}
+			log.Printf("❌ Запрос к %s с неразрешённого адреса %s", r.URL.Path, ip)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *IPAllowlist) clientIP(r *http.Request) net.IP {
+	if a.trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return net.ParseIP(strings.TrimSpace(parts[len(parts)-1]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func (a *IPAllowlist) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
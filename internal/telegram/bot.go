@@ -10,9 +10,16 @@ type Handler struct {
 	userService        service.UserService
 	vpnKeyService      service.VPNKeyService
 	paymentService     service.PaymentService
+	planService        service.PlanService
+	notifier           service.Notifier
 	adminIDs           []int64
 	expectedAuthHeader string
 	secretKey          []byte
+
+	// pendingPayments — оплаты, ждущие контакт для чека: Telegram ID →
+	// данные нажатой кнопки. Обновления обрабатываются по одному, поэтому
+	// блокировка не нужна.
+	pendingPayments map[int64]string
 }
 
 func NewHandler(
@@ -20,6 +27,8 @@ func NewHandler(
 	userService service.UserService,
 	vpnKeyService service.VPNKeyService,
 	paymentService service.PaymentService,
+	planService service.PlanService,
+	notifier service.Notifier,
 	adminIDs []int64,
 	expectedAuthHeader string,
 	secretKey []byte,
@@ -29,9 +38,12 @@ func NewHandler(
 		userService:        userService,
 		vpnKeyService:      vpnKeyService,
 		paymentService:     paymentService,
+		planService:        planService,
+		notifier:           notifier,
 		adminIDs:           adminIDs,
 		expectedAuthHeader: expectedAuthHeader,
 		secretKey:          secretKey,
+		pendingPayments:    make(map[int64]string),
 	}
 }
 
@@ -50,9 +62,14 @@ func (h *Handler) RunBot() {
 
 	updates := h.bot.GetUpdatesChan(u)
 	for update := range updates {
-		if update.Message != nil {
+		switch {
+		case update.PreCheckoutQuery != nil:
+			h.handlePreCheckoutQuery(update.PreCheckoutQuery)
+		case update.Message != nil && update.Message.SuccessfulPayment != nil:
+			h.handleSuccessfulPayment(update.Message)
+		case update.Message != nil:
 			h.handleMessage(update)
-		} else if update.CallbackQuery != nil {
+		case update.CallbackQuery != nil:
 			h.handleCallbackQuery(update)
 		}
 	}
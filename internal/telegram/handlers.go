@@ -1,11 +1,17 @@
 package telegram
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/payment"
+	"vpn-bot/internal/qr"
+	"vpn-bot/internal/service"
 )
 
 func (h *Handler) handleMessage(update tgbotapi.Update) {
@@ -21,18 +27,52 @@ func (h *Handler) handleMessage(update tgbotapi.Update) {
 
 	if h.IsAdmin(msg.From.ID) {
 		log.Println("Пользователь является администратором")
+		if strings.HasPrefix(text, "/add_keys") {
+			h.handleAddKeysCommand(chatID, text)
+			return
+		}
 		if strings.HasPrefix(text, "/add_key ") {
 			log.Println("Обнаружена команда /add_key")
 			h.handleAddKeyCommand(chatID, text)
 			return
 		}
+		if strings.HasPrefix(text, "/capture ") {
+			h.handleCaptureCommand(chatID, text)
+			return
+		}
+		if strings.HasPrefix(text, "/cancel_payment ") {
+			h.handleCancelPaymentCommand(chatID, text)
+			return
+		}
+		if strings.HasPrefix(text, "/refund ") {
+			h.handleRefundCommand(chatID, text)
+			return
+		}
+		if strings.HasPrefix(text, "/replay_event ") {
+			h.handleReplayEventCommand(chatID, text)
+			return
+		}
+	}
+
+	if msg.Contact != nil && msg.Contact.UserID == msg.From.ID {
+		h.handleReceiptContact(chatID, msg.From.ID, msg.Contact.PhoneNumber)
+		return
+	}
+
+	if token, ok := strings.CutPrefix(text, "/start "+paidStartPrefix); ok {
+		h.processCheckPayment(chatID, msg.From.ID, token)
+		return
 	}
 
 	switch text {
-	case "/start", "Купить VPN", "Мои ключи", "Продлить ключ", "Статус ключа":
+	case "/start", "Купить VPN", "Мои ключи", "Продлить ключ", "Статус ключа", "Автопродление":
 		h.handleUserCommand(chatID, text, int(msg.From.ID), msg.From.UserName)
 
 	default:
+		if h.awaitsReceiptContact(msg.From.ID) {
+			h.handleReceiptContact(chatID, msg.From.ID, text)
+			return
+		}
 		log.Println("Команда не распознана, отправляем стандартный ответ")
 		h.sendMessageText(chatID, "❓ Неизвестная команда. Выберите действие:")
 	}
@@ -64,30 +104,63 @@ func (h *Handler) handleUserCommand(chatID int64, text string, userID int, usern
 
 	case "Статус ключа":
 		h.processKeyStatus(chatID, userID)
+
+	case "Автопродление":
+		h.processAutoRenew(chatID, int64(userID))
 	}
 }
 
 func (h *Handler) processBuyVPN(chatID int64, userID int) {
-	user, err := h.userService.GetUserByTelegramID(int64(userID))
+	hasKeys, err := h.vpnKeyService.HasFreeKeys()
+	if err != nil || !hasKeys {
+		h.sendErrorMessage(chatID, "⚠️ Временно нет свободных VPN-ключей. Попробуйте позже.")
+		return
+	}
+
+	h.sendPlansKeyboard(chatID, "💳 Выберите тариф:", buyPlanPrefix)
+}
+
+func (h *Handler) processBuyPlan(chatID int64, telegramID int64, planID int) {
+	user, err := h.userService.GetUserByTelegramID(telegramID)
 	if err != nil {
-		log.Printf("Ошибка получения пользователя %d: %v", userID, err)
+		log.Printf("Ошибка получения пользователя %d: %v", telegramID, err)
 		h.sendErrorMessage(chatID, "Ошибка получения данных пользователя. Попробуйте позже.")
 		return
 	}
 
+	plan, err := h.planService.GetActivePlan(planID)
+	if err != nil {
+		log.Printf("Ошибка получения тарифа %d: %v", planID, err)
+		h.sendErrorMessage(chatID, "Тариф недоступен. Выберите другой.")
+		return
+	}
+
 	hasKeys, err := h.vpnKeyService.HasFreeKeys()
 	if err != nil || !hasKeys {
 		h.sendErrorMessage(chatID, "⚠️ Временно нет свободных VPN-ключей. Попробуйте позже.")
 		return
 	}
 
-	paymentURL, err := h.paymentService.CreatePayment(user.ID, 299, "Покупка VPN")
+	checkout, err := h.paymentService.CreatePayment(user.ID, plan)
+	if errors.Is(err, service.ErrNoFreeKeys) {
+		h.sendErrorMessage(chatID, "⚠️ Временно нет свободных VPN-ключей. Попробуйте позже.")
+		return
+	}
+	if errors.Is(err, service.ErrContactRequired) {
+		h.askReceiptContact(chatID, telegramID, buyPlanPrefix+strconv.Itoa(planID))
+		return
+	}
 	if err != nil {
+		log.Println("❌ Ошибка создания платежа:", err)
 		h.sendErrorMessage(chatID, "Ошибка при создании платежа. Попробуйте позже.")
 		return
 	}
 
-	h.sendMessageText(chatID, fmt.Sprintf("💳 Оплатите по ссылке: %s", paymentURL))
+	if checkout.ConfirmationURL == "" {
+		// Счёт уже отправлен в чат платежами Telegram.
+		return
+	}
+	h.sendPaymentLink(chatID, fmt.Sprintf("💳 Оплатите по ссылке: %s", checkout.ConfirmationURL), checkout)
 }
 
 func (h *Handler) processMyKeys(chatID int64, userID int) {
@@ -106,25 +179,133 @@ func (h *Handler) processMyKeys(chatID int64, userID int) {
 	var text strings.Builder
 	text.WriteString("🔑 Ваши VPN-ключи:\n")
 	for _, k := range keys {
-		text.WriteString(fmt.Sprintf("Ключ: `%s`, истекает: *%v*\n", k.Key, k.ExpiresAt.Format("02.01.2006")))
+		text.WriteString(fmt.Sprintf("Ключ: `%s`, истекает: *%v*\n", k.Label(), k.ExpiresAt.Format("02.01.2006")))
 	}
 	h.sendMessageMarkdown(chatID, text.String())
+
+	// Действующие ключи — QR-кодами, а конфигурации WireGuard ещё и файлами
+	// для импорта.
+	for _, k := range keys {
+		if k.Status != domain.VPNKeyStatusActive {
+			continue
+		}
+		if k.IsConfig() {
+			caption := fmt.Sprintf("🔑 %s, истекает: %v", k.Label(), k.ExpiresAt.Format("02.01.2006"))
+			h.sendDocument(chatID, caption, k.FileName(), []byte(k.Key))
+		}
+		h.sendKeyQRCode(chatID, &k)
+	}
 }
 
 func (h *Handler) processRenewKey(chatID int64, userID int) {
-	user, err := h.userService.GetUserByTelegramID(int64(userID))
+	keys, err := h.vpnKeyService.GetKeysByUserTelegramID(int64(userID))
+	if err != nil {
+		log.Printf("Ошибка получения ключей пользователя %d: %v", userID, err)
+		h.sendErrorMessage(chatID, "Ошибка при получении ключей.")
+		return
+	}
+
+	keys = renewableKeys(keys)
+	if len(keys) == 0 {
+		h.sendMessageText(chatID, "🔑 У вас нет ключей для продления.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "🔄 Выберите ключ для продления:")
+	msg.ReplyMarkup = renewKeysKeyboard(keys)
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки списка ключей:", err)
+	}
+}
+
+func (h *Handler) processRenewKeyChoice(chatID int64, telegramID int64, keyID int) {
+	keys, err := h.vpnKeyService.GetKeysByUserTelegramID(telegramID)
 	if err != nil {
+		log.Println("❌ Ошибка получения ключей:", err)
+		h.sendErrorMessage(chatID, "Ошибка при получении ключей.")
+		return
+	}
+	if !containsRenewableKey(keys, keyID) {
+		h.sendErrorMessage(chatID, "Ключ не найден.")
+		return
+	}
+
+	h.sendPlansKeyboard(chatID, "🔄 Выберите срок продления:", fmt.Sprintf("%s%d:", renewPlanPrefix, keyID))
+}
+
+func (h *Handler) processRenewPlan(chatID int64, telegramID int64, keyID, planID int) {
+	user, err := h.userService.GetUserByTelegramID(telegramID)
+	if err != nil {
+		log.Println("❌ Ошибка получения пользователя:", err)
 		h.sendErrorMessage(chatID, "Ошибка получения данных пользователя.")
 		return
 	}
 
-	paymentURL, err := h.paymentService.CreatePayment(user.ID, 199, "Продление VPN")
+	keys, err := h.vpnKeyService.GetKeysByUserTelegramID(telegramID)
 	if err != nil {
+		log.Println("❌ Ошибка получения ключей:", err)
+		h.sendErrorMessage(chatID, "Ошибка при получении ключей.")
+		return
+	}
+	if !containsRenewableKey(keys, keyID) {
+		h.sendErrorMessage(chatID, "Ключ не найден.")
+		return
+	}
+
+	plan, err := h.planService.GetActivePlan(planID)
+	if err != nil {
+		log.Printf("Ошибка получения тарифа %d: %v", planID, err)
+		h.sendErrorMessage(chatID, "Тариф недоступен. Выберите другой.")
+		return
+	}
+
+	checkout, err := h.paymentService.CreateRenewalPayment(user.ID, keyID, plan)
+	if errors.Is(err, service.ErrContactRequired) {
+		h.askReceiptContact(chatID, telegramID, fmt.Sprintf("%s%d:%d", renewPlanPrefix, keyID, planID))
+		return
+	}
+	if err != nil {
+		log.Println("❌ Ошибка создания платежа:", err)
 		h.sendErrorMessage(chatID, "Ошибка при создании платежа. Попробуйте позже.")
 		return
 	}
 
-	h.sendMessageText(chatID, fmt.Sprintf("🔄 Оплатите продление по ссылке: %s", paymentURL))
+	if checkout.ConfirmationURL == "" {
+		return
+	}
+	h.sendPaymentLink(chatID, fmt.Sprintf("🔄 Оплатите продление по ссылке: %s", checkout.ConfirmationURL), checkout)
+}
+
+func (h *Handler) sendPlansKeyboard(chatID int64, text, dataPrefix string) {
+	plans, err := h.planService.GetActivePlans()
+	if err != nil {
+		log.Println("❌ Ошибка получения тарифов:", err)
+		h.sendErrorMessage(chatID, "Ошибка при получении тарифов. Попробуйте позже.")
+		return
+	}
+
+	// Цена показывается в валюте провайдера тарифа: за звёзды — в звёздах.
+	var available []domain.Plan
+	prices := make(map[int]string, len(plans))
+	for i := range plans {
+		price, currency, err := h.paymentService.PlanPrice(&plans[i])
+		if err != nil {
+			log.Printf("⚠️ Тариф %d скрыт: %v", plans[i].ID, err)
+			continue
+		}
+		available = append(available, plans[i])
+		prices[plans[i].ID] = formatPrice(price, currency)
+	}
+	if len(available) == 0 {
+		h.sendErrorMessage(chatID, "Сейчас нет доступных тарифов.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = plansKeyboard(available, prices, dataPrefix)
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки списка тарифов:", err)
+	}
 }
 
 func (h *Handler) processKeyStatus(chatID int64, userID int) {
@@ -141,10 +322,136 @@ func (h *Handler) processKeyStatus(chatID int64, userID int) {
 
 	var activeKeys []string
 	for _, k := range keys {
-		activeKeys = append(activeKeys, fmt.Sprintf("🔑 `%s` (Истекает: *%v*)", k.Key, k.ExpiresAt.Format("02.01.2006")))
+		activeKeys = append(activeKeys, keyStatusLine(k)+h.keyUsageText(&k))
 	}
 
-	h.sendMessageMarkdown(chatID, "📌 Ваши активные ключи:\n"+strings.Join(activeKeys, "\n"))
+	h.sendMessageMarkdown(chatID, "📌 Ваши ключи:\n"+strings.Join(activeKeys, "\n"))
+}
+
+// paidStartPrefix — параметр /start, с которым пользователь возвращается
+// в бота после оплаты: t.me/<бот>?start=paid_<токен платежа>.
+const paidStartPrefix = "paid_"
+
+// sendPaymentLink отправляет ссылку на оплату с кнопкой «Проверить оплату»:
+// если уведомление о платеже задержится, пользователь проверит его сам.
+func (h *Handler) sendPaymentLink(chatID int64, text string, checkout *service.Checkout) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄 Проверить оплату", checkPaymentPrefix+checkout.ReturnToken),
+	))
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки ссылки на оплату:", err)
+	}
+}
+
+// processCheckPayment показывает итог оплаты, с которой пользователь вернулся
+// в бота или которую проверил кнопкой.
+func (h *Handler) processCheckPayment(chatID int64, telegramID int64, token string) {
+	pay, err := h.paymentService.CheckPayment(telegramID, token)
+	if errors.Is(err, service.ErrPaymentNotFound) {
+		h.sendErrorMessage(chatID, "Платёж не найден.")
+		h.sendMenuKeyboard(chatID)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка проверки платежа по токену %s: %v", token, err)
+		h.sendErrorMessage(chatID, "Не удалось проверить платёж. Попробуйте позже.")
+		return
+	}
+
+	h.sendMessageText(chatID, paymentResultText(pay))
+	h.sendMenuKeyboard(chatID)
+}
+
+func paymentResultText(pay *domain.Payment) string {
+	switch pay.Status {
+	case domain.PaymentStatusSucceeded:
+		return "✅ Оплата прошла! Подробности — в отдельном сообщении."
+	case domain.PaymentStatusWaitingForCapture:
+		return "⏳ Оплата получена и ждёт подтверждения. Мы сообщим, как только оно пройдёт."
+	case domain.PaymentStatusCanceled:
+		return "❌ Платёж отменён. Вы можете попробовать оплатить ещё раз."
+	case domain.PaymentStatusRefunded:
+		return "🔄 Средства по этому платежу возвращены."
+	}
+	return "⏳ Платёж ещё не завершён. Если вы уже оплатили, мы пришлём сообщение, как только получим подтверждение."
+}
+
+// processAutoRenew показывает состояние автопродления и кнопку, которая его
+// переключает.
+func (h *Handler) processAutoRenew(chatID int64, telegramID int64) {
+	user, err := h.userService.GetUserByTelegramID(telegramID)
+	if err != nil {
+		log.Printf("Ошибка получения пользователя %d: %v", telegramID, err)
+		h.sendErrorMessage(chatID, "Ошибка получения данных пользователя. Попробуйте позже.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, autoRenewStatusText(user))
+	msg.ReplyMarkup = autoRenewKeyboard(user.AutoRenew)
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки настроек автопродления:", err)
+	}
+}
+
+func (h *Handler) processSetAutoRenew(chatID int64, telegramID int64, enabled bool) {
+	user, err := h.userService.SetAutoRenew(telegramID, enabled)
+	if err != nil {
+		log.Printf("Ошибка изменения автопродления пользователя %d: %v", telegramID, err)
+		h.sendErrorMessage(chatID, "Не удалось изменить автопродление. Попробуйте позже.")
+		return
+	}
+	if !enabled {
+		h.sendMessageText(chatID, "🔁 Автопродление отключено, сохранённая карта удалена.")
+		return
+	}
+	h.sendMessageText(chatID, autoRenewStatusText(user))
+}
+
+func autoRenewStatusText(user *domain.User) string {
+	switch {
+	case !user.AutoRenew:
+		return "🔁 Автопродление отключено. Включите его, и мы будем продлевать ключ за несколько дней до окончания, " +
+			"списывая оплату с карты, которой вы платили."
+	case user.PaymentMethodID == "":
+		return "🔁 Автопродление включено. Оплатите покупку или продление картой — мы сохраним её для следующих списаний."
+	default:
+		return "🔁 Автопродление включено. За несколько дней до окончания ключ продлится списанием с сохранённой карты."
+	}
+}
+
+func keyStatusLine(k domain.VPNKey) string {
+	if k.Status == domain.VPNKeyStatusRevoked {
+		return fmt.Sprintf("🚫 `%s` (Отозван)", k.Label())
+	}
+	if k.Status == domain.VPNKeyStatusExpired {
+		return fmt.Sprintf("⌛ `%s` (Истёк: *%v*)", k.Label(), k.ExpiresAt.Format("02.01.2006"))
+	}
+	return fmt.Sprintf("🔑 `%s` (Истекает: *%v*)", k.Label(), k.ExpiresAt.Format("02.01.2006"))
+}
+
+// keyUsageText — израсходованный трафик ключа, если его знает VPN-сервер.
+func (h *Handler) keyUsageText(k *domain.VPNKey) string {
+	if k.Status == domain.VPNKeyStatusRevoked {
+		return ""
+	}
+	usage, err := h.vpnKeyService.GetKeyUsage(k)
+	if errors.Is(err, service.ErrVPNNotSupported) {
+		return ""
+	}
+	if err != nil {
+		log.Printf("⚠️ Не удалось получить трафик ключа %d: %v", k.ID, err)
+		return ""
+	}
+	return ", трафик: " + formatTraffic(usage.UsedBytes)
+}
+
+func formatTraffic(bytes int64) string {
+	const mb = 1 << 20
+	if bytes < 1<<30 {
+		return fmt.Sprintf("%.1f МБ", float64(bytes)/mb)
+	}
+	return fmt.Sprintf("%.2f ГБ", float64(bytes)/(1<<30))
 }
 
 func (h *Handler) sendMenuKeyboard(chatID int64) {
@@ -156,17 +463,105 @@ func (h *Handler) sendMenuKeyboard(chatID int64) {
 func (h *Handler) handleAddKeyCommand(chatID int64, text string) {
 	parts := splitBySpace(text)
 	if len(parts) < 2 {
-		h.bot.Send(tgbotapi.NewMessage(chatID, "Ошибка: нужно указать ключ. Пример: /add_key 12345"))
+		h.sendMessageText(chatID, "Ошибка: нужно указать ключ. Пример: /add_key 12345")
 		return
 	}
 	key := parts[1]
 
 	err := h.vpnKeyService.AddNewKey(key)
 	if err != nil {
-		h.bot.Send(tgbotapi.NewMessage(chatID, "Ошибка добавления ключа: "+err.Error()))
+		h.sendMessageText(chatID, "Ошибка добавления ключа: "+err.Error())
+		return
+	}
+	h.sendMessageText(chatID, "Ключ успешно добавлен.")
+}
+
+// handleAddKeysCommand добавляет несколько ключей сразу: по одному в строке
+// (или через пробел) после команды /add_keys.
+func (h *Handler) handleAddKeysCommand(chatID int64, text string) {
+	keys := strings.Fields(strings.TrimPrefix(text, "/add_keys"))
+	if len(keys) == 0 {
+		h.sendMessageText(chatID, "Ошибка: нужно указать ключи, по одному в строке после /add_keys.")
+		return
+	}
+
+	added, err := h.vpnKeyService.AddNewKeys(keys)
+	if err != nil {
+		h.sendMessageText(chatID, fmt.Sprintf("Добавлено ключей: %d из %d. Ошибка: %v", added, len(keys), err))
+		return
+	}
+	h.sendMessageText(chatID, fmt.Sprintf("Добавлено ключей: %d.", added))
+}
+
+func (h *Handler) handleCaptureCommand(chatID int64, text string) {
+	parts := splitBySpace(text)
+	if len(parts) < 2 {
+		h.sendMessageText(chatID, "Ошибка: нужно указать ID платежа. Пример: /capture 2d0c5a5e-000f-5000-8000-1b2c3d4e5f60")
+		return
+	}
+
+	err := h.paymentService.CapturePayment(parts[1])
+	if err != nil {
+		h.sendMessageText(chatID, "Ошибка подтверждения платежа: "+err.Error())
+		return
+	}
+	h.sendMessageText(chatID, "Платёж подтверждён.")
+}
+
+func (h *Handler) handleCancelPaymentCommand(chatID int64, text string) {
+	parts := splitBySpace(text)
+	if len(parts) < 2 {
+		h.sendMessageText(chatID, "Ошибка: нужно указать ID платежа. Пример: /cancel_payment 2d0c5a5e-000f-5000-8000-1b2c3d4e5f60")
+		return
+	}
+
+	err := h.paymentService.CancelPayment(parts[1])
+	if err != nil {
+		h.sendMessageText(chatID, "Ошибка отмены платежа: "+err.Error())
+		return
+	}
+	h.sendMessageText(chatID, "Платёж отменён.")
+}
+
+// handleRefundCommand возвращает деньги или звёзды по оплаченному платежу.
+func (h *Handler) handleRefundCommand(chatID int64, text string) {
+	parts := splitBySpace(text)
+	if len(parts) < 2 {
+		h.sendMessageText(chatID, "Ошибка: нужно указать ID платежа. Пример: /refund tg_0123456789abcdef0123456789abcdef")
+		return
+	}
+
+	err := h.paymentService.RefundPayment(parts[1])
+	if errors.Is(err, payment.ErrNotSupported) {
+		h.sendMessageText(chatID, "Этот провайдер не поддерживает возврат через бота. Верните деньги в личном кабинете платёжной системы.")
+		return
+	}
+	if err != nil {
+		h.sendMessageText(chatID, "Ошибка возврата: "+err.Error())
+		return
+	}
+	h.sendMessageText(chatID, "Возврат отправлен.")
+}
+
+// handleReplayEventCommand повторно обрабатывает сохранённый вебхук по его ID.
+func (h *Handler) handleReplayEventCommand(chatID int64, text string) {
+	parts := splitBySpace(text)
+	if len(parts) < 2 {
+		h.sendMessageText(chatID, "Ошибка: нужно указать ID события. Пример: /replay_event 42")
+		return
+	}
+	eventID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		h.sendMessageText(chatID, "Ошибка: ID события должен быть числом.")
 		return
 	}
-	h.bot.Send(tgbotapi.NewMessage(chatID, "Ключ успешно добавлен."))
+
+	err = h.paymentService.ReplayWebhookEvent(eventID)
+	if err != nil {
+		h.sendMessageText(chatID, "Ошибка обработки события: "+err.Error())
+		return
+	}
+	h.sendMessageText(chatID, "Событие обработано повторно.")
 }
 
 func splitBySpace(s string) []string {
@@ -186,93 +581,25 @@ func (h *Handler) handleCallbackQuery(update tgbotapi.Update) {
 
 	switch data {
 	case "buy_vpn":
-		user, err := h.userService.GetUserByTelegramID(cb.From.ID)
-		if err != nil {
-			log.Println("❌ Ошибка получения пользователя:", err)
-			h.sendErrorMessage(chatID, "Ошибка получения данных пользователя. Попробуйте позже.")
-			return
-		}
-
-		hasKeys, err := h.vpnKeyService.HasFreeKeys()
-		if err != nil {
-			log.Println("❌ Ошибка проверки VPN-ключей:", err)
-			h.sendErrorMessage(chatID, "Ошибка при проверке VPN-ключей. Попробуйте позже.")
-			return
-		}
-		if !hasKeys {
-			log.Println("⛔ Нет свободных VPN-ключей, отменяем оплату.")
-			h.sendErrorMessage(chatID, "⚠️ Временно нет свободных VPN-ключей. Попробуйте позже.")
-			return
-		}
-
-		confirmationURL, err := h.paymentService.CreatePayment(user.ID, 299, "Покупка VPN")
-		if err != nil {
-			log.Println("❌ Ошибка создания платежа:", err)
-			h.sendErrorMessage(chatID, "Ошибка при создании платежа. Попробуйте позже.")
-			return
-		}
-
-		h.sendMessageText(chatID, fmt.Sprintf("💳 Оплатите по ссылке: %s", confirmationURL))
+		h.processBuyVPN(chatID, int(cb.From.ID))
 
 	case "my_keys":
-		keys, err := h.vpnKeyService.GetKeysByUserTelegramID(cb.From.ID)
-		if err != nil {
-			log.Println("❌ Ошибка получения ключей:", err)
-			h.sendErrorMessage(chatID, "Ошибка при получении ключей.")
-			return
-		}
-
-		if len(keys) == 0 {
-			h.sendMessageText(chatID, "🔑 У вас нет купленных ключей.")
-			return
-		}
-
-		var text strings.Builder
-		text.WriteString("🔑 Ваши VPN-ключи:\n")
-		for _, k := range keys {
-			text.WriteString(fmt.Sprintf("Ключ: `%s`, истекает: *%v*\n", k.Key, k.ExpiresAt.Format("02.01.2006")))
-		}
-		h.sendMessageMarkdown(chatID, text.String())
+		h.processMyKeys(chatID, int(cb.From.ID))
 
 	case "renew_key":
-		user, err := h.userService.GetUserByTelegramID(cb.From.ID)
-		if err != nil {
-			log.Println("❌ Ошибка получения пользователя:", err)
-			h.sendErrorMessage(chatID, "Ошибка получения данных пользователя.")
-			return
-		}
-
-		confirmationURL, err := h.paymentService.CreatePayment(user.ID, 199, "Продление VPN")
-		if err != nil {
-			log.Println("❌ Ошибка создания платежа:", err)
-			h.sendErrorMessage(chatID, "Ошибка при создании платежа. Попробуйте позже.")
-			return
-		}
-
-		h.sendMessageText(chatID, fmt.Sprintf("🔄 Оплатите продление по ссылке: %s", confirmationURL))
+		h.processRenewKey(chatID, int(cb.From.ID))
 
 	case "status_key":
-		keys, err := h.vpnKeyService.GetKeysByUserTelegramID(cb.From.ID)
-		if err != nil {
-			log.Println("❌ Ошибка получения ключей:", err)
-			h.sendErrorMessage(chatID, "Ошибка при получении ключей.")
-			return
-		}
-
-		if len(keys) == 0 {
-			h.sendMessageText(chatID, "📌 У вас нет активных VPN-ключей.")
-			return
-		}
+		h.processKeyStatus(chatID, int(cb.From.ID))
 
-		var activeKeys []string
-		for _, k := range keys {
-			activeKeys = append(activeKeys, fmt.Sprintf("🔑 `%s` (Истекает: *%v*)", k.Key, k.ExpiresAt.Format("02.01.2006")))
-		}
+	case autoRenewOnData:
+		h.processSetAutoRenew(chatID, cb.From.ID, true)
 
-		h.sendMessageMarkdown(chatID, "📌 Ваши активные ключи:\n"+strings.Join(activeKeys, "\n"))
+	case autoRenewOffData:
+		h.processSetAutoRenew(chatID, cb.From.ID, false)
 
 	default:
-		h.sendMessageText(chatID, "❓ Неизвестная команда.")
+		h.handleDataCallback(chatID, cb.From.ID, data)
 	}
 
 	callback := tgbotapi.NewCallback(cb.ID, "")
@@ -285,6 +612,7 @@ func mainMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
 		{tgbotapi.NewKeyboardButton("Мои ключи")},
 		{tgbotapi.NewKeyboardButton("Продлить ключ")},
 		{tgbotapi.NewKeyboardButton("Статус ключа")},
+		{tgbotapi.NewKeyboardButton("Автопродление")},
 	}
 
 	return tgbotapi.ReplyKeyboardMarkup{
@@ -294,73 +622,169 @@ func mainMenuKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	}
 }
 
-func (h *Handler) handleBuyVPN(callback *tgbotapi.CallbackQuery) {
-	chatID := callback.Message.Chat.ID
-	userID := callback.From.ID
+const (
+	buyPlanPrefix   = "buy_plan:"
+	renewKeyPrefix  = "renew_key:"
+	renewPlanPrefix = "renew_plan:"
+	// checkPaymentPrefix несёт токен платежа, а не числовой ID.
+	checkPaymentPrefix = "check_payment:"
 
-	if h.bot == nil {
-		log.Println("❌ Ошибка: bot не инициализирован")
+	autoRenewOnData  = "auto_renew:on"
+	autoRenewOffData = "auto_renew:off"
+)
+
+// handleDataCallback обрабатывает callback-кнопки, несущие идентификаторы
+// в данных (например, "renew_plan:<keyID>:<planID>").
+func (h *Handler) handleDataCallback(chatID int64, telegramID int64, data string) {
+	switch {
+	case strings.HasPrefix(data, buyPlanPrefix):
+		if ids, ok := parseCallbackIDs(data, buyPlanPrefix, 1); ok {
+			h.processBuyPlan(chatID, telegramID, ids[0])
+			return
+		}
+
+	case strings.HasPrefix(data, renewKeyPrefix):
+		if ids, ok := parseCallbackIDs(data, renewKeyPrefix, 1); ok {
+			h.processRenewKeyChoice(chatID, telegramID, ids[0])
+			return
+		}
+
+	case strings.HasPrefix(data, renewPlanPrefix):
+		if ids, ok := parseCallbackIDs(data, renewPlanPrefix, 2); ok {
+			h.processRenewPlan(chatID, telegramID, ids[0], ids[1])
+			return
+		}
+
+	case strings.HasPrefix(data, checkPaymentPrefix):
+		h.processCheckPayment(chatID, telegramID, strings.TrimPrefix(data, checkPaymentPrefix))
 		return
 	}
 
-	hasKeys, err := h.vpnKeyService.HasFreeKeys()
-	if err != nil {
-		log.Println("Ошибка проверки VPN-ключей:", err)
-		msg := tgbotapi.NewMessage(chatID, "❌ Ошибка при проверке VPN-ключей. Попробуйте позже.")
-		_, _ = h.bot.Send(msg)
-		return
+	h.sendMessageText(chatID, "❓ Неизвестная команда.")
+}
+
+func parseCallbackIDs(data, prefix string, count int) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(data, prefix), ":")
+	if len(parts) != count {
+		return nil, false
 	}
+	ids := make([]int, 0, count)
+	for _, p := range parts {
+		id, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
 
-	if !hasKeys {
-		log.Println("⛔ Нет свободных VPN-ключей, отменяем оплату.")
-		msg := tgbotapi.NewMessage(chatID, "⚠️ Временно нет свободных VPN-ключей. Пожалуйста, попробуйте позже.")
-		_, _ = h.bot.Send(msg)
-		return
+func renewKeysKeyboard(keys []domain.VPNKey) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, k := range keys {
+		label := k.Label()
+		if k.ExpiresAt != nil {
+			label = fmt.Sprintf("%s (до %s)", k.Label(), k.ExpiresAt.Format("02.01.2006"))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, renewKeyPrefix+strconv.Itoa(k.ID)),
+		))
 	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
 
-	paymentURL, err := h.paymentService.CreatePayment(
-		int(userID),
-		299.00,
-		"Оплата VPN-подписки",
-	)
-	if err != nil {
-		log.Println("Ошибка создания платежа:", err)
-		msg := tgbotapi.NewMessage(chatID, "❌ Ошибка при создании платежа. Попробуйте позже.")
-		_, _ = h.bot.Send(msg)
-		return
+func autoRenewKeyboard(enabled bool) tgbotapi.InlineKeyboardMarkup {
+	button := tgbotapi.NewInlineKeyboardButtonData("✅ Включить автопродление", autoRenewOnData)
+	if enabled {
+		button = tgbotapi.NewInlineKeyboardButtonData("🚫 Отключить автопродление", autoRenewOffData)
 	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))
+}
 
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("💳 Оплатите по ссылке: %s", paymentURL))
-	_, err = h.bot.Send(msg)
-	if err != nil {
-		log.Println("Ошибка отправки сообщения в Telegram:", err)
+func plansKeyboard(plans []domain.Plan, prices map[int]string, dataPrefix string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range plans {
+		label := fmt.Sprintf("%s — %s", p.Name, prices[p.ID])
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, dataPrefix+strconv.Itoa(p.ID)),
+		))
 	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
 }
 
-func (h *Handler) sendMessageText(chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	response, err := h.bot.Send(msg)
+func formatPrice(amount float64, currency string) string {
+	switch currency {
+	case "RUB":
+		return fmt.Sprintf("%.0f ₽", amount)
+	case domain.CurrencyStars:
+		return fmt.Sprintf("%.0f ⭐", amount)
+	}
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
 
-	if err != nil {
+// renewableKeys отбрасывает отозванные ключи: продлить их нельзя.
+func renewableKeys(keys []domain.VPNKey) []domain.VPNKey {
+	var renewable []domain.VPNKey
+	for _, k := range keys {
+		if k.Status != domain.VPNKeyStatusRevoked {
+			renewable = append(renewable, k)
+		}
+	}
+	return renewable
+}
+
+func containsRenewableKey(keys []domain.VPNKey, keyID int) bool {
+	for _, k := range renewableKeys(keys) {
+		if k.ID == keyID {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) handleBuyVPN(callback *tgbotapi.CallbackQuery) {
+	if h.bot == nil {
+		log.Println("❌ Ошибка: bot не инициализирован")
+		return
+	}
+
+	h.processBuyVPN(callback.Message.Chat.ID, int(callback.From.ID))
+}
+
+// Простые сообщения идут через outbox, чтобы сбой Telegram не терял ответ.
+// Сообщения с клавиатурами по-прежнему отправляются напрямую.
+
+func (h *Handler) sendMessageText(chatID int64, text string) {
+	if err := h.notifier.Notify(chatID, text); err != nil {
 		log.Printf("❌ Ошибка отправки сообщения: %v", err)
-	} else {
-		log.Printf("✅ Сообщение отправлено: ID %d", response.MessageID)
 	}
 }
 
 func (h *Handler) sendMessageMarkdown(chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	_, err := h.bot.Send(msg)
-	if err != nil {
+	if err := h.notifier.NotifyMarkdown(chatID, text); err != nil {
 		log.Println("❌ Ошибка отправки Markdown-сообщения:", err)
 	}
 }
 
-func (h *Handler) sendErrorMessage(chatID int64, text string) {
-	msg := tgbotapi.NewMessage(chatID, "❌ "+text)
-	_, err := h.bot.Send(msg)
+func (h *Handler) sendDocument(chatID int64, caption, name string, data []byte) {
+	if err := h.notifier.NotifyDocument(chatID, caption, name, data); err != nil {
+		log.Println("❌ Ошибка отправки файла:", err)
+	}
+}
+
+func (h *Handler) sendKeyQRCode(chatID int64, k *domain.VPNKey) {
+	png, caption, err := qr.KeyPhoto(k)
 	if err != nil {
+		log.Printf("❌ Ошибка построения QR-кода ключа %d: %v", k.ID, err)
+		return
+	}
+	if err := h.notifier.NotifyPhoto(chatID, caption, png); err != nil {
+		log.Println("❌ Ошибка отправки QR-кода:", err)
+	}
+}
+
+func (h *Handler) sendErrorMessage(chatID int64, text string) {
+	if err := h.notifier.Notify(chatID, "❌ "+text); err != nil {
 		log.Println("❌ Ошибка отправки сообщения об ошибке:", err)
 	}
 }
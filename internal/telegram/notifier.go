@@ -0,0 +1,102 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/service"
+)
+
+type botSender struct {
+	bot *tgbotapi.BotAPI
+}
+
+// NewSender создаёт отправителя, через которого outbox доставляет уведомления.
+func NewSender(bot *tgbotapi.BotAPI) service.NotificationSender {
+	return &botSender{bot: bot}
+}
+
+func (s *botSender) Send(n domain.Notification) error {
+	_, err := s.bot.Send(chattable(n))
+	if n.ParseMode != "" && isParseError(err) {
+		// Разметку сломали данные — например, «_» в ключе или username.
+		// Ключ важнее оформления, поэтому отправляем его простым текстом.
+		log.Printf("⚠️ Telegram не разобрал разметку уведомления для %d, отправляем без неё: %v", n.TelegramID, err)
+		n.ParseMode = ""
+		_, err = s.bot.Send(chattable(n))
+	}
+	return classifySendError(err)
+}
+
+func chattable(n domain.Notification) tgbotapi.Chattable {
+	switch {
+	case n.DocumentName != "":
+		doc := tgbotapi.NewDocument(n.TelegramID, tgbotapi.FileBytes{Name: n.DocumentName, Bytes: n.Document})
+		doc.Caption = n.Text
+		doc.ParseMode = n.ParseMode
+		return doc
+	case len(n.Photo) > 0:
+		photo := tgbotapi.NewPhoto(n.TelegramID, tgbotapi.FileBytes{Name: "qr.png", Bytes: n.Photo})
+		photo.Caption = n.Text
+		photo.ParseMode = n.ParseMode
+		return photo
+	}
+	text := tgbotapi.NewMessage(n.TelegramID, n.Text)
+	text.ParseMode = n.ParseMode
+	return text
+}
+
+// Описания ошибок Bot API, после которых писать получателю бесполезно.
+var unavailableRecipientErrors = []string{
+	"chat not found",
+	"user is deactivated",
+}
+
+// classifySendError переводит ошибки Bot API в ошибки service, по которым
+// воркер outbox решает, повторять ли отправку.
+func classifySendError(err error) error {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests || apiErr.RetryAfter > 0:
+		retryAfter := time.Duration(apiErr.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		return &service.RetryAfterError{RetryAfter: retryAfter}
+	case apiErr.Code == http.StatusForbidden:
+		// Пользователь заблокировал бота или удалил аккаунт.
+		return fmt.Errorf("%w: %s", service.ErrRecipientUnavailable, apiErr.Message)
+	case apiErr.Code == http.StatusBadRequest && recipientUnavailable(apiErr.Message):
+		return fmt.Errorf("%w: %s", service.ErrRecipientUnavailable, apiErr.Message)
+	}
+	// Остальные ошибки, в том числе прочие 400, повторяются, а после
+	// последней попытки воркер сообщает о них администраторам.
+	return err
+}
+
+func recipientUnavailable(message string) bool {
+	message = strings.ToLower(message)
+	for _, reason := range unavailableRecipientErrors {
+		if strings.Contains(message, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// isParseError — Telegram отклонил сообщение из-за разметки.
+func isParseError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(apiErr.Message), "can't parse entities")
+}
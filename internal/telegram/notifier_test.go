@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/service"
+)
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         *tgbotapi.Error
+		unavailable bool
+	}{
+		{"бот заблокирован", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, true},
+		{"чат не найден", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, true},
+		{"аккаунт удалён", &tgbotapi.Error{Code: 400, Message: "Bad Request: user is deactivated"}, true},
+		{"ошибка разметки", &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities: Can't find end of the entity"}, false},
+		{"слишком длинное", &tgbotapi.Error{Code: 400, Message: "Bad Request: message is too long"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifySendError(tt.err)
+			if got := errors.Is(err, service.ErrRecipientUnavailable); got != tt.unavailable {
+				t.Errorf("ErrRecipientUnavailable = %v, ожидалось %v (%v)", got, tt.unavailable, err)
+			}
+		})
+	}
+}
+
+func TestClassifySendErrorRetryAfter(t *testing.T) {
+	err := classifySendError(&tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5}})
+
+	var retry *service.RetryAfterError
+	if !errors.As(err, &retry) || retry.RetryAfter.Seconds() != 5 {
+		t.Errorf("ожидалась пауза 5s, получено %v", err)
+	}
+}
+
+func TestIsParseError(t *testing.T) {
+	if !isParseError(&tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 12"}) {
+		t.Error("ошибка разметки не распознана")
+	}
+	if isParseError(&tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}) {
+		t.Error("«chat not found» принят за ошибку разметки")
+	}
+}
@@ -0,0 +1,38 @@
+package telegram
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/payment/telegrampay"
+)
+
+// handlePreCheckoutQuery подтверждает списание по счёту Telegram. Ответить
+// нужно в течение 10 секунд, иначе Telegram отменит оплату.
+func (h *Handler) handlePreCheckoutQuery(query *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: true}
+
+	amount := telegrampay.FromMinorUnits(query.TotalAmount, query.Currency)
+	if err := h.paymentService.CheckPreCheckout(query.InvoicePayload, amount); err != nil {
+		log.Printf("❌ Счёт %s нельзя оплатить: %v", query.InvoicePayload, err)
+		answer.OK = false
+		answer.ErrorMessage = "Счёт устарел. Оформите покупку заново."
+	}
+
+	if _, err := h.bot.Request(answer); err != nil {
+		log.Println("❌ Ошибка ответа на pre_checkout_query:", err)
+	}
+}
+
+// handleSuccessfulPayment передаёт оплату счёта Telegram в общий обработчик
+// событий провайдеров: ключ выдаётся так же, как после вебхука ЮKassa.
+func (h *Handler) handleSuccessfulPayment(msg *tgbotapi.Message) {
+	sp := msg.SuccessfulPayment
+	log.Printf("💳 Оплачен счёт %s пользователем %d", sp.InvoicePayload, msg.From.ID)
+
+	err := h.paymentService.HandleInvoicePayment(telegrampay.SuccessfulPaymentEvent(sp))
+	if err != nil {
+		log.Println("❌ Ошибка обработки оплаты счёта:", err)
+		h.sendErrorMessage(msg.Chat.ID, "Оплата получена, но при выдаче ключа произошла ошибка. Администратор уже разбирается.")
+	}
+}
@@ -0,0 +1,57 @@
+package telegram
+
+import (
+	"errors"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"vpn-bot/internal/service"
+)
+
+// askReceiptContact просит email или телефон для чека и запоминает кнопку,
+// которую нажал пользователь: после сохранения контакта оплата продолжится.
+func (h *Handler) askReceiptContact(chatID int64, telegramID int64, callbackData string) {
+	h.pendingPayments[telegramID] = callbackData
+
+	msg := tgbotapi.NewMessage(chatID, "🧾 По закону мы отправляем чек об оплате. "+
+		"Пришлите email сообщением или поделитесь телефоном кнопкой ниже — спросим один раз.")
+	msg.ReplyMarkup = tgbotapi.NewOneTimeReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonContact("📱 Отправить телефон")),
+	)
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки запроса контакта:", err)
+	}
+}
+
+// awaitsReceiptContact — бот ждёт от пользователя контакт для чека.
+func (h *Handler) awaitsReceiptContact(telegramID int64) bool {
+	_, ok := h.pendingPayments[telegramID]
+	return ok
+}
+
+// handleReceiptContact сохраняет контакт и продолжает отложенную оплату.
+func (h *Handler) handleReceiptContact(chatID int64, telegramID int64, contact string) {
+	err := h.userService.SetReceiptContact(telegramID, contact)
+	if errors.Is(err, service.ErrInvalidContact) {
+		h.sendMessageText(chatID, "❓ Не похоже на email или телефон. Пришлите, например, name@example.com или +7 900 123-45-67.")
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка сохранения контакта пользователя %d: %v", telegramID, err)
+		h.sendErrorMessage(chatID, "Не удалось сохранить контакт. Попробуйте позже.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, "✅ Контакт для чеков сохранён.")
+	msg.ReplyMarkup = mainMenuKeyboard()
+	if _, err := h.bot.Send(msg); err != nil {
+		log.Println("❌ Ошибка отправки сообщения:", err)
+	}
+
+	data, ok := h.pendingPayments[telegramID]
+	if !ok {
+		return
+	}
+	delete(h.pendingPayments, telegramID)
+	h.handleDataCallback(chatID, telegramID, data)
+}
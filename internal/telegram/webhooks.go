@@ -4,24 +4,15 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
-)
 
-type YooKassaWebhook struct {
-	Type   string `json:"type"`
-	Event  string `json:"event"`
-	Object struct {
-		ID     string `json:"id"`
-		Status string `json:"status"`
-		Amount struct {
-			Value    string `json:"value"`
-			Currency string `json:"currency"`
-		} `json:"amount"`
-	} `json:"object"`
-}
+	"vpn-bot/internal/payment/cryptopay"
+	"vpn-bot/internal/payment/yookassa"
+	"vpn-bot/internal/service"
+)
 
 func (h *Handler) HandleYooKassaWebhook(w http.ResponseWriter, r *http.Request) {
 	log.Println("🔔 Получен вебхук от YooKassa!")
@@ -34,10 +25,6 @@ func (h *Handler) HandleYooKassaWebhook(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
-	for k, v := range r.Header {
-		log.Printf("📜 Заголовок: %s = %s\n", k, v)
-	}
-
 	if r.Header.Get("X-Content-Signature") != "" {
 		if !h.verifySignature(body, r.Header.Get("X-Content-Signature")) {
 			log.Println("❌ Ошибка: подпись вебхука не совпадает!")
@@ -46,36 +33,50 @@ func (h *Handler) HandleYooKassaWebhook(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	var webhook YooKassaWebhook
-	if err := json.Unmarshal(body, &webhook); err != nil {
-		log.Println("Ошибка парсинга JSON:", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	log.Printf("📩 Вебхук: %s, ID платежа: %s, статус: %s, сумма: %s %s",
-		webhook.Event, webhook.Object.ID, webhook.Object.Status, webhook.Object.Amount.Value, webhook.Object.Amount.Currency)
-
-	switch webhook.Event {
-	case "payment.succeeded":
-		err = h.paymentService.ConfirmPayment(webhook.Object.ID)
-		if err != nil {
-			log.Println("Ошибка подтверждения платежа:", err)
-		} else {
-			log.Println("✅ Платёж успешно обработан, VPN-ключ выдан.")
-		}
+	// Ошибку обработки возвращаем ЮKassa, чтобы она повторила доставку:
+	// событие сохранено, и повтор не обработает его второй раз.
+	h.handleProviderWebhook(w, r.Header, body, yookassa.Name)
+}
 
-	case "payment.waiting_for_capture":
-		log.Println("⚠️ Платёж требует подтверждения (waiting_for_capture).")
+// HandleCryptoPayWebhook принимает оплату счетов Crypto Pay. Подпись
+// проверяет сам провайдер.
+func (h *Handler) HandleCryptoPayWebhook(w http.ResponseWriter, r *http.Request) {
+	log.Println("🔔 Получен вебхук от Crypto Pay!")
 
-	case "payment.canceled":
-		log.Println("❌ Платёж отменён или произошла ошибка.")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Ошибка чтения тела:", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
 
-	case "refund.succeeded":
-		log.Println("🔄 Возврат средств выполнен. Нужно аннулировать VPN-ключ.")
+	h.handleProviderWebhook(w, r.Header, body, cryptopay.Name)
+}
 
-	default:
-		log.Println("❓ Неизвестное событие:", webhook.Event)
+// handleProviderWebhook передаёт вебхук провайдеру и отвечает статусом,
+// по которому провайдер решит, повторять ли доставку.
+func (h *Handler) handleProviderWebhook(w http.ResponseWriter, header http.Header, body []byte, providerName string) {
+	err := h.paymentService.HandleWebhook(providerName, header, body)
+	if errors.Is(err, service.ErrInvalidWebhookSignature) {
+		log.Println("❌ Ошибка: подпись вебхука не совпадает!")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		log.Println("Ошибка парсинга вебхука:", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrWebhookNotConfirmed) {
+		log.Println("⚠️ Вебхук отклонён:", err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Println("Ошибка обработки вебхука:", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,118 @@
+// Package fakevpn — клиент простого JSON API поддельной VPN-панели из
+// fakevpntest. Нужен, чтобы пройти выдачу, продление и отзыв ключей без
+// настоящего VPN-сервера.
+package fakevpn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"vpn-bot/internal/vpn"
+)
+
+const Name = "fake"
+
+// Client — клиент в API панели.
+type Client struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	UsedBytes int64     `json:"used_bytes"`
+}
+
+type clientRequest struct {
+	Name      string    `json:"name,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type backend struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// NewBackend создаёт клиента панели по адресу apiURL (например,
+// http://localhost:8091/api) с токеном token.
+func NewBackend(apiURL, token string) vpn.Backend {
+	return &backend{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (b *backend) Name() string {
+	return Name
+}
+
+func (b *backend) CreateClient(req vpn.CreateRequest) (*vpn.Client, error) {
+	var c Client
+	err := b.do(http.MethodPost, "/clients", clientRequest{Name: req.Name, ExpiresAt: req.ExpiresAt}, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &vpn.Client{ID: c.ID, Key: c.Key}, nil
+}
+
+func (b *backend) RevokeClient(clientID string) error {
+	return b.do(http.MethodDelete, "/clients/"+url.PathEscape(clientID), nil, nil)
+}
+
+func (b *backend) ExtendClient(clientID string, expiresAt time.Time) error {
+	return b.do(http.MethodPatch, "/clients/"+url.PathEscape(clientID), clientRequest{ExpiresAt: expiresAt}, nil)
+}
+
+func (b *backend) Usage(clientID string) (*vpn.Usage, error) {
+	var c Client
+	if err := b.do(http.MethodGet, "/clients/"+url.PathEscape(clientID), nil, &c); err != nil {
+		return nil, err
+	}
+	return &vpn.Usage{UsedBytes: c.UsedBytes}, nil
+}
+
+// do выполняет запрос к API и разбирает ответ в out, если он не nil.
+func (b *backend) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return vpn.ErrClientNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("VPN-панель: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,176 @@
+// Package fakevpntest — поддельная VPN-панель: создаёт, продлевает и
+// отзывает клиентов в памяти и позволяет подкрутить им трафик.
+package fakevpntest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"vpn-bot/internal/vpn/fakevpn"
+)
+
+// Server — поддельная панель. API доступно по /api/clients, трафик
+// клиенту добавляется запросом /fake/usage?id=N&bytes=M.
+type Server struct {
+	// Token — токен, которым проверяются запросы к API.
+	Token string
+
+	mu      sync.Mutex
+	clients map[string]*fakevpn.Client
+	nextID  int
+	mux     *http.ServeMux
+}
+
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:   token,
+		clients: make(map[string]*fakevpn.Client),
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /api/clients", s.authorized(s.createClient))
+	s.mux.HandleFunc("GET /api/clients/{id}", s.authorized(s.getClient))
+	s.mux.HandleFunc("PATCH /api/clients/{id}", s.authorized(s.extendClient))
+	s.mux.HandleFunc("DELETE /api/clients/{id}", s.authorized(s.revokeClient))
+	s.mux.HandleFunc("/fake/usage", s.addUsage)
+	return s
+}
+
+// Start запускает сервер на свободном локальном порту; адрес API —
+// URL сервера + "/api".
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Client возвращает копию клиента.
+func (s *Server) Client(id string) (fakevpn.Client, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return fakevpn.Client{}, false
+	}
+	return *c, true
+}
+
+// AddUsage добавляет клиенту трафик.
+func (s *Server) AddUsage(id string, bytes int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.clients[id]
+	if !ok {
+		return fmt.Errorf("клиент %s не найден", id)
+	}
+	c.UsedBytes += bytes
+	return nil
+}
+
+func (s *Server) createClient(w http.ResponseWriter, r *http.Request) {
+	var req fakevpn.Client
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	secret := make([]byte, 8)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	c := &fakevpn.Client{
+		ID:        strconv.Itoa(s.nextID),
+		Name:      req.Name,
+		Key:       fmt.Sprintf("fake://%s@%s/%d", hex.EncodeToString(secret), r.Host, s.nextID),
+		ExpiresAt: req.ExpiresAt,
+	}
+	s.clients[c.ID] = c
+	resp := *c
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) getClient(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.Client(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) extendClient(w http.ResponseWriter, r *http.Request) {
+	var req fakevpn.Client
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	c, ok := s.clients[r.PathValue("id")]
+	if ok {
+		c.ExpiresAt = req.ExpiresAt
+		c.Revoked = false
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) revokeClient(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	c, ok := s.clients[r.PathValue("id")]
+	if ok {
+		c.Revoked = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addUsage(w http.ResponseWriter, r *http.Request) {
+	bytes, err := strconv.ParseInt(r.FormValue("bytes"), 10, 64)
+	if err != nil {
+		http.Error(w, "bytes required", http.StatusBadRequest)
+		return
+	}
+	if err := s.AddUsage(r.FormValue("id"), bytes); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// authorized пропускает к API только запросы с токеном панели.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.Token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,190 @@
+// Package outline — ключи Shadowsocks на Outline Server через его
+// management API. Срока действия у ключей Outline нет, поэтому истёкший
+// ключ приостанавливается нулевым лимитом трафика, а продление снимает его.
+package outline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"vpn-bot/internal/vpn"
+)
+
+const Name = "outline"
+
+// AccessKey — ключ доступа в API Outline.
+type AccessKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Password  string     `json:"password"`
+	Port      int        `json:"port"`
+	Method    string     `json:"method"`
+	AccessURL string     `json:"accessUrl"`
+	DataLimit *DataLimit `json:"dataLimit,omitempty"`
+}
+
+// DataLimit — лимит трафика ключа.
+type DataLimit struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// TransferMetrics — ответ /metrics/transfer: трафик по ID ключей. Ключей
+// без трафика в нём нет.
+type TransferMetrics struct {
+	BytesTransferredByUserID map[string]int64 `json:"bytesTransferredByUserId"`
+}
+
+type backend struct {
+	apiURL    string
+	dataLimit int64
+	client    *http.Client
+}
+
+// NewBackend создаёт клиента management API по apiURL из настроек Outline
+// Manager. certSHA256 — отпечаток самоподписанного сертификата сервера
+// (certSha256); пустой — сертификат проверяется обычным способом.
+// dataLimit — лимит трафика ключа в байтах, 0 — без лимита.
+func NewBackend(apiURL, certSHA256 string, dataLimit int64) vpn.Backend {
+	return &backend{
+		apiURL:    strings.TrimRight(apiURL, "/"),
+		dataLimit: dataLimit,
+		client:    newClient(certSHA256),
+	}
+}
+
+// newClient доверяет сертификату с отпечатком certSHA256: Outline
+// выпускает самоподписанный сертификат.
+func newClient(certSHA256 string) *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if certSHA256 == "" {
+		return client
+	}
+
+	want := strings.ToLower(strings.ReplaceAll(certSHA256, ":", ""))
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		// Цепочку не проверяем: подлинность сервера подтверждает отпечаток.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("сервер Outline не прислал сертификат")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if hex.EncodeToString(sum[:]) != want {
+				return errors.New("отпечаток сертификата Outline не совпадает с OUTLINE_CERT_SHA256")
+			}
+			return nil
+		},
+	}
+	client.Transport = transport
+	return client
+}
+
+func (b *backend) Name() string {
+	return Name
+}
+
+// CreateClient создаёт ключ, называет его именем пользователя и ставит
+// лимит трафика. Если настроить ключ не удалось, он удаляется.
+func (b *backend) CreateClient(req vpn.CreateRequest) (*vpn.Client, error) {
+	var key AccessKey
+	if err := b.do(http.MethodPost, "/access-keys", nil, &key); err != nil {
+		return nil, err
+	}
+
+	err := b.do(http.MethodPut, "/access-keys/"+url.PathEscape(key.ID)+"/name", map[string]string{"name": req.Name}, nil)
+	if err == nil {
+		err = b.applyDataLimit(key.ID)
+	}
+	if err != nil {
+		if deleteErr := b.RevokeClient(key.ID); deleteErr != nil {
+			return nil, fmt.Errorf("%w (ключ %s не удалён: %v)", err, key.ID, deleteErr)
+		}
+		return nil, err
+	}
+	return &vpn.Client{ID: key.ID, Key: key.AccessURL}, nil
+}
+
+func (b *backend) RevokeClient(clientID string) error {
+	return b.do(http.MethodDelete, "/access-keys/"+url.PathEscape(clientID), nil, nil)
+}
+
+// ExtendClient снимает приостановку: срок действия хранит бот.
+func (b *backend) ExtendClient(clientID string, expiresAt time.Time) error {
+	return b.applyDataLimit(clientID)
+}
+
+// SuspendClient приостанавливает ключ нулевым лимитом трафика.
+func (b *backend) SuspendClient(clientID string) error {
+	return b.setDataLimit(clientID, 0)
+}
+
+func (b *backend) Usage(clientID string) (*vpn.Usage, error) {
+	var metrics TransferMetrics
+	if err := b.do(http.MethodGet, "/metrics/transfer", nil, &metrics); err != nil {
+		return nil, err
+	}
+	return &vpn.Usage{UsedBytes: metrics.BytesTransferredByUserID[clientID]}, nil
+}
+
+// applyDataLimit ставит ключу настроенный лимит или снимает лимит совсем.
+func (b *backend) applyDataLimit(clientID string) error {
+	if b.dataLimit > 0 {
+		return b.setDataLimit(clientID, b.dataLimit)
+	}
+	return b.do(http.MethodDelete, "/access-keys/"+url.PathEscape(clientID)+"/data-limit", nil, nil)
+}
+
+func (b *backend) setDataLimit(clientID string, limit int64) error {
+	body := map[string]DataLimit{"limit": {Bytes: limit}}
+	return b.do(http.MethodPut, "/access-keys/"+url.PathEscape(clientID)+"/data-limit", body, nil)
+}
+
+// do выполняет запрос к API и разбирает ответ в out, если он не nil.
+func (b *backend) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return vpn.ErrClientNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Outline: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,138 @@
+package outline_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/vpn"
+	"vpn-bot/internal/vpn/outline"
+	"vpn-bot/internal/vpn/outline/outlinetest"
+)
+
+const dataLimit = 50 << 30
+
+func newBackend(t *testing.T, limit int64) (vpn.Backend, *outlinetest.Server) {
+	t.Helper()
+	srv := outlinetest.NewServer("secret")
+	ts := srv.Start()
+	t.Cleanup(ts.Close)
+	return outline.NewBackend(srv.APIURL(ts), outlinetest.CertSHA256(ts), limit), srv
+}
+
+func TestCreateClient(t *testing.T) {
+	b, srv := newBackend(t, dataLimit)
+
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: time.Now().AddDate(0, 1, 0)})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if !strings.HasPrefix(client.Key, "ss://") {
+		t.Errorf("ключ %q, ожидалась ссылка ss://", client.Key)
+	}
+
+	key, ok := srv.Key(client.ID)
+	if !ok {
+		t.Fatalf("ключа %s нет на сервере", client.ID)
+	}
+	if key.Name != "alice" {
+		t.Errorf("имя ключа %q, ожидалось alice", key.Name)
+	}
+	if key.DataLimit == nil || key.DataLimit.Bytes != dataLimit {
+		t.Errorf("лимит %+v, ожидалось %d байт", key.DataLimit, int64(dataLimit))
+	}
+}
+
+func TestCreateClientWithoutDataLimit(t *testing.T) {
+	b, srv := newBackend(t, 0)
+
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "bob"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if key, _ := srv.Key(client.ID); key.DataLimit != nil {
+		t.Errorf("лимит %+v, ожидался без лимита", key.DataLimit)
+	}
+}
+
+func TestSuspendAndExtendClient(t *testing.T) {
+	b, srv := newBackend(t, dataLimit)
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "carol"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	if err := b.(vpn.Suspender).SuspendClient(client.ID); err != nil {
+		t.Fatalf("SuspendClient: %v", err)
+	}
+	if key, _ := srv.Key(client.ID); key.DataLimit == nil || key.DataLimit.Bytes != 0 {
+		t.Errorf("после приостановки лимит %+v, ожидался 0", key.DataLimit)
+	}
+
+	if err := b.ExtendClient(client.ID, time.Now().AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("ExtendClient: %v", err)
+	}
+	if key, _ := srv.Key(client.ID); key.DataLimit == nil || key.DataLimit.Bytes != dataLimit {
+		t.Errorf("после продления лимит %+v, ожидалось %d байт", key.DataLimit, int64(dataLimit))
+	}
+}
+
+func TestRevokeClient(t *testing.T) {
+	b, srv := newBackend(t, 0)
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "dave"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	if err := b.RevokeClient(client.ID); err != nil {
+		t.Fatalf("RevokeClient: %v", err)
+	}
+	if _, ok := srv.Key(client.ID); ok {
+		t.Error("ключ остался на сервере")
+	}
+
+	if err := b.RevokeClient(client.ID); !errors.Is(err, vpn.ErrClientNotFound) {
+		t.Errorf("повторное удаление: %v, ожидалась ErrClientNotFound", err)
+	}
+	if err := b.ExtendClient(client.ID, time.Now()); !errors.Is(err, vpn.ErrClientNotFound) {
+		t.Errorf("продление удалённого ключа: %v, ожидалась ErrClientNotFound", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	b, srv := newBackend(t, 0)
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "erin"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	usage, err := b.Usage(client.ID)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.UsedBytes != 0 {
+		t.Errorf("трафик нового ключа %d, ожидался 0", usage.UsedBytes)
+	}
+
+	srv.AddTransfer(client.ID, 1500)
+	srv.AddTransfer(client.ID, 500)
+	usage, err = b.Usage(client.ID)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.UsedBytes != 2000 {
+		t.Errorf("трафик %d, ожидалось 2000", usage.UsedBytes)
+	}
+}
+
+func TestCertificateFingerprintMismatch(t *testing.T) {
+	srv := outlinetest.NewServer("secret")
+	ts := srv.Start()
+	defer ts.Close()
+
+	b := outline.NewBackend(srv.APIURL(ts), strings.Repeat("00", 32), 0)
+	if _, err := b.CreateClient(vpn.CreateRequest{Name: "mallory"}); err == nil {
+		t.Fatal("сервер с чужим сертификатом принят")
+	}
+}
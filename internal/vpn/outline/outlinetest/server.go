@@ -0,0 +1,197 @@
+// Package outlinetest — заменитель management API Outline Server на
+// httptest: хранит ключи в памяти и отдаёт заданную статистику трафика.
+package outlinetest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"vpn-bot/internal/vpn/outline"
+)
+
+const method = "chacha20-ietf-poly1305"
+
+// Server — заменитель API. Как и настоящий сервер, он отвечает только по
+// секретному префиксу: адрес API — URL сервера + "/" + Secret.
+type Server struct {
+	Secret string
+
+	mu       sync.Mutex
+	keys     map[string]*outline.AccessKey
+	transfer map[string]int64
+	nextID   int
+	host     string
+	mux      *http.ServeMux
+}
+
+func NewServer(secret string) *Server {
+	s := &Server{
+		Secret:   secret,
+		keys:     make(map[string]*outline.AccessKey),
+		transfer: make(map[string]int64),
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /access-keys", s.createKey)
+	s.mux.HandleFunc("GET /access-keys/{id}", s.getKey)
+	s.mux.HandleFunc("DELETE /access-keys/{id}", s.deleteKey)
+	s.mux.HandleFunc("PUT /access-keys/{id}/name", s.renameKey)
+	s.mux.HandleFunc("PUT /access-keys/{id}/data-limit", s.setDataLimit)
+	s.mux.HandleFunc("DELETE /access-keys/{id}/data-limit", s.removeDataLimit)
+	s.mux.HandleFunc("GET /metrics/transfer", s.metrics)
+	return s
+}
+
+// Start запускает сервер с самоподписанным сертификатом, как у Outline.
+// Отпечаток для NewBackend возвращает CertSHA256.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewTLSServer(s)
+}
+
+// APIURL — адрес API запущенного сервера.
+func (s *Server) APIURL(ts *httptest.Server) string {
+	return ts.URL + "/" + s.Secret
+}
+
+// CertSHA256 — отпечаток сертификата запущенного сервера.
+func CertSHA256(ts *httptest.Server) string {
+	sum := sha256.Sum256(ts.Certificate().Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.host = r.Host
+	s.mu.Unlock()
+	http.StripPrefix("/"+s.Secret, s.mux).ServeHTTP(w, r)
+}
+
+// Key возвращает копию ключа.
+func (s *Server) Key(id string) (outline.AccessKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return outline.AccessKey{}, false
+	}
+	return *key, true
+}
+
+// AddTransfer добавляет ключу трафик в /metrics/transfer.
+func (s *Server) AddTransfer(id string, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transfer[id] += bytes
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	key := &outline.AccessKey{
+		ID:       strconv.Itoa(s.nextID),
+		Password: base64.RawURLEncoding.EncodeToString(secret),
+		Port:     12345,
+		Method:   method,
+	}
+	userInfo := base64.URLEncoding.EncodeToString([]byte(key.Method + ":" + key.Password))
+	host, _, _ := net.SplitHostPort(s.host)
+	key.AccessURL = fmt.Sprintf("ss://%s@%s:%d/?outline=1", userInfo, host, key.Port)
+	s.keys[key.ID] = key
+	s.nextID++
+	resp := *key
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) getKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := s.Key(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request) {
+	s.update(w, r, func(_ *outline.AccessKey) {
+		delete(s.keys, r.PathValue("id"))
+	})
+}
+
+func (s *Server) renameKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	s.update(w, r, func(key *outline.AccessKey) {
+		key.Name = req.Name
+	})
+}
+
+func (s *Server) setDataLimit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Limit *outline.DataLimit `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Limit == nil || req.Limit.Bytes < 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	s.update(w, r, func(key *outline.AccessKey) {
+		key.DataLimit = req.Limit
+	})
+}
+
+func (s *Server) removeDataLimit(w http.ResponseWriter, r *http.Request) {
+	s.update(w, r, func(key *outline.AccessKey) {
+		key.DataLimit = nil
+	})
+}
+
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	resp := outline.TransferMetrics{BytesTransferredByUserID: make(map[string]int64, len(s.transfer))}
+	for id, bytes := range s.transfer {
+		resp.BytesTransferredByUserID[id] = bytes
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// update применяет change к ключу из пути запроса и отвечает 204, а если
+// ключа нет — 404.
+func (s *Server) update(w http.ResponseWriter, r *http.Request, change func(*outline.AccessKey)) {
+	s.mu.Lock()
+	key, ok := s.keys[r.PathValue("id")]
+	if ok {
+		change(key)
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,51 @@
+// Package vpn описывает VPN-серверы, на которых бот сам создаёт доступы
+// для пользователей вместо выдачи заранее загруженных ключей.
+package vpn
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotSupported — у сервера или ключа нет такой операции.
+	ErrNotSupported = errors.New("операция не поддерживается VPN-сервером")
+	// ErrClientNotFound — клиента нет на сервере.
+	ErrClientNotFound = errors.New("клиент не найден на VPN-сервере")
+)
+
+// CreateRequest — доступ, который нужно создать. Name — метка клиента
+// на сервере, по ней администратор найдёт владельца.
+type CreateRequest struct {
+	Name      string
+	ExpiresAt time.Time
+}
+
+// Client — доступ, созданный на сервере. ID — идентификатор клиента на
+// сервере, Key — то, что пользователь вставляет в VPN-приложение.
+type Client struct {
+	ID  string
+	Key string
+}
+
+// Usage — трафик клиента.
+type Usage struct {
+	UsedBytes int64
+}
+
+// Backend — VPN-сервер. Операции, которых у сервера нет, возвращают
+// ErrNotSupported. Если сервер не реализует Suspender, клиента после
+// ExpiresAt он отключает сам.
+type Backend interface {
+	Name() string
+	CreateClient(req CreateRequest) (*Client, error)
+	RevokeClient(clientID string) error
+	ExtendClient(clientID string, expiresAt time.Time) error
+	Usage(clientID string) (*Usage, error)
+}
+
+// Suspender реализуют серверы, которые не знают срока действия клиента:
+// истёкший ключ бот приостанавливает сам, а ExtendClient включает его снова.
+type Suspender interface {
+	SuspendClient(clientID string) error
+}
@@ -0,0 +1,150 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+)
+
+// commandTimeout — сколько ждать команду применения.
+const commandTimeout = 30 * time.Second
+
+// Applier переносит изменения пиров на интерфейс WireGuard. Пир уже
+// сохранён в базе с новым значением Enabled.
+type Applier interface {
+	AddPeer(peer domain.WireGuardPeer) error
+	RemovePeer(peer domain.WireGuardPeer) error
+}
+
+type peersFile struct {
+	path          string
+	peers         repository.WireGuardPeerRepository
+	reloadCommand string
+}
+
+// NewPeersFile переписывает файл path секциями [Peer] всех включённых пиров
+// и выполняет reloadCommand, если она задана, — например, скрипт, который
+// собирает конфигурацию интерфейса и вызывает wg syncconf.
+func NewPeersFile(path string, peers repository.WireGuardPeerRepository, reloadCommand string) Applier {
+	return &peersFile{path: path, peers: peers, reloadCommand: reloadCommand}
+}
+
+func (f *peersFile) AddPeer(domain.WireGuardPeer) error {
+	return f.write()
+}
+
+func (f *peersFile) RemovePeer(domain.WireGuardPeer) error {
+	return f.write()
+}
+
+func (f *peersFile) write() error {
+	peers, err := f.peers.ListEnabled()
+	if err != nil {
+		return err
+	}
+
+	var conf strings.Builder
+	conf.WriteString("# Файл создаёт vpn-bot, изменения вручную будут перезаписаны.\n")
+	for _, p := range peers {
+		fmt.Fprintf(&conf, "\n[Peer]\n# %s\nPublicKey = %s\nPresharedKey = %s\nAllowedIPs = %s/32\n",
+			p.Name, p.PublicKey, p.PresharedKey, p.Address)
+	}
+
+	// Файл подменяется целиком, чтобы интерфейс не прочитал его наполовину.
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".peers-*.conf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(conf.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+
+	if f.reloadCommand == "" {
+		return nil
+	}
+	return runCommand(f.reloadCommand, nil)
+}
+
+// afterCommit откладывает изменения интерфейса до коммита транзакции tx:
+// тогда файл пиров собирается уже из сохранённых в базе пиров, а пир
+// отменённой покупки на интерфейс не попадает.
+type afterCommit struct {
+	tx      repository.Repositories
+	applier Applier
+}
+
+func (a *afterCommit) AddPeer(peer domain.WireGuardPeer) error {
+	a.tx.AfterCommit(func() {
+		if err := a.applier.AddPeer(peer); err != nil {
+			log.Printf("❌ Пир %s сохранён, но не добавлен на интерфейс WireGuard: %v", peer.Address, err)
+		}
+	})
+	return nil
+}
+
+func (a *afterCommit) RemovePeer(peer domain.WireGuardPeer) error {
+	a.tx.AfterCommit(func() {
+		if err := a.applier.RemovePeer(peer); err != nil {
+			log.Printf("❌ Пир %s выключен, но не снят с интерфейса WireGuard: %v", peer.Address, err)
+		}
+	})
+	return nil
+}
+
+type command struct {
+	addCommand    string
+	removeCommand string
+}
+
+// NewCommand выполняет команды оболочки для каждого пира. Пир передаётся
+// в переменных WG_PUBLIC_KEY, WG_PRESHARED_KEY, WG_ADDRESS (без маски) и
+// WG_NAME.
+func NewCommand(addCommand, removeCommand string) Applier {
+	return &command{addCommand: addCommand, removeCommand: removeCommand}
+}
+
+func (c *command) AddPeer(peer domain.WireGuardPeer) error {
+	return runCommand(c.addCommand, peerEnv(peer))
+}
+
+func (c *command) RemovePeer(peer domain.WireGuardPeer) error {
+	return runCommand(c.removeCommand, peerEnv(peer))
+}
+
+func peerEnv(peer domain.WireGuardPeer) []string {
+	return []string{
+		"WG_PUBLIC_KEY=" + peer.PublicKey,
+		"WG_PRESHARED_KEY=" + peer.PresharedKey,
+		"WG_ADDRESS=" + peer.Address,
+		"WG_NAME=" + peer.Name,
+	}
+}
+
+func runCommand(script string, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("команда WireGuard %q: %w: %s", script, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
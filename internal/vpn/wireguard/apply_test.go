@@ -0,0 +1,113 @@
+package wireguard
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+func TestPeersFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "peers.conf")
+	marker := filepath.Join(dir, "reloaded")
+	peers := &fakePeers{peers: []domain.WireGuardPeer{
+		{PublicKey: "YWxpY2U=", PresharedKey: "cHNrMQ==", Address: "10.8.0.2", Name: "alice", Enabled: true},
+		{PublicKey: "Ym9i", PresharedKey: "cHNrMg==", Address: "10.8.0.3", Name: "bob", Enabled: false},
+	}}
+
+	f := NewPeersFile(path, peers, "touch "+marker)
+	if err := f.AddPeer(peers.peers[0]); err != nil {
+		t.Fatalf("AddPeer: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := string(data)
+	want := "\n[Peer]\n# alice\nPublicKey = YWxpY2U=\nPresharedKey = cHNrMQ==\nAllowedIPs = 10.8.0.2/32\n"
+	if !strings.Contains(conf, want) {
+		t.Errorf("в файле нет пира alice:\n%s", conf)
+	}
+	if strings.Contains(conf, "Ym9i") || strings.Count(conf, "[Peer]") != 1 {
+		t.Errorf("в файл попал выключенный пир:\n%s", conf)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("команда перезагрузки не выполнена: %v", err)
+	}
+
+	// Временные файлы не остаются рядом с файлом пиров.
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("в каталоге лишние файлы: %v", entries)
+	}
+}
+
+func TestPeersFileReloadFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.conf")
+	f := NewPeersFile(path, &fakePeers{}, "echo нет интерфейса >&2; exit 3")
+
+	err := f.RemovePeer(domain.WireGuardPeer{})
+	if err == nil || !strings.Contains(err.Error(), "нет интерфейса") {
+		t.Errorf("ошибка перезагрузки: %v, ожидался вывод команды", err)
+	}
+}
+
+func TestAfterCommitApplier(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		applied bool
+	}{
+		{"коммит", nil, true},
+		{"откат", errors.New("откат"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applier := &recordingApplier{}
+			b := NewBackend(testConfig, &fakePeers{}, applier).(*backend)
+			txPeers := &fakePeers{}
+
+			err := repository.RunInTx(repository.Repositories{WireGuardPeers: txPeers}, func() error { return nil },
+				func(r repository.Repositories) error {
+					if _, err := b.WithTx(r).CreateClient(vpn.CreateRequest{Name: "alice"}); err != nil {
+						return err
+					}
+					if len(applier.added) != 0 {
+						t.Error("пир добавлен на интерфейс до коммита")
+					}
+					return tt.fnErr
+				})
+			if !errors.Is(err, tt.fnErr) {
+				t.Fatalf("RunInTx: %v, ожидалось %v", err, tt.fnErr)
+			}
+
+			if len(txPeers.peers) != 1 {
+				t.Errorf("пир сохранён не в репозиторий транзакции: %+v", txPeers.peers)
+			}
+			if got := len(applier.added) == 1; got != tt.applied {
+				t.Errorf("пир добавлен на интерфейс: %v, ожидалось %v", applier.added, tt.applied)
+			}
+		})
+	}
+}
+
+func TestAfterCommitApplyFailureKeepsCommit(t *testing.T) {
+	b := NewBackend(testConfig, &fakePeers{}, &recordingApplier{err: errors.New("wg недоступен")}).(*backend)
+
+	// Ошибка применения после коммита только пишется в лог: пир уже сохранён.
+	err := repository.RunInTx(repository.Repositories{WireGuardPeers: &fakePeers{}}, func() error { return nil },
+		func(r repository.Repositories) error {
+			_, err := b.WithTx(r).CreateClient(vpn.CreateRequest{Name: "alice"})
+			return err
+		})
+	if err != nil {
+		t.Errorf("RunInTx: %v", err)
+	}
+}
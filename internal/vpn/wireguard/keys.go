@@ -0,0 +1,35 @@
+package wireguard
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// generateKeyPair создаёт ключи Curve25519 в base64, как wg genkey и
+// wg pubkey.
+func generateKeyPair() (privateKey, publicKey string, err error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", "", err
+	}
+	// Приводим скаляр к виду X25519, как это делает wg genkey.
+	key[0] &= 248
+	key[31] = key[31]&127 | 64
+
+	private, err := ecdh.X25519().NewPrivateKey(key[:])
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key[:]),
+		base64.StdEncoding.EncodeToString(private.PublicKey().Bytes()), nil
+}
+
+// generatePresharedKey создаёт ключ, как wg genpsk.
+func generatePresharedKey() (string, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key[:]), nil
+}
@@ -0,0 +1,210 @@
+// Package wireguard — пиры WireGuard, которые бот заводит сам: генерирует
+// ключи, выдаёт адрес из подсети и отдаёт пользователю файл .conf. Адреса
+// хранятся в Postgres, а на интерфейс пиров переносит Applier.
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+const Name = "wireguard"
+
+// Config — параметры сервера, которые попадают в конфигурацию клиента.
+type Config struct {
+	// Subnet — подсеть клиентов; первый адрес в ней у сервера.
+	Subnet netip.Prefix
+	// ServerPublicKey — публичный ключ интерфейса сервера.
+	ServerPublicKey string
+	// Endpoint — адрес сервера для клиентов, host:port.
+	Endpoint string
+	// DNS — DNS-серверы клиента через запятую, пусто — не задавать.
+	DNS string
+	// AllowedIPs — что клиент направляет в туннель.
+	AllowedIPs string
+	// PersistentKeepalive — интервал keepalive в секундах, 0 — отключён.
+	PersistentKeepalive int
+}
+
+// ParseSubnet разбирает подсеть клиентов. Поддерживается только IPv4:
+// в ней должны поместиться сервер и хотя бы один клиент.
+func ParseSubnet(s string) (netip.Prefix, error) {
+	subnet, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if !subnet.Addr().Is4() || subnet.Bits() < 8 || subnet.Bits() > 30 {
+		return netip.Prefix{}, fmt.Errorf("подсеть WireGuard %s: нужна IPv4-подсеть от /8 до /30", s)
+	}
+	return subnet.Masked(), nil
+}
+
+type backend struct {
+	cfg     Config
+	peers   repository.WireGuardPeerRepository
+	applier Applier
+
+	// mu выстраивает изменения пиров в очередь: адрес выдаётся по одному,
+	// а файл пиров переписывается целиком. Общий для копий из WithTx.
+	mu *sync.Mutex
+}
+
+// NewBackend создаёт провайдер пиров. Клиент на сервере — пир, его ID —
+// публичный ключ пира.
+func NewBackend(cfg Config, peers repository.WireGuardPeerRepository, applier Applier) vpn.Backend {
+	if cfg.AllowedIPs == "" {
+		cfg.AllowedIPs = "0.0.0.0/0, ::/0"
+	}
+	return &backend{cfg: cfg, peers: peers, applier: applier, mu: &sync.Mutex{}}
+}
+
+// WithTx возвращает провайдер, который хранит пиров в транзакции r, а на
+// интерфейс переносит их только после коммита. Откат транзакции отменяет
+// выдачу адреса сам.
+func (b *backend) WithTx(r repository.Repositories) vpn.Backend {
+	return &backend{
+		cfg:     b.cfg,
+		peers:   r.WireGuardPeers,
+		applier: &afterCommit{tx: r, applier: b.applier},
+		mu:      b.mu,
+	}
+}
+
+func (b *backend) Name() string {
+	return Name
+}
+
+// CreateClient генерирует ключи, занимает адрес и добавляет пира на
+// интерфейс. Если добавить не удалось, адрес освобождается.
+func (b *backend) CreateClient(req vpn.CreateRequest) (*vpn.Client, error) {
+	privateKey, publicKey, err := generateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	presharedKey, err := generatePresharedKey()
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peer := &domain.WireGuardPeer{PublicKey: publicKey, PresharedKey: presharedKey, Name: req.Name}
+	if err := b.peers.Allocate(peer, b.cfg.Subnet); err != nil {
+		return nil, err
+	}
+	if err := b.applier.AddPeer(*peer); err != nil {
+		if deleteErr := b.peers.Delete(publicKey); deleteErr != nil {
+			return nil, fmt.Errorf("%w (адрес %s не освобождён: %v)", err, peer.Address, deleteErr)
+		}
+		return nil, err
+	}
+	return &vpn.Client{ID: publicKey, Key: b.renderConfig(privateKey, peer)}, nil
+}
+
+// RevokeClient снимает пира с интерфейса и освобождает его адрес.
+func (b *backend) RevokeClient(clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peer, err := b.peer(clientID)
+	if err != nil {
+		return err
+	}
+	if peer.Enabled {
+		if err := b.disable(peer); err != nil {
+			return err
+		}
+	}
+	return b.peers.Delete(clientID)
+}
+
+// ExtendClient возвращает приостановленного пира на интерфейс: срок
+// действия хранит бот.
+func (b *backend) ExtendClient(clientID string, expiresAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peer, err := b.peer(clientID)
+	if err != nil || peer.Enabled {
+		return err
+	}
+	if err := b.peers.SetEnabled(clientID, true); err != nil {
+		return err
+	}
+	peer.Enabled = true
+	if err := b.applier.AddPeer(*peer); err != nil {
+		return errors.Join(err, b.peers.SetEnabled(clientID, false))
+	}
+	return nil
+}
+
+// SuspendClient снимает пира с интерфейса, сохраняя за ним адрес.
+func (b *backend) SuspendClient(clientID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	peer, err := b.peer(clientID)
+	if err != nil || !peer.Enabled {
+		return err
+	}
+	return b.disable(peer)
+}
+
+// Usage не поддерживается: счётчики трафика есть только у интерфейса.
+func (b *backend) Usage(clientID string) (*vpn.Usage, error) {
+	return nil, vpn.ErrNotSupported
+}
+
+func (b *backend) peer(clientID string) (*domain.WireGuardPeer, error) {
+	peer, err := b.peers.GetByPublicKey(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if peer == nil {
+		return nil, vpn.ErrClientNotFound
+	}
+	return peer, nil
+}
+
+// disable выключает пира в базе до Applier, чтобы файл пиров собрался уже
+// без него; если снять пира не удалось, он снова включается.
+func (b *backend) disable(peer *domain.WireGuardPeer) error {
+	if err := b.peers.SetEnabled(peer.PublicKey, false); err != nil {
+		return err
+	}
+	peer.Enabled = false
+	if err := b.applier.RemovePeer(*peer); err != nil {
+		return errors.Join(err, b.peers.SetEnabled(peer.PublicKey, true))
+	}
+	return nil
+}
+
+// renderConfig собирает файл .conf, который импортируется в приложение
+// WireGuard.
+func (b *backend) renderConfig(privateKey string, peer *domain.WireGuardPeer) string {
+	var conf strings.Builder
+	conf.WriteString("[Interface]\n")
+	fmt.Fprintf(&conf, "PrivateKey = %s\n", privateKey)
+	fmt.Fprintf(&conf, "Address = %s/32\n", peer.Address)
+	if b.cfg.DNS != "" {
+		fmt.Fprintf(&conf, "DNS = %s\n", b.cfg.DNS)
+	}
+	conf.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&conf, "PublicKey = %s\n", b.cfg.ServerPublicKey)
+	fmt.Fprintf(&conf, "PresharedKey = %s\n", peer.PresharedKey)
+	fmt.Fprintf(&conf, "AllowedIPs = %s\n", b.cfg.AllowedIPs)
+	fmt.Fprintf(&conf, "Endpoint = %s\n", b.cfg.Endpoint)
+	if b.cfg.PersistentKeepalive > 0 {
+		fmt.Fprintf(&conf, "PersistentKeepalive = %d\n", b.cfg.PersistentKeepalive)
+	}
+	return conf.String()
+}
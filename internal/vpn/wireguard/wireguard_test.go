@@ -0,0 +1,259 @@
+package wireguard
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/domain"
+	"vpn-bot/internal/repository"
+	"vpn-bot/internal/vpn"
+)
+
+// fakePeers хранит пиров в памяти и выдаёт адреса так же, как Postgres:
+// первый свободный после адреса сервера.
+type fakePeers struct {
+	peers []domain.WireGuardPeer
+}
+
+func (r *fakePeers) Allocate(peer *domain.WireGuardPeer, subnet netip.Prefix) error {
+	subnet = subnet.Masked()
+	for addr := subnet.Addr().Next().Next(); subnet.Contains(addr.Next()); addr = addr.Next() {
+		taken := slices.ContainsFunc(r.peers, func(p domain.WireGuardPeer) bool { return p.Address == addr.String() })
+		if taken {
+			continue
+		}
+		peer.ID = len(r.peers) + 1
+		peer.Address = addr.String()
+		peer.Enabled = true
+		r.peers = append(r.peers, *peer)
+		return nil
+	}
+	return repository.ErrNoFreeAddresses
+}
+
+func (r *fakePeers) GetByPublicKey(publicKey string) (*domain.WireGuardPeer, error) {
+	i := slices.IndexFunc(r.peers, func(p domain.WireGuardPeer) bool { return p.PublicKey == publicKey })
+	if i < 0 {
+		return nil, nil
+	}
+	peer := r.peers[i]
+	return &peer, nil
+}
+
+func (r *fakePeers) SetEnabled(publicKey string, enabled bool) error {
+	for i := range r.peers {
+		if r.peers[i].PublicKey == publicKey {
+			r.peers[i].Enabled = enabled
+		}
+	}
+	return nil
+}
+
+func (r *fakePeers) Delete(publicKey string) error {
+	r.peers = slices.DeleteFunc(r.peers, func(p domain.WireGuardPeer) bool { return p.PublicKey == publicKey })
+	return nil
+}
+
+func (r *fakePeers) ListEnabled() ([]domain.WireGuardPeer, error) {
+	var enabled []domain.WireGuardPeer
+	for _, p := range r.peers {
+		if p.Enabled {
+			enabled = append(enabled, p)
+		}
+	}
+	return enabled, nil
+}
+
+// recordingApplier запоминает изменения интерфейса; если задан err, отказывает.
+type recordingApplier struct {
+	added   []string
+	removed []string
+	err     error
+}
+
+func (a *recordingApplier) AddPeer(peer domain.WireGuardPeer) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.added = append(a.added, peer.Address)
+	return nil
+}
+
+func (a *recordingApplier) RemovePeer(peer domain.WireGuardPeer) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.removed = append(a.removed, peer.Address)
+	return nil
+}
+
+var testConfig = Config{
+	Subnet:          netip.MustParsePrefix("10.8.0.0/29"),
+	ServerPublicKey: "c2VydmVyLXB1YmxpYy1rZXktYmFzZTY0LWVuY29kZWQ=",
+	Endpoint:        "vpn.example.com:51820",
+}
+
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.8.0.0/24", "10.8.0.0/24"},
+		{"10.8.0.17/24", "10.8.0.0/24"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.8.0.0/30", "10.8.0.0/30"},
+		{"10.8.0.0/31", ""},
+		{"10.0.0.0/7", ""},
+		{"fd00::/64", ""},
+		{"10.8.0.0", ""},
+	}
+	for _, tt := range tests {
+		subnet, err := ParseSubnet(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseSubnet(%q) = %s, ожидалась ошибка", tt.in, subnet)
+			}
+			continue
+		}
+		if err != nil || subnet.String() != tt.want {
+			t.Errorf("ParseSubnet(%q) = %s, %v, ожидалось %s", tt.in, subnet, err, tt.want)
+		}
+	}
+}
+
+func TestRenderConfig(t *testing.T) {
+	cfg := testConfig
+	cfg.DNS = "1.1.1.1, 1.0.0.1"
+	cfg.PersistentKeepalive = 25
+	b := NewBackend(cfg, &fakePeers{}, &recordingApplier{}).(*backend)
+
+	peer := &domain.WireGuardPeer{Address: "10.8.0.2", PresharedKey: "cHNr"}
+	want := "[Interface]\n" +
+		"PrivateKey = cHJpdg==\n" +
+		"Address = 10.8.0.2/32\n" +
+		"DNS = 1.1.1.1, 1.0.0.1\n" +
+		"\n[Peer]\n" +
+		"PublicKey = " + cfg.ServerPublicKey + "\n" +
+		"PresharedKey = cHNr\n" +
+		"AllowedIPs = 0.0.0.0/0, ::/0\n" +
+		"Endpoint = vpn.example.com:51820\n" +
+		"PersistentKeepalive = 25\n"
+	if got := b.renderConfig("cHJpdg==", peer); got != want {
+		t.Errorf("конфигурация:\n%s\nожидалась:\n%s", got, want)
+	}
+}
+
+func TestRenderConfigOptionalFields(t *testing.T) {
+	cfg := testConfig
+	cfg.AllowedIPs = "10.8.0.0/24"
+	b := NewBackend(cfg, &fakePeers{}, &recordingApplier{}).(*backend)
+
+	conf := b.renderConfig("cHJpdg==", &domain.WireGuardPeer{Address: "10.8.0.2", PresharedKey: "cHNr"})
+	if strings.Contains(conf, "DNS") || strings.Contains(conf, "PersistentKeepalive") {
+		t.Errorf("незаданные поля попали в конфигурацию:\n%s", conf)
+	}
+	if !strings.Contains(conf, "AllowedIPs = 10.8.0.0/24\n") {
+		t.Errorf("AllowedIPs не из настроек:\n%s", conf)
+	}
+}
+
+func TestCreateClient(t *testing.T) {
+	peers := &fakePeers{}
+	applier := &recordingApplier{}
+	b := NewBackend(testConfig, peers, applier)
+
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	if !strings.Contains(client.Key, "Address = 10.8.0.2/32\n") {
+		t.Errorf("первому клиенту выдан не 10.8.0.2:\n%s", client.Key)
+	}
+	if !slices.Equal(applier.added, []string{"10.8.0.2"}) {
+		t.Errorf("на интерфейс добавлены %v", applier.added)
+	}
+
+	// Публичный ключ пира — ID клиента — должен соответствовать приватному из файла.
+	var privateKey string
+	for _, line := range strings.Split(client.Key, "\n") {
+		if value, ok := strings.CutPrefix(line, "PrivateKey = "); ok {
+			privateKey = value
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		t.Fatalf("приватный ключ %q: %v", privateKey, err)
+	}
+	private, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.StdEncoding.EncodeToString(private.PublicKey().Bytes()); got != client.ID {
+		t.Errorf("публичный ключ %s не соответствует приватному, ожидался %s", client.ID, got)
+	}
+}
+
+func TestCreateClientApplyFailure(t *testing.T) {
+	peers := &fakePeers{}
+	b := NewBackend(testConfig, peers, &recordingApplier{err: errors.New("wg недоступен")})
+
+	if _, err := b.CreateClient(vpn.CreateRequest{Name: "alice"}); err == nil {
+		t.Fatal("ошибка применения не возвращена")
+	}
+	if len(peers.peers) != 0 {
+		t.Errorf("адрес не освобождён: %+v", peers.peers)
+	}
+}
+
+func TestSubnetExhausted(t *testing.T) {
+	// В /29 шесть адресов узлов: один у сервера, пять у клиентов.
+	b := NewBackend(testConfig, &fakePeers{}, &recordingApplier{})
+	for i := 0; i < 5; i++ {
+		if _, err := b.CreateClient(vpn.CreateRequest{Name: "client"}); err != nil {
+			t.Fatalf("клиент %d: %v", i+1, err)
+		}
+	}
+	if _, err := b.CreateClient(vpn.CreateRequest{Name: "extra"}); !errors.Is(err, repository.ErrNoFreeAddresses) {
+		t.Errorf("шестой клиент: %v, ожидалась ErrNoFreeAddresses", err)
+	}
+}
+
+func TestSuspendExtendRevoke(t *testing.T) {
+	peers := &fakePeers{}
+	applier := &recordingApplier{}
+	b := NewBackend(testConfig, peers, applier)
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "bob"})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	if err := b.(vpn.Suspender).SuspendClient(client.ID); err != nil {
+		t.Fatalf("SuspendClient: %v", err)
+	}
+	if peer, _ := peers.GetByPublicKey(client.ID); peer.Enabled || len(applier.removed) != 1 {
+		t.Errorf("после приостановки пир включён: %v, снят с интерфейса: %v", peer.Enabled, applier.removed)
+	}
+
+	if err := b.ExtendClient(client.ID, time.Now().AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("ExtendClient: %v", err)
+	}
+	if peer, _ := peers.GetByPublicKey(client.ID); !peer.Enabled || len(applier.added) != 2 {
+		t.Errorf("после продления пир включён: %v, добавлен на интерфейс: %v", peer.Enabled, applier.added)
+	}
+
+	if err := b.RevokeClient(client.ID); err != nil {
+		t.Fatalf("RevokeClient: %v", err)
+	}
+	if peer, _ := peers.GetByPublicKey(client.ID); peer != nil {
+		t.Errorf("пир остался в базе: %+v", peer)
+	}
+	if err := b.RevokeClient(client.ID); !errors.Is(err, vpn.ErrClientNotFound) {
+		t.Errorf("повторное удаление: %v, ожидалась ErrClientNotFound", err)
+	}
+}
@@ -0,0 +1,138 @@
+package xui
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// transport — параметры подключения, общие для ссылок VLESS и VMess.
+type transport struct {
+	network     string
+	security    string
+	sni         string
+	fingerprint string
+	host        string
+	path        string
+}
+
+// link собирает ссылку, которую пользователь импортирует в v2rayNG,
+// Hiddify, Streisand и другие клиенты Xray.
+func (b *backend) link(inbound *Inbound, stream *StreamSettings, client *Client) (string, error) {
+	t := transport{network: stream.Network, security: stream.Security}
+	if t.network == "" {
+		t.network = "tcp"
+	}
+	if t.security == "" {
+		t.security = "none"
+	}
+	switch {
+	case stream.RealitySettings != nil && t.security == "reality":
+		t.fingerprint = stream.RealitySettings.Settings.Fingerprint
+		t.sni = first(stream.RealitySettings.ServerNames)
+	case stream.TLSSettings != nil && t.security == "tls":
+		t.fingerprint = stream.TLSSettings.Settings.Fingerprint
+		t.sni = stream.TLSSettings.ServerName
+	}
+	switch {
+	case stream.WSSettings != nil && t.network == "ws":
+		t.path = stream.WSSettings.Path
+		t.host = stream.WSSettings.Headers["Host"]
+	case stream.GRPCSettings != nil && t.network == "grpc":
+		t.path = stream.GRPCSettings.ServiceName
+	}
+
+	name := client.Email
+	if inbound.Remark != "" {
+		name = inbound.Remark + "-" + client.Email
+	}
+	if inbound.Protocol == "vmess" {
+		return b.vmessLink(inbound, t, client, name)
+	}
+	return b.vlessLink(inbound, stream, t, client, name)
+}
+
+func (b *backend) vlessLink(inbound *Inbound, stream *StreamSettings, t transport, client *Client, name string) (string, error) {
+	q := url.Values{}
+	q.Set("type", t.network)
+	q.Set("encryption", "none")
+	q.Set("security", t.security)
+	if t.sni != "" {
+		q.Set("sni", t.sni)
+	}
+	if t.fingerprint != "" {
+		q.Set("fp", t.fingerprint)
+	}
+	if t.security == "reality" {
+		reality := stream.RealitySettings
+		if reality == nil || reality.Settings.PublicKey == "" {
+			return "", fmt.Errorf("3x-ui: у inbound %d нет публичного ключа REALITY", inbound.ID)
+		}
+		q.Set("pbk", reality.Settings.PublicKey)
+		if sid := first(reality.ShortIDs); sid != "" {
+			q.Set("sid", sid)
+		}
+		if reality.Settings.SpiderX != "" {
+			q.Set("spx", reality.Settings.SpiderX)
+		}
+	}
+	switch t.network {
+	case "ws":
+		q.Set("path", t.path)
+		if t.host != "" {
+			q.Set("host", t.host)
+		}
+	case "grpc":
+		q.Set("serviceName", t.path)
+	}
+	if client.Flow != "" {
+		q.Set("flow", client.Flow)
+	}
+
+	u := url.URL{
+		Scheme:   "vless",
+		User:     url.User(client.ID),
+		Host:     net.JoinHostPort(b.cfg.Host, strconv.Itoa(inbound.Port)),
+		RawQuery: q.Encode(),
+		Fragment: name,
+	}
+	return u.String(), nil
+}
+
+// vmessLink — ссылка в формате v2rayN: JSON в base64.
+func (b *backend) vmessLink(inbound *Inbound, t transport, client *Client, name string) (string, error) {
+	tls := ""
+	if t.security == "tls" {
+		tls = "tls"
+	}
+	data, err := json.Marshal(map[string]string{
+		"v":    "2",
+		"ps":   name,
+		"add":  b.cfg.Host,
+		"port": strconv.Itoa(inbound.Port),
+		"id":   client.ID,
+		"aid":  "0",
+		"scy":  "auto",
+		"net":  t.network,
+		"type": "none",
+		"host": t.host,
+		"path": t.path,
+		"tls":  tls,
+		"sni":  t.sni,
+		"fp":   t.fingerprint,
+	})
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
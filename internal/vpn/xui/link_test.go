@@ -0,0 +1,74 @@
+package xui_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/vpn"
+	"vpn-bot/internal/vpn/xui"
+	"vpn-bot/internal/vpn/xui/xuitest"
+)
+
+func TestVLESSRealityLink(t *testing.T) {
+	b, _ := newBackend(t, xui.Config{Host: "vpn.example.com", Flow: flow})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	link, err := url.Parse(client.Key)
+	if err != nil {
+		t.Fatalf("ссылка %q не разбирается: %v", client.Key, err)
+	}
+	if link.Scheme != "vless" {
+		t.Errorf("схема %q, ожидалась vless", link.Scheme)
+	}
+	if link.User.Username() != client.ID {
+		t.Errorf("UUID в ссылке %q, ожидался %q", link.User.Username(), client.ID)
+	}
+	if link.Host != "vpn.example.com:443" {
+		t.Errorf("адрес %q, ожидался vpn.example.com:443", link.Host)
+	}
+	if !strings.HasPrefix(link.Fragment, "reality-alice-") {
+		t.Errorf("название %q, ожидалось reality-alice-<начало UUID>", link.Fragment)
+	}
+
+	want := map[string]string{
+		"type":       "tcp",
+		"encryption": "none",
+		"security":   "reality",
+		"sni":        "www.google.com",
+		"fp":         "chrome",
+		"pbk":        xuitest.PublicKey,
+		"sid":        "6ba85179e30d4fc2",
+		"spx":        "/",
+		"flow":       flow,
+	}
+	q := link.Query()
+	for param, value := range want {
+		if got := q.Get(param); got != value {
+			t.Errorf("%s = %q, ожидалось %q", param, got, value)
+		}
+	}
+}
+
+func TestLinkWithoutFlow(t *testing.T) {
+	b, _ := newBackend(t, xui.Config{})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "bob", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	link, err := url.Parse(client.Key)
+	if err != nil {
+		t.Fatalf("ссылка %q не разбирается: %v", client.Key, err)
+	}
+	if q := link.Query(); q.Has("flow") {
+		t.Errorf("flow %q в ссылке, хотя он не настроен", q.Get("flow"))
+	}
+	if host := link.Hostname(); host != "127.0.0.1" {
+		t.Errorf("адрес %q, ожидался хост панели 127.0.0.1", host)
+	}
+}
@@ -0,0 +1,398 @@
+// Package xui — клиенты VLESS и VMess в inbound Xray через API панели 3x-ui.
+// Срок действия и лимит трафика клиента панель соблюдает сама.
+package xui
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vpn-bot/internal/vpn"
+)
+
+const Name = "xui"
+
+// errUnauthorized — сессия панели истекла, нужно войти заново.
+var errUnauthorized = errors.New("3x-ui: требуется вход")
+
+// Config — подключение к панели и inbound, в котором создаются клиенты.
+type Config struct {
+	// URL — адрес панели вместе с секретным путём (webBasePath).
+	URL      string
+	Username string
+	Password string
+	// InboundID — ID inbound VLESS или VMess.
+	InboundID int
+	// Host — адрес сервера в ссылке для клиента; пустой — хост из URL.
+	Host string
+	// Flow — flow клиентов VLESS поверх TCP с REALITY или TLS.
+	Flow string
+	// TrafficLimit — лимит трафика клиента в байтах, 0 — без лимита.
+	TrafficLimit int64
+}
+
+// Response — обёртка всех ответов API панели.
+type Response struct {
+	Success bool            `json:"success"`
+	Msg     string          `json:"msg"`
+	Obj     json.RawMessage `json:"obj"`
+}
+
+// Inbound — inbound панели. Settings и StreamSettings панель хранит и
+// отдаёт JSON-строками.
+type Inbound struct {
+	ID             int             `json:"id"`
+	Remark         string          `json:"remark"`
+	Protocol       string          `json:"protocol"`
+	Port           int             `json:"port"`
+	Settings       string          `json:"settings"`
+	StreamSettings string          `json:"streamSettings"`
+	ClientStats    []ClientTraffic `json:"clientStats"`
+}
+
+// Client — клиент в настройках inbound. TotalGB, несмотря на название, —
+// лимит в байтах, ExpiryTime — миллисекунды Unix.
+type Client struct {
+	ID         string `json:"id"`
+	Flow       string `json:"flow"`
+	Email      string `json:"email"`
+	LimitIP    int    `json:"limitIp"`
+	TotalGB    int64  `json:"totalGB"`
+	ExpiryTime int64  `json:"expiryTime"`
+	Enable     bool   `json:"enable"`
+}
+
+// ClientTraffic — статистика клиента. Панель ищет её по email клиента.
+type ClientTraffic struct {
+	Email string `json:"email"`
+	Up    int64  `json:"up"`
+	Down  int64  `json:"down"`
+}
+
+// ClientRequest — тело addClient и updateClient: ID inbound и
+// JSON-строка {"clients": [...]}.
+type ClientRequest struct {
+	ID       int    `json:"id"`
+	Settings string `json:"settings"`
+}
+
+// StreamSettings — транспорт inbound, из которого собирается ссылка.
+type StreamSettings struct {
+	Network         string           `json:"network"`
+	Security        string           `json:"security"`
+	RealitySettings *RealitySettings `json:"realitySettings,omitempty"`
+	TLSSettings     *TLSSettings     `json:"tlsSettings,omitempty"`
+	WSSettings      *WSSettings      `json:"wsSettings,omitempty"`
+	GRPCSettings    *GRPCSettings    `json:"grpcSettings,omitempty"`
+}
+
+type RealitySettings struct {
+	ServerNames []string              `json:"serverNames"`
+	ShortIDs    []string              `json:"shortIds"`
+	Settings    RealityClientSettings `json:"settings"`
+}
+
+// RealityClientSettings — то, что панель показывает клиенту: публичный
+// ключ, отпечаток uTLS и spiderX.
+type RealityClientSettings struct {
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"`
+	SpiderX     string `json:"spiderX"`
+}
+
+type TLSSettings struct {
+	ServerName string            `json:"serverName"`
+	Settings   TLSClientSettings `json:"settings"`
+}
+
+type TLSClientSettings struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+type WSSettings struct {
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+type GRPCSettings struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type backend struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// NewBackend создаёт клиента API панели. Вход выполняется при первом
+// запросе и повторяется, когда сессия истекает.
+func NewBackend(cfg Config) vpn.Backend {
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.Host == "" {
+		if u, err := url.Parse(cfg.URL); err == nil {
+			cfg.Host = u.Hostname()
+		}
+	}
+	jar, _ := cookiejar.New(nil)
+	return &backend{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Jar:     jar,
+			// Без сессии старые версии панели перенаправляют на страницу входа.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (b *backend) Name() string {
+	return Name
+}
+
+// CreateClient добавляет клиента в inbound. Email клиента в панели — имя
+// пользователя с началом UUID: панель требует, чтобы email был уникальным.
+func (b *backend) CreateClient(req vpn.CreateRequest) (*vpn.Client, error) {
+	inbound, err := b.inbound()
+	if err != nil {
+		return nil, err
+	}
+	var stream StreamSettings
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return nil, fmt.Errorf("3x-ui: настройки транспорта inbound %d: %w", inbound.ID, err)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	client := Client{
+		ID:         id,
+		Email:      req.Name + "-" + id[:8],
+		TotalGB:    b.cfg.TrafficLimit,
+		ExpiryTime: req.ExpiresAt.UnixMilli(),
+		Enable:     true,
+	}
+	if inbound.Protocol == "vless" && stream.Network == "tcp" && (stream.Security == "reality" || stream.Security == "tls") {
+		client.Flow = b.cfg.Flow
+	}
+
+	key, err := b.link(inbound, &stream, &client)
+	if err != nil {
+		return nil, err
+	}
+	body, err := clientRequest(inbound.ID, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.do(http.MethodPost, "/panel/api/inbounds/addClient", body, nil); err != nil {
+		return nil, err
+	}
+	return &vpn.Client{ID: id, Key: key}, nil
+}
+
+func (b *backend) RevokeClient(clientID string) error {
+	inbound, _, err := b.findClient(clientID)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/panel/api/inbounds/%d/delClient/%s", inbound.ID, url.PathEscape(clientID))
+	return b.do(http.MethodPost, path, nil, nil)
+}
+
+// ExtendClient переносит срок действия и включает клиента, если панель
+// отключила его по сроку. Остальные поля клиента остаются как были.
+func (b *backend) ExtendClient(clientID string, expiresAt time.Time) error {
+	inbound, client, err := b.findClient(clientID)
+	if err != nil {
+		return err
+	}
+	client["expiryTime"] = expiresAt.UnixMilli()
+	client["enable"] = true
+
+	body, err := clientRequest(inbound.ID, client)
+	if err != nil {
+		return err
+	}
+	return b.do(http.MethodPost, "/panel/api/inbounds/updateClient/"+url.PathEscape(clientID), body, nil)
+}
+
+func (b *backend) Usage(clientID string) (*vpn.Usage, error) {
+	inbound, client, err := b.findClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := client["email"].(string)
+	for _, stat := range inbound.ClientStats {
+		if stat.Email == email {
+			return &vpn.Usage{UsedBytes: stat.Up + stat.Down}, nil
+		}
+	}
+	return &vpn.Usage{}, nil
+}
+
+func (b *backend) inbound() (*Inbound, error) {
+	var inbound Inbound
+	if err := b.do(http.MethodGet, "/panel/api/inbounds/get/"+strconv.Itoa(b.cfg.InboundID), nil, &inbound); err != nil {
+		return nil, err
+	}
+	if inbound.Protocol != "vless" && inbound.Protocol != "vmess" {
+		return nil, fmt.Errorf("3x-ui: inbound %d — %s, а поддерживаются только vless и vmess", inbound.ID, inbound.Protocol)
+	}
+	return &inbound, nil
+}
+
+// findClient ищет клиента в настройках inbound. Клиент возвращается
+// как есть, со всеми полями, чтобы updateClient их не затёр.
+func (b *backend) findClient(clientID string) (*Inbound, map[string]interface{}, error) {
+	inbound, err := b.inbound()
+	if err != nil {
+		return nil, nil, err
+	}
+	var settings struct {
+		Clients []map[string]interface{} `json:"clients"`
+	}
+	// UseNumber сохраняет большие числа, например tgId, без потери точности.
+	dec := json.NewDecoder(strings.NewReader(inbound.Settings))
+	dec.UseNumber()
+	if err := dec.Decode(&settings); err != nil {
+		return nil, nil, fmt.Errorf("3x-ui: настройки inbound %d: %w", inbound.ID, err)
+	}
+	for _, client := range settings.Clients {
+		if client["id"] == clientID {
+			return inbound, client, nil
+		}
+	}
+	return nil, nil, vpn.ErrClientNotFound
+}
+
+func clientRequest(inboundID int, client interface{}) (*ClientRequest, error) {
+	settings, err := json.Marshal(map[string]interface{}{"clients": []interface{}{client}})
+	if err != nil {
+		return nil, err
+	}
+	return &ClientRequest{ID: inboundID, Settings: string(settings)}, nil
+}
+
+// do выполняет запрос к API от имени сессии панели и разбирает obj ответа
+// в out, если он не nil. Истёкшая сессия открывается заново один раз.
+func (b *backend) do(method, path string, in, out interface{}) error {
+	if err := b.login(false); err != nil {
+		return err
+	}
+	resp, err := b.request(method, path, in)
+	if errors.Is(err, errUnauthorized) {
+		if err := b.login(true); err != nil {
+			return err
+		}
+		resp, err = b.request(method, path, in)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return fmt.Errorf("3x-ui: %s", resp.Msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Obj, out)
+}
+
+func (b *backend) request(method, path string, in interface{}) (*Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, b.cfg.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	return decodeResponse(httpResp)
+}
+
+// login входит в панель, если сессии ещё нет или force.
+func (b *backend) login(force bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loggedIn && !force {
+		return nil
+	}
+	b.loggedIn = false
+
+	form := url.Values{"username": {b.cfg.Username}, "password": {b.cfg.Password}}
+	httpResp, err := b.client.PostForm(b.cfg.URL+"/login", form)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	resp, err := decodeResponse(httpResp)
+	if errors.Is(err, errUnauthorized) {
+		return fmt.Errorf("3x-ui: страница входа %s/login не найдена", b.cfg.URL)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return fmt.Errorf("3x-ui: вход не выполнен: %s", resp.Msg)
+	}
+	b.loggedIn = true
+	return nil
+}
+
+// decodeResponse разбирает ответ панели. Без сессии панель отвечает 404
+// или перенаправляет на страницу входа.
+func decodeResponse(httpResp *http.Response) (*Response, error) {
+	switch {
+	case httpResp.StatusCode == http.StatusUnauthorized, httpResp.StatusCode == http.StatusNotFound,
+		httpResp.StatusCode >= 300 && httpResp.StatusCode < 400:
+		return nil, errUnauthorized
+	case httpResp.StatusCode >= 400:
+		msg, _ := io.ReadAll(httpResp.Body)
+		return nil, fmt.Errorf("3x-ui: %s: %s", httpResp.Status, strings.TrimSpace(string(msg)))
+	}
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("3x-ui: не удалось разобрать ответ: %w", err)
+	}
+	return &resp, nil
+}
+
+// newUUID — случайный UUID версии 4, ID клиента в Xray.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
@@ -0,0 +1,151 @@
+package xui_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"vpn-bot/internal/vpn"
+	"vpn-bot/internal/vpn/xui"
+	"vpn-bot/internal/vpn/xui/xuitest"
+)
+
+const (
+	username = "admin"
+	password = "secret"
+	flow     = "xtls-rprx-vision"
+)
+
+func newBackend(t *testing.T, cfg xui.Config) (vpn.Backend, *xuitest.Server) {
+	t.Helper()
+	srv := xuitest.NewServer(username, password)
+	ts := srv.Start()
+	t.Cleanup(ts.Close)
+
+	cfg.URL = ts.URL
+	cfg.InboundID = xuitest.InboundID
+	if cfg.Username == "" {
+		cfg.Username, cfg.Password = username, password
+	}
+	return xui.NewBackend(cfg), srv
+}
+
+func TestLoginRejected(t *testing.T) {
+	b, _ := newBackend(t, xui.Config{Username: username, Password: "wrong"})
+
+	_, err := b.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "вход не выполнен") {
+		t.Fatalf("ожидалась ошибка входа, получено %v", err)
+	}
+}
+
+func TestCreateClient(t *testing.T) {
+	b, srv := newBackend(t, xui.Config{Flow: flow, TrafficLimit: 100 << 30})
+	expiresAt := time.Now().AddDate(0, 1, 0)
+
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "alice", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	got, ok := srv.Client(client.ID)
+	if !ok {
+		t.Fatalf("клиента %s нет в панели", client.ID)
+	}
+	if !strings.HasPrefix(got.Email, "alice-") {
+		t.Errorf("email %q, ожидался alice-<начало UUID>", got.Email)
+	}
+	if got.ExpiryTime != expiresAt.UnixMilli() {
+		t.Errorf("срок %d, ожидался %d", got.ExpiryTime, expiresAt.UnixMilli())
+	}
+	if got.TotalGB != 100<<30 {
+		t.Errorf("лимит %d, ожидалось %d", got.TotalGB, int64(100<<30))
+	}
+	if got.Flow != flow || !got.Enable {
+		t.Errorf("flow %q, enable %v, ожидались %q и true", got.Flow, got.Enable, flow)
+	}
+}
+
+func TestCreateClientDuplicateEmail(t *testing.T) {
+	b, _ := newBackend(t, xui.Config{})
+
+	// Email уникален благодаря началу UUID, даже у одного пользователя.
+	for i := 0; i < 3; i++ {
+		if _, err := b.CreateClient(vpn.CreateRequest{Name: "bob", ExpiresAt: time.Now()}); err != nil {
+			t.Fatalf("CreateClient #%d: %v", i+1, err)
+		}
+	}
+}
+
+func TestExtendClient(t *testing.T) {
+	b, srv := newBackend(t, xui.Config{Flow: flow})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "carol", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	expiresAt := time.Now().AddDate(0, 3, 0)
+	if err := b.ExtendClient(client.ID, expiresAt); err != nil {
+		t.Fatalf("ExtendClient: %v", err)
+	}
+	got, _ := srv.Client(client.ID)
+	if got.ExpiryTime != expiresAt.UnixMilli() || !got.Enable {
+		t.Errorf("срок %d, enable %v, ожидались %d и true", got.ExpiryTime, got.Enable, expiresAt.UnixMilli())
+	}
+	if got.Flow != flow || !strings.HasPrefix(got.Email, "carol-") {
+		t.Errorf("продление затёрло поля клиента: %+v", got)
+	}
+}
+
+func TestRevokeClient(t *testing.T) {
+	b, srv := newBackend(t, xui.Config{})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "dave", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	if err := b.RevokeClient(client.ID); err != nil {
+		t.Fatalf("RevokeClient: %v", err)
+	}
+	if _, ok := srv.Client(client.ID); ok {
+		t.Error("клиент остался в панели")
+	}
+	if err := b.RevokeClient(client.ID); !errors.Is(err, vpn.ErrClientNotFound) {
+		t.Errorf("повторное удаление: %v, ожидалась ErrClientNotFound", err)
+	}
+	if err := b.ExtendClient(client.ID, time.Now()); !errors.Is(err, vpn.ErrClientNotFound) {
+		t.Errorf("продление удалённого клиента: %v, ожидалась ErrClientNotFound", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	b, srv := newBackend(t, xui.Config{})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "erin", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	srv.AddTraffic(client.ID, 4096)
+	usage, err := b.Usage(client.ID)
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.UsedBytes != 4096 {
+		t.Errorf("трафик %d, ожидалось 4096", usage.UsedBytes)
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	b, srv := newBackend(t, xui.Config{})
+	client, err := b.CreateClient(vpn.CreateRequest{Name: "frank", ExpiresAt: time.Now()})
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+
+	// После перезапуска панели бот входит заново и повторяет запрос.
+	srv.ExpireSessions()
+	if _, err := b.Usage(client.ID); err != nil {
+		t.Fatalf("Usage после истечения сессии: %v", err)
+	}
+}
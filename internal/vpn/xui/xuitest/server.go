@@ -0,0 +1,248 @@
+// Package xuitest — заменитель API панели 3x-ui на httptest: один inbound
+// VLESS REALITY, клиенты и их трафик хранятся в памяти.
+package xuitest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"vpn-bot/internal/vpn/xui"
+)
+
+const (
+	// InboundID — ID единственного inbound.
+	InboundID = 1
+	// PublicKey — публичный ключ REALITY, который попадает в ссылки.
+	PublicKey = "Z84J2IelR9ch3k8VtlVhhs5ycBUlXA7wHBWcBrjqnAw"
+
+	sessionCookie = "3x-ui"
+)
+
+// Server — заменитель панели. Как и настоящая панель, без сессии он
+// отвечает на запросы к API 404.
+type Server struct {
+	Username string
+	Password string
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	clients  []xui.Client
+	traffic  map[string]int64
+	mux      *http.ServeMux
+}
+
+func NewServer(username, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		sessions: make(map[string]bool),
+		traffic:  make(map[string]int64),
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /login", s.login)
+	s.mux.HandleFunc("GET /panel/api/inbounds/get/{id}", s.authorized(s.getInbound))
+	s.mux.HandleFunc("POST /panel/api/inbounds/addClient", s.authorized(s.addClient))
+	s.mux.HandleFunc("POST /panel/api/inbounds/updateClient/{clientID}", s.authorized(s.updateClient))
+	s.mux.HandleFunc("POST /panel/api/inbounds/{id}/delClient/{clientID}", s.authorized(s.delClient))
+	return s
+}
+
+// Start запускает панель на свободном локальном порту; адрес панели для
+// xui.Config — URL сервера.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Client возвращает копию клиента по UUID.
+func (s *Server) Client(id string) (xui.Client, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(id)
+	if i < 0 {
+		return xui.Client{}, false
+	}
+	return s.clients[i], true
+}
+
+// AddTraffic добавляет клиенту трафик.
+func (s *Server) AddTraffic(id string, bytes int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(id)
+	if i < 0 {
+		return false
+	}
+	s.traffic[s.clients[i].Email] += bytes
+	return true
+}
+
+// ExpireSessions завершает все сессии, как перезапуск панели.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]bool)
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("username") != s.Username || r.FormValue("password") != s.Password {
+		writeResult(w, false, "Неверное имя пользователя или пароль", nil)
+		return
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session := hex.EncodeToString(token)
+
+	s.mu.Lock()
+	s.sessions[session] = true
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: session, Path: "/", HttpOnly: true})
+	writeResult(w, true, "Вход выполнен", nil)
+}
+
+func (s *Server) getInbound(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("id") != strconv.Itoa(InboundID) {
+		writeResult(w, false, "record not found", nil)
+		return
+	}
+
+	s.mu.Lock()
+	settings, _ := json.Marshal(map[string]interface{}{"clients": s.clients, "decryption": "none"})
+	stats := make([]xui.ClientTraffic, 0, len(s.clients))
+	for _, c := range s.clients {
+		stats = append(stats, xui.ClientTraffic{Email: c.Email, Down: s.traffic[c.Email]})
+	}
+	s.mu.Unlock()
+
+	stream, _ := json.Marshal(xui.StreamSettings{
+		Network:  "tcp",
+		Security: "reality",
+		RealitySettings: &xui.RealitySettings{
+			ServerNames: []string{"www.google.com"},
+			ShortIDs:    []string{"6ba85179e30d4fc2"},
+			Settings: xui.RealityClientSettings{
+				PublicKey:   PublicKey,
+				Fingerprint: "chrome",
+				SpiderX:     "/",
+			},
+		},
+	})
+	writeResult(w, true, "", xui.Inbound{
+		ID:             InboundID,
+		Remark:         "reality",
+		Protocol:       "vless",
+		Port:           443,
+		Settings:       string(settings),
+		StreamSettings: string(stream),
+		ClientStats:    stats,
+	})
+}
+
+func (s *Server) addClient(w http.ResponseWriter, r *http.Request) {
+	clients, ok := decodeClients(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range clients {
+		for _, existing := range s.clients {
+			if existing.Email == c.Email {
+				writeResult(w, false, "Duplicate email: "+c.Email, nil)
+				return
+			}
+		}
+	}
+	s.clients = append(s.clients, clients...)
+	writeResult(w, true, "Клиент добавлен", nil)
+}
+
+func (s *Server) updateClient(w http.ResponseWriter, r *http.Request) {
+	clients, ok := decodeClients(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(r.PathValue("clientID"))
+	if i < 0 || len(clients) != 1 {
+		writeResult(w, false, "client not found", nil)
+		return
+	}
+	s.clients[i] = clients[0]
+	writeResult(w, true, "Клиент обновлён", nil)
+}
+
+func (s *Server) delClient(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(r.PathValue("clientID"))
+	if i < 0 {
+		writeResult(w, false, "client not found", nil)
+		return
+	}
+	delete(s.traffic, s.clients[i].Email)
+	s.clients = append(s.clients[:i], s.clients[i+1:]...)
+	writeResult(w, true, "Клиент удалён", nil)
+}
+
+func (s *Server) find(id string) int {
+	for i, c := range s.clients {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeClients разбирает тело addClient и updateClient. Ошибку он
+// отправляет сам и возвращает false.
+func decodeClients(w http.ResponseWriter, r *http.Request) ([]xui.Client, bool) {
+	var req xui.ClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID != InboundID {
+		writeResult(w, false, "invalid request", nil)
+		return nil, false
+	}
+	var settings struct {
+		Clients []xui.Client `json:"clients"`
+	}
+	if err := json.Unmarshal([]byte(req.Settings), &settings); err != nil || len(settings.Clients) == 0 {
+		writeResult(w, false, "invalid settings", nil)
+		return nil, false
+	}
+	return settings.Clients, true
+}
+
+// authorized пропускает к API только запросы с cookie сессии.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		s.mu.Lock()
+		ok := err == nil && s.sessions[cookie.Value]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeResult(w http.ResponseWriter, success bool, msg string, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": success, "msg": msg, "obj": obj})
+}
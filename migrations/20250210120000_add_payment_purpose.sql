@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS purpose TEXT NOT NULL DEFAULT 'purchase',
+    ADD COLUMN IF NOT EXISTS vpn_key_id INT REFERENCES vpn_keys(id);
+
+-- +goose Down
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS vpn_key_id,
+    DROP COLUMN IF EXISTS purpose;
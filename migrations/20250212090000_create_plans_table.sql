@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS plans (
+                                     id SERIAL PRIMARY KEY,
+                                     name TEXT NOT NULL,
+                                     months INT NOT NULL,
+                                     price NUMERIC(10,2) NOT NULL,
+                                     currency TEXT NOT NULL DEFAULT 'RUB',
+                                     is_active BOOLEAN NOT NULL DEFAULT true,
+                                     created_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO plans (name, months, price, currency) VALUES
+    ('1 месяц', 1, 299, 'RUB'),
+    ('3 месяца', 3, 799, 'RUB'),
+    ('6 месяцев', 6, 1499, 'RUB'),
+    ('12 месяцев', 12, 2799, 'RUB');
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS plan_id INT REFERENCES plans(id);
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS plan_id;
+DROP TABLE IF EXISTS plans;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE vpn_keys ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS key_notifications (
+                                                 id SERIAL PRIMARY KEY,
+                                                 key_id INT NOT NULL REFERENCES vpn_keys(id) ON DELETE CASCADE,
+                                                 kind TEXT NOT NULL,
+                                                 expires_at TIMESTAMP NOT NULL,
+                                                 sent_at TIMESTAMP DEFAULT NOW(),
+                                                 UNIQUE (key_id, kind, expires_at)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS key_notifications;
+ALTER TABLE vpn_keys DROP COLUMN IF EXISTS status;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_at;
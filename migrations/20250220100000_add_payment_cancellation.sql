@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS cancellation_party TEXT,
+    ADD COLUMN IF NOT EXISTS cancellation_reason TEXT;
+
+-- +goose Down
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS cancellation_reason,
+    DROP COLUMN IF EXISTS cancellation_party;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE vpn_keys
+    ADD COLUMN IF NOT EXISTS reserved_payment_id INT REFERENCES payments(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_vpn_keys_reserved_payment_id ON vpn_keys (reserved_payment_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_vpn_keys_reserved_payment_id;
+ALTER TABLE vpn_keys
+    DROP COLUMN IF EXISTS reserved_until,
+    DROP COLUMN IF EXISTS reserved_payment_id;
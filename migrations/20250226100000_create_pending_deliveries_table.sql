@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS pending_deliveries (
+                                                  id SERIAL PRIMARY KEY,
+                                                  user_id INT NOT NULL REFERENCES users(id),
+                                                  payment_id INT NOT NULL UNIQUE REFERENCES payments(id),
+                                                  vpn_key_id INT REFERENCES vpn_keys(id),
+                                                  created_at TIMESTAMP DEFAULT NOW(),
+                                                  delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pending_deliveries_queue
+    ON pending_deliveries (created_at, id) WHERE delivered_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS pending_deliveries;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS notifications (
+                                             id BIGSERIAL PRIMARY KEY,
+                                             telegram_id BIGINT NOT NULL,
+                                             text TEXT NOT NULL,
+                                             parse_mode TEXT NOT NULL DEFAULT '',
+                                             status TEXT NOT NULL DEFAULT 'pending',
+                                             attempts INT NOT NULL DEFAULT 0,
+                                             next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+                                             last_error TEXT NOT NULL DEFAULT '',
+                                             created_at TIMESTAMP DEFAULT NOW(),
+                                             sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_due
+    ON notifications (next_attempt_at, id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS webhook_events (
+                                              id BIGSERIAL PRIMARY KEY,
+                                              event TEXT NOT NULL,
+                                              object_id TEXT NOT NULL,
+                                              payload JSONB NOT NULL,
+                                              status TEXT NOT NULL DEFAULT 'received',
+                                              attempts INT NOT NULL DEFAULT 0,
+                                              last_error TEXT NOT NULL DEFAULT '',
+                                              received_at TIMESTAMP DEFAULT NOW(),
+                                              processed_at TIMESTAMP,
+                                              UNIQUE (event, object_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS webhook_events;
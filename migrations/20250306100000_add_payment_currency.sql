@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS payment_anomalies (
+                                                 id SERIAL PRIMARY KEY,
+                                                 payment_id INT NOT NULL REFERENCES payments(id),
+                                                 kind TEXT NOT NULL,
+                                                 expected_amount NUMERIC(10, 2) NOT NULL,
+                                                 expected_currency TEXT NOT NULL,
+                                                 actual_amount TEXT NOT NULL,
+                                                 actual_currency TEXT NOT NULL,
+                                                 created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_anomalies_payment ON payment_anomalies (payment_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS payment_anomalies;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'yookassa';
+
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'yookassa';
+ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS webhook_events_event_object_id_key;
+ALTER TABLE webhook_events ADD CONSTRAINT webhook_events_provider_event_object_id_key UNIQUE (provider, event, object_id);
+
+-- +goose Down
+ALTER TABLE webhook_events DROP CONSTRAINT IF EXISTS webhook_events_provider_event_object_id_key;
+ALTER TABLE webhook_events ADD CONSTRAINT webhook_events_event_object_id_key UNIQUE (event, object_id);
+ALTER TABLE webhook_events DROP COLUMN IF EXISTS provider;
+
+ALTER TABLE payments DROP COLUMN IF EXISTS provider;
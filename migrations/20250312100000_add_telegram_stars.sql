@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE plans ADD COLUMN IF NOT EXISTS stars_price INT;
+
+UPDATE plans SET stars_price = 150 WHERE months = 1 AND stars_price IS NULL;
+UPDATE plans SET stars_price = 400 WHERE months = 3 AND stars_price IS NULL;
+UPDATE plans SET stars_price = 750 WHERE months = 6 AND stars_price IS NULL;
+UPDATE plans SET stars_price = 1400 WHERE months = 12 AND stars_price IS NULL;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS telegram_payment_charge_id TEXT;
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS telegram_payment_charge_id;
+ALTER TABLE plans DROP COLUMN IF EXISTS stars_price;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auto_renew BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS payment_method_id TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS payment_method_provider TEXT;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS recurring BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS recurring;
+
+ALTER TABLE users DROP COLUMN IF EXISTS payment_method_provider;
+ALTER TABLE users DROP COLUMN IF EXISTS payment_method_id;
+ALTER TABLE users DROP COLUMN IF EXISTS auto_renew;
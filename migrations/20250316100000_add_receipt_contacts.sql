@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone TEXT;
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS receipt_registration TEXT;
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS receipt_registration;
+
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
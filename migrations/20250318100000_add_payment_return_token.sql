@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS return_token TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_return_token ON payments (return_token);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payments_return_token;
+ALTER TABLE payments DROP COLUMN IF EXISTS return_token;
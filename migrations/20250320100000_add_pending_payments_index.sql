@@ -0,0 +1,6 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_payments_unfinished_created_at ON payments (created_at)
+    WHERE status IN ('pending', 'waiting_for_capture');
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_payments_unfinished_created_at;
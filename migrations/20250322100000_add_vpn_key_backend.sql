@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE vpn_keys
+    ADD COLUMN IF NOT EXISTS backend TEXT NOT NULL DEFAULT 'pool',
+    ADD COLUMN IF NOT EXISTS client_id TEXT;
+
+-- +goose Down
+ALTER TABLE vpn_keys
+    DROP COLUMN IF EXISTS client_id,
+    DROP COLUMN IF EXISTS backend;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS wireguard_peers (
+                                               id SERIAL PRIMARY KEY,
+                                               public_key TEXT NOT NULL UNIQUE,
+                                               preshared_key TEXT NOT NULL,
+                                               address INET NOT NULL UNIQUE,
+                                               name TEXT NOT NULL DEFAULT '',
+                                               enabled BOOLEAN NOT NULL DEFAULT TRUE,
+                                               created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS wireguard_peers;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE notifications
+    ADD COLUMN IF NOT EXISTS document_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS document BYTEA;
+
+-- +goose Down
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS document,
+    DROP COLUMN IF EXISTS document_name;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE notifications
+    ADD COLUMN IF NOT EXISTS photo BYTEA;
+
+-- +goose Down
+ALTER TABLE notifications
+    DROP COLUMN IF EXISTS photo;